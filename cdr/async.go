@@ -0,0 +1,74 @@
+package cdr
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const defaultPollInterval = 2 * time.Second
+
+// completeAsync waits for the asynchronously processed request req to finish. When resp
+// is not a 202 Accepted it is returned as-is. A 202 Accepted without a Content-Location
+// status endpoint cannot be waited for and returns ErrAsyncInProgress
+func (c *Client) completeAsync(req *http.Request, resp *Response, accept string) (*Response, error) {
+	if resp == nil || resp.StatusCode() != http.StatusAccepted {
+		return resp, nil
+	}
+	location := resp.Header.Get("Content-Location")
+	if location == "" {
+		return resp, ErrAsyncInProgress
+	}
+	statusURL, err := c.fhirStoreURL.Parse(location)
+	if err != nil {
+		return resp, err
+	}
+	return c.waitForAsync(req, statusURL, accept)
+}
+
+// waitForAsync polls the FHIR asynchronous request status endpoint at statusURL until
+// it no longer returns 202 Accepted or the context of origin is done. The Retry-After
+// header of the status endpoint is honoured. The polls are authorized like origin, so
+// a token of WithBearerToken is used for them as well
+func (c *Client) waitForAsync(origin *http.Request, statusURL *url.URL, accept string) (*Response, error) {
+	ctx := origin.Context()
+	override := c.bearerOverride(origin)
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, statusURL.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.setRequestHeaders(req); err != nil {
+			return nil, err
+		}
+		if override {
+			req.Header.Set("Authorization", origin.Header.Get("Authorization"))
+		}
+		req.Header.Set("Accept", accept)
+		resp, err := c.do(req, nil)
+		if err != nil || resp.StatusCode() != http.StatusAccepted {
+			return resp, err
+		}
+		wait := defaultPollInterval
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			wait = time.Duration(seconds) * time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return resp, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// asyncReadOptions returns the options of a read of the result of the asynchronously
+// processed request origin. Only the context of origin and a token of WithBearerToken are
+// kept, the other options of origin, e.g. WithProvenance, are meant for the write itself
+func (c *Client) asyncReadOptions(origin *http.Request) []OptionFunc {
+	options := []OptionFunc{WithContext(origin.Context())}
+	if c.bearerOverride(origin) {
+		options = append(options, WithHeader("Authorization", origin.Header.Get("Authorization")))
+	}
+	return options
+}
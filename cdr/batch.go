@@ -0,0 +1,217 @@
+package cdr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/philips-software/go-hsdp-api/internal"
+	"google.golang.org/protobuf/proto"
+)
+
+// BatchEntryResult is the outcome of a single entry of a batch bundle
+type BatchEntryResult struct {
+	// Index is the position of the entry in the request bundle
+	Index int
+	// Status is the HTTP status code of the entry, 0 when it could not be parsed
+	Status   int
+	Location string
+	ETag     string
+	// Outcome is the OperationOutcome returned for the entry, if any. Its concrete
+	// type matches the FHIR version of the service which executed the batch
+	Outcome proto.Message
+	// outcomeFailed is set when Outcome has an issue at or above Config.FailOnSeverity
+	outcomeFailed bool
+}
+
+// Failed reports whether the entry was not processed successfully, either by its status
+// or by an Outcome issue at or above the Config.FailOnSeverity of the client
+func (r BatchEntryResult) Failed() bool {
+	return r.outcomeFailed || r.Status < http.StatusOK || r.Status >= http.StatusMultipleChoices
+}
+
+// parseBatchStatus parses the status code from a bundle entry response status such as "201 Created"
+func parseBatchStatus(status string) int {
+	fields := strings.Fields(status)
+	if len(fields) == 0 {
+		return 0
+	}
+	code, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0
+	}
+	return code
+}
+
+// batchError returns an error wrapping ErrBatchFailed when every entry of results failed
+func batchError(operation string, results []BatchEntryResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+	for _, result := range results {
+		if !result.Failed() {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: %w: all %d entries failed", operation, ErrBatchFailed, len(results))
+}
+
+// ResolvePlaceholders maps the urn: placeholder fullUrls of the entries of the submitted
+// requestBundle to the Type/id references the server assigned, e.g.
+// urn:uuid:61ebe359-bfdc-4613-8bf2-c5e300945f0a to Patient/123. Use it after a
+// transaction, or batch, to refer to the new resources in follow-on writes.
+// Entries without a placeholder or without a location are skipped
+func ResolvePlaceholders(requestBundle []byte, results []BatchEntryResult) (map[string]string, error) {
+	var bundle internal.Bundle
+	if err := json.Unmarshal(requestBundle, &bundle); err != nil {
+		return nil, fmt.Errorf("ResolvePlaceholders: %w", err)
+	}
+	if len(bundle.Entry) != len(results) {
+		return nil, fmt.Errorf("ResolvePlaceholders: %w: %d entries, %d results", ErrBundleMismatch, len(bundle.Entry), len(results))
+	}
+	references := make(map[string]string)
+	for i, entry := range bundle.Entry {
+		if !strings.HasPrefix(entry.FullURL, "urn:") {
+			continue
+		}
+		if reference := locationReference(results[i].Location); reference != "" {
+			references[entry.FullURL] = reference
+		}
+	}
+	return references, nil
+}
+
+// locationReference returns the Type/id reference of a response location such as
+// Patient/123/_history/1 or an absolute URL ending in Type/id
+func locationReference(location string) string {
+	location, _, _ = strings.Cut(location, "/_history/")
+	parts := strings.Split(strings.TrimSuffix(location, "/"), "/")
+	if len(parts) < 2 || parts[len(parts)-2] == "" || parts[len(parts)-1] == "" {
+		return ""
+	}
+	return parts[len(parts)-2] + "/" + parts[len(parts)-1]
+}
+
+// transactionOrder is the rank of the request methods in the order a FHIR server processes
+// the entries of a transaction, regardless of their order in the bundle
+var transactionOrder = map[string]int{
+	http.MethodDelete: 1,
+	http.MethodPost:   2,
+	http.MethodPut:    3,
+	http.MethodPatch:  3,
+	http.MethodGet:    4,
+	http.MethodHead:   4,
+}
+
+// WithStrictOrder returns an option for Transaction which makes sure the entries are
+// processed in the order of the bundle. FHIR servers process a transaction in a fixed
+// order, first all DELETE entries, then POST, then PUT and PATCH and finally GET and HEAD,
+// and there is no way to ask for another order. The option fails locally with an error
+// wrapping ErrInvalidParameter when the server would reorder the entries, so the bundle can
+// be split into several transactions when the order matters, e.g. for provenance. It also
+// fails for entries without a known request method and for bundles which are not a
+// transaction, the entries of a batch are processed in no particular order at all.
+// Entries are always sent, and results returned, in the order of the bundle
+func WithStrictOrder() OptionFunc {
+	return func(req *http.Request) error {
+		if req.Body == nil {
+			return nil
+		}
+		body, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		var bundle struct {
+			Type  string `json:"type"`
+			Entry []struct {
+				Request struct {
+					Method string `json:"method"`
+					URL    string `json:"url"`
+				} `json:"request"`
+			} `json:"entry"`
+		}
+		if err := json.Unmarshal(body, &bundle); err != nil {
+			return fmt.Errorf("WithStrictOrder: %w", err)
+		}
+		if bundle.Type != "transaction" {
+			return fmt.Errorf("WithStrictOrder: %w: bundle type [%s] has no processing order, use a transaction",
+				ErrInvalidParameter, bundle.Type)
+		}
+		previous := 0
+		for i, entry := range bundle.Entry {
+			rank := transactionOrder[strings.ToUpper(entry.Request.Method)]
+			if rank == 0 {
+				return fmt.Errorf("WithStrictOrder: %w: entry %d has no known request method [%s]",
+					ErrInvalidParameter, i, entry.Request.Method)
+			}
+			if rank < previous {
+				return fmt.Errorf("WithStrictOrder: %w: entry %d (%s %s) would be processed before earlier entries",
+					ErrInvalidParameter, i, entry.Request.Method, entry.Request.URL)
+			}
+			previous = rank
+		}
+		return nil
+	}
+}
+
+// bundleIdentifier is the Bundle.identifier of a transaction
+type bundleIdentifier struct {
+	System string `json:"system,omitempty"`
+	Value  string `json:"value"`
+}
+
+// withBundleIdentifier returns transaction bundle with its identifier set to system and value.
+// An identifier already present must be the same, so a retry cannot change it by accident
+func withBundleIdentifier(bundle []byte, system, value string) ([]byte, error) {
+	if value == "" {
+		return nil, ErrMissingIdentifier
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(bundle, &fields); err != nil {
+		return nil, err
+	}
+	var bundleType string
+	_ = json.Unmarshal(fields["type"], &bundleType)
+	if bundleType != "transaction" {
+		return nil, fmt.Errorf("%w: bundle type [%s] is not transaction", ErrInvalidParameter, bundleType)
+	}
+	identifier := bundleIdentifier{System: system, Value: value}
+	if existing, ok := fields["identifier"]; ok {
+		var current bundleIdentifier
+		if err := json.Unmarshal(existing, &current); err != nil || current != identifier {
+			return nil, fmt.Errorf("%w: bundle identifier differs from [%s|%s]", ErrInvalidParameter, system, value)
+		}
+		return bundle, nil
+	}
+	encoded, err := json.Marshal(identifier)
+	if err != nil {
+		return nil, err
+	}
+	fields["identifier"] = encoded
+	return json.Marshal(fields)
+}
+
+// alreadyProcessed wraps err in ErrAlreadyProcessed when the server rejected a transaction
+// because a transaction with the same identifier was processed before. Servers report this
+// with 409 Conflict or with an OperationOutcome issue of code duplicate
+func alreadyProcessed(err error) error {
+	var outcomeErr *OperationOutcomeError
+	if !errors.As(err, &outcomeErr) {
+		return err
+	}
+	duplicate := outcomeErr.StatusCode == http.StatusConflict
+	for _, issue := range outcomeErr.Issues {
+		duplicate = duplicate || issue.Code == "duplicate"
+	}
+	if !duplicate {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrAlreadyProcessed, err)
+}
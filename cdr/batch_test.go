@@ -0,0 +1,98 @@
+package cdr_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/philips-software/go-hsdp-api/cdr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolvePlaceholders(t *testing.T) {
+	requestBundle := []byte(`{
+  "resourceType": "Bundle",
+  "type": "transaction",
+  "entry": [
+    {"fullUrl": "urn:uuid:61ebe359-bfdc-4613-8bf2-c5e300945f0a", "resource": {"resourceType": "Patient"}, "request": {"method": "POST", "url": "Patient"}},
+    {"fullUrl": "urn:uuid:88f151c0-a954-468a-88bd-5ae15c08e059", "resource": {"resourceType": "Observation"}, "request": {"method": "POST", "url": "Observation"}},
+    {"resource": {"resourceType": "Organization", "id": "org-1"}, "request": {"method": "PUT", "url": "Organization/org-1"}}
+  ]
+}`)
+	results := []cdr.BatchEntryResult{
+		{Index: 0, Status: 201, Location: "Patient/123/_history/1"},
+		{Index: 1, Status: 201, Location: "https://cdr.example.com/store/fhir/org/Observation/456/_history/1"},
+		{Index: 2, Status: 200, Location: "Organization/org-1/_history/3"},
+	}
+
+	references, err := cdr.ResolvePlaceholders(requestBundle, results)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, map[string]string{
+		"urn:uuid:61ebe359-bfdc-4613-8bf2-c5e300945f0a": "Patient/123",
+		"urn:uuid:88f151c0-a954-468a-88bd-5ae15c08e059": "Observation/456",
+	}, references)
+
+	_, err = cdr.ResolvePlaceholders(requestBundle, results[:2])
+	assert.True(t, errors.Is(err, cdr.ErrBundleMismatch))
+}
+
+func TestWithStrictOrder(t *testing.T) {
+	ordered := []byte(`{
+  "resourceType": "Bundle",
+  "type": "transaction",
+  "entry": [
+    {"request": {"method": "DELETE", "url": "Observation/1"}},
+    {"fullUrl": "urn:uuid:61ebe359-bfdc-4613-8bf2-c5e300945f0a", "resource": {"resourceType": "Patient"}, "request": {"method": "POST", "url": "Patient"}},
+    {"fullUrl": "urn:uuid:88f151c0-a954-468a-88bd-5ae15c08e059", "resource": {"resourceType": "Provenance"}, "request": {"method": "POST", "url": "Provenance"}},
+    {"resource": {"resourceType": "Organization", "id": "org-1"}, "request": {"method": "PUT", "url": "Organization/org-1"}}
+  ]
+}`)
+	req, _ := http.NewRequest(http.MethodPost, "https://cdr.example.com/store/fhir/org", bytes.NewReader(ordered))
+	if !assert.Nil(t, cdr.WithStrictOrder()(req)) {
+		return
+	}
+	body, _ := io.ReadAll(req.Body)
+	assert.Equal(t, ordered, body)
+
+	reordered := []byte(`{
+  "resourceType": "Bundle",
+  "type": "transaction",
+  "entry": [
+    {"resource": {"resourceType": "Organization", "id": "org-1"}, "request": {"method": "PUT", "url": "Organization/org-1"}},
+    {"resource": {"resourceType": "Provenance"}, "request": {"method": "POST", "url": "Provenance"}}
+  ]
+}`)
+	req, _ = http.NewRequest(http.MethodPost, "https://cdr.example.com/store/fhir/org", bytes.NewReader(reordered))
+	err := cdr.WithStrictOrder()(req)
+	assert.True(t, errors.Is(err, cdr.ErrInvalidParameter))
+	assert.Contains(t, err.Error(), "would be processed before earlier entries")
+
+	missingMethod := []byte(`{
+  "resourceType": "Bundle",
+  "type": "transaction",
+  "entry": [
+    {"request": {"method": "DELETE", "url": "Observation/1"}},
+    {"resource": {"resourceType": "Provenance"}, "request": {"url": "Provenance"}}
+  ]
+}`)
+	req, _ = http.NewRequest(http.MethodPost, "https://cdr.example.com/store/fhir/org", bytes.NewReader(missingMethod))
+	err = cdr.WithStrictOrder()(req)
+	assert.True(t, errors.Is(err, cdr.ErrInvalidParameter))
+	assert.Contains(t, err.Error(), "entry 1 has no known request method")
+
+	batch := []byte(`{
+  "resourceType": "Bundle",
+  "type": "batch",
+  "entry": [
+    {"request": {"method": "DELETE", "url": "Observation/1"}}
+  ]
+}`)
+	req, _ = http.NewRequest(http.MethodPost, "https://cdr.example.com/store/fhir/org", bytes.NewReader(batch))
+	err = cdr.WithStrictOrder()(req)
+	assert.True(t, errors.Is(err, cdr.ErrInvalidParameter))
+	assert.Contains(t, err.Error(), "bundle type [batch] has no processing order")
+}
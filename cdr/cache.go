@@ -0,0 +1,136 @@
+package cdr
+
+import (
+	"container/list"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// readCache keeps the ETag and body of the last read of resources so repeated reads can
+// be revalidated with If-None-Match. It is bounded to maxEntries, evicting the least
+// recently used entry, and entries older than ttl are dropped. A zero ttl keeps entries
+// until they are evicted
+type readCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	ttl        time.Duration
+	lru        *list.List
+	entries    map[string]*list.Element
+	now        func() time.Time
+}
+
+type readCacheEntry struct {
+	key    string
+	etag   string
+	header http.Header
+	body   []byte
+	stored time.Time
+}
+
+func newReadCache(maxEntries int, ttl time.Duration) *readCache {
+	return &readCache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+		now:        time.Now,
+	}
+}
+
+// cacheKey returns the key of req in the cache, empty when req is not cacheable. Only
+// reads of a single resource are cached, i.e. GET requests without a query. Requests
+// which already carry If-None-Match are left to the caller
+func cacheKey(req *http.Request) string {
+	if req.Method != http.MethodGet || req.URL.RawQuery != "" || req.Header.Get("If-None-Match") != "" {
+		return ""
+	}
+	return resourceKey(req)
+}
+
+// resourceKey returns the key of the resource req is about
+func resourceKey(req *http.Request) string {
+	path := req.URL.Opaque
+	if path == "" {
+		path = req.URL.Path
+	}
+	return req.URL.Host + path
+}
+
+// writeKey returns the key of the single resource the write req is about, empty when it
+// can change any resource, e.g. a conditional update, a batch or a transaction
+func writeKey(req *http.Request) string {
+	if req.URL.RawQuery != "" {
+		return ""
+	}
+	key := resourceKey(req)
+	segments := strings.Split(key, "/")
+	if len(segments) < 2 {
+		return ""
+	}
+	resourceType, id := segments[len(segments)-2], segments[len(segments)-1]
+	if !resourceTypeName.MatchString(resourceType) || id == "" || strings.HasPrefix(id, "$") {
+		return ""
+	}
+	return key
+}
+
+func (c *readCache) get(key string) *readCacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := element.Value.(*readCacheEntry)
+	if c.ttl > 0 && c.now().Sub(entry.stored) > c.ttl {
+		c.lru.Remove(element)
+		delete(c.entries, key)
+		return nil
+	}
+	c.lru.MoveToFront(element)
+	return entry
+}
+
+func (c *readCache) put(key, etag string, header http.Header, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &readCacheEntry{key: key, etag: etag, header: header.Clone(), body: body, stored: c.now()}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.lru.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*readCacheEntry).key)
+	}
+}
+
+// touch restarts the ttl of the entry with key after the server confirmed it is current
+func (c *readCache) touch(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*readCacheEntry).stored = c.now()
+	}
+}
+
+func (c *readCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.lru.Remove(element)
+		delete(c.entries, key)
+	}
+}
+
+func (c *readCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Init()
+	c.entries = make(map[string]*list.Element)
+}
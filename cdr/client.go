@@ -3,14 +3,21 @@ package cdr
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"os"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/fhir/go/fhirversion"
+	autoconf "github.com/philips-software/go-hsdp-api/config"
 	"github.com/philips-software/go-hsdp-api/internal"
 
 	"github.com/google/fhir/go/jsonformat"
@@ -28,6 +35,7 @@ type OptionFunc func(*http.Request) error
 
 // Config contains the configuration of a client
 type Config struct {
+	// Region and Environment are used to look up the CDR URL when neither CDRURL nor FHIRStore is set
 	Region      string
 	Environment string
 	RootOrgID   string
@@ -37,17 +45,89 @@ type Config struct {
 	Type      string
 	TimeZone  string
 	DebugLog  io.Writer
+	// DebugIndent pretty-prints JSON bodies in the DebugLog dumps. The bytes sent are not affected
+	DebugIndent bool
+	// MaxIdleConnsPerHost tunes the number of keep-alive connections kept per host.
+	// When set the client uses its own transport instead of the one of the IAM client
+	MaxIdleConnsPerHost int
+	// Logger, when set, receives a structured record of every request
+	Logger RequestLogger
+	// Tracer, when set, starts a span for every request
+	Tracer Tracer
+	// FHIRVersion is the FHIR version of the store, fhirversion.STU3 or fhirversion.R4.
+	// It is informational, see Client.FHIRVersion and Client.DetectFHIRVersion
+	FHIRVersion fhirversion.Version
+	// SkipVerify disables TLS certificate verification, e.g. for ephemeral test stores
+	// with self-signed certificates. Never enable it in production, a warning is
+	// written to stderr when a client is created with it
+	SkipVerify bool
+	// AcceptLanguage is the default Accept-Language of requests, see WithAcceptLanguage
+	AcceptLanguage string
+	// MaxResponseSize limits the size in bytes of response bodies which are read, e.g. of
+	// a huge $everything. Larger responses fail with ErrResponseTooLarge. Zero means no limit
+	MaxResponseSize int64
+	// ReadCacheSize enables an in-memory cache of up to this many resources. Reads of a
+	// cached resource are sent with If-None-Match and a 304 Not Modified is answered with
+	// the cached copy, see Response.FromCache. A Put, Patch or Delete of a single resource
+	// through the client invalidates that resource, any other write, e.g. a conditional
+	// update, a batch or a transaction, clears the cache. Zero disables the cache
+	ReadCacheSize int
+	// ReadCacheTTL is how long a cached resource is kept after it was last confirmed
+	// current. Zero keeps resources until they are evicted
+	ReadCacheTTL time.Duration
+	// NewMarshaller and NewUnmarshaller, when set, create the FHIR marshallers and
+	// unmarshallers of the client instead of jsonformat.NewMarshaller(false, "", "", ver)
+	// and jsonformat.NewUnmarshaller(timeZone, ver), e.g. to indent request bodies or
+	// to accept responses which do not validate
+	NewMarshaller   func(ver fhirversion.Version) (*jsonformat.Marshaller, error)
+	NewUnmarshaller func(timeZone string, ver fhirversion.Version) (*jsonformat.Unmarshaller, error)
+	// FailOnSeverity is the lowest severity of an OperationOutcome issue which makes a
+	// successful response fail, e.g. of $validate, and which marks a batch entry as failed.
+	// Defaults to SeverityError, use SeverityWarning to also reject on warnings
+	FailOnSeverity string
+	// CheckResponse decides which responses are successful, e.g. to adapt to a store
+	// with unusual status codes. A non-nil error fails the request, the response is
+	// still returned. The body must be left readable, e.g. by restoring it after
+	// reading. Defaults to CheckResponse
+	CheckResponse func(resp *http.Response) error
+	// PathEncoding is how request paths are put in the URL, PathEncodingOpaque or
+	// PathEncodingEscaped. Defaults to PathEncodingOpaque, the default will change to
+	// PathEncodingEscaped once it has been validated against the CDR deployments
+	PathEncoding string
 }
 
+// Request path encodings, see Config.PathEncoding
+const (
+	// PathEncodingOpaque sends the path as URL.Opaque, exactly as given, which keeps
+	// segments escaped by the caller, e.g. ids, from being escaped a second time. Some
+	// proxies and gateways reject requests built this way and characters which need
+	// escaping, e.g. spaces, are sent unescaped
+	PathEncodingOpaque = "opaque"
+	// PathEncodingEscaped sends the path as a normal URL.Path. Segments escaped by the
+	// caller are kept as they are and anything else which needs escaping is escaped
+	PathEncodingEscaped = "escaped"
+)
+
 // A Client manages communication with HSDP CDR API
+//
+// A Client and its services are safe for concurrent use by multiple goroutines.
+// The FHIR marshallers and unmarshallers are not modified after creation and
+// DebugLog dumps of concurrent requests are each written whole, tagged with a
+// request id. Config must not be modified once the client is created
 type Client struct {
 	// HTTP client used to communicate with IAM API
 	iamClient *iam.Client
 
+	// httpClient is used instead of the IAM HTTP client when transport tuning is configured
+	httpClient *http.Client
+
 	config *Config
 
 	fhirStoreURL *url.URL
 
+	// cache holds the last read of resources when Config.ReadCacheSize is set
+	cache *readCache
+
 	// User agent used when communicating with the HSDP CDR API
 	UserAgent string
 
@@ -59,12 +139,14 @@ type Client struct {
 }
 
 // NewClient returns a new HSDP CDR API client. Configured console and IAM clients
-// must be provided as the underlying API requires tokens from respective services
+// must be provided as the underlying API requires tokens from respective services.
+// Without an IAM client every request must set a token using WithBearerToken
 func NewClient(iamClient *iam.Client, config *Config) (*Client, error) {
 	return newClient(iamClient, config)
 }
 
 func newClient(iamClient *iam.Client, config *Config) (*Client, error) {
+	doAutoconf(config)
 	c := &Client{iamClient: iamClient, config: config, UserAgent: userAgent}
 	fhirStore := config.FHIRStore
 	if fhirStore == "" {
@@ -73,31 +155,144 @@ func newClient(iamClient *iam.Client, config *Config) (*Client, error) {
 	if err := c.SetFHIRStoreURL(fhirStore); err != nil {
 		return nil, err
 	}
-	maSTU3, err := jsonformat.NewMarshaller(false, "", "", fhirversion.STU3)
+	rootOrgID, err := validateRootOrgID(config.RootOrgID)
 	if err != nil {
-		return nil, fmt.Errorf("cdr.NewClient create FHIR STU3 marshaller: %w", err)
+		return nil, fmt.Errorf("cdr.NewClient: %w", err)
 	}
-	umSTU3, err := jsonformat.NewUnmarshaller(config.TimeZone, fhirversion.STU3)
+	config.RootOrgID = rootOrgID
+	timeZone, err := validateTimeZone(config.TimeZone)
 	if err != nil {
-		return nil, fmt.Errorf("cdr.NewClient create FHIR STU3 unmarshaller (timezone=[%s]): %w", config.TimeZone, err)
+		return nil, fmt.Errorf("cdr.NewClient: %w", err)
+	}
+	switch config.PathEncoding {
+	case "", PathEncodingOpaque, PathEncodingEscaped:
+	default:
+		return nil, fmt.Errorf("cdr.NewClient: %w: PathEncoding [%s]", ErrInvalidParameter, config.PathEncoding)
+	}
+	if config.FailOnSeverity != "" && severityRank(config.FailOnSeverity) == 0 {
+		return nil, fmt.Errorf("cdr.NewClient: %w: FailOnSeverity [%s]", ErrInvalidParameter, config.FailOnSeverity)
 	}
-	maR4, err := jsonformat.NewMarshaller(false, "", "", fhirversion.R4)
+	maSTU3, err := c.newMarshaller(fhirversion.STU3)
 	if err != nil {
 		return nil, fmt.Errorf("cdr.NewClient create FHIR STU3 marshaller: %w", err)
 	}
-	umR4, err := jsonformat.NewUnmarshaller(config.TimeZone, fhirversion.R4)
+	umSTU3, err := c.newUnmarshaller(timeZone, fhirversion.STU3)
+	if err != nil {
+		return nil, fmt.Errorf("cdr.NewClient create FHIR STU3 unmarshaller (timezone=[%s]): %w", timeZone, err)
+	}
+	maR4, err := c.newMarshaller(fhirversion.R4)
 	if err != nil {
-		return nil, fmt.Errorf("cdr.NewClient create FHIR STU3 unmarshaller (timezone=[%s]): %w", config.TimeZone, err)
+		return nil, fmt.Errorf("cdr.NewClient create FHIR R4 marshaller: %w", err)
+	}
+	umR4, err := c.newUnmarshaller(timeZone, fhirversion.R4)
+	if err != nil {
+		return nil, fmt.Errorf("cdr.NewClient create FHIR R4 unmarshaller (timezone=[%s]): %w", timeZone, err)
+	}
+
+	if config.MaxIdleConnsPerHost > 0 || config.SkipVerify {
+		tr := &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			MaxIdleConnsPerHost: config.MaxIdleConnsPerHost,
+		}
+		if config.SkipVerify {
+			_, _ = fmt.Fprintln(os.Stderr, "WARNING: cdr client created with SkipVerify, TLS certificates are NOT verified. Do not use this in production")
+			tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		}
+		c.httpClient = &http.Client{Transport: tr}
+	}
+	if c.httpClient == nil && iamClient == nil {
+		c.httpClient = &http.Client{
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment},
+		}
+	}
+	if config.DebugLog != nil {
+		if c.httpClient == nil && iamClient != nil {
+			httpClient := *iamClient.HttpClient()
+			c.httpClient = &httpClient
+		}
+		if c.httpClient != nil {
+			logger := internal.NewLoggingRoundTripper(c.httpClient.Transport, config.DebugLog)
+			logger.IndentJSON = config.DebugIndent
+			c.httpClient.Transport = logger
+		}
 	}
 
-	c.TenantSTU3 = &TenantSTU3Service{timeZone: config.TimeZone, client: c, ma: maSTU3, um: umSTU3}
-	c.OperationsSTU3 = &OperationsSTU3Service{timeZone: config.TimeZone, client: c, ma: maSTU3, um: umSTU3}
-	c.TenantR4 = &TenantR4Service{timeZone: config.TimeZone, client: c, ma: maR4, um: umR4}
-	c.OperationsR4 = &OperationsR4Service{timeZone: config.TimeZone, client: c, ma: maR4, um: umR4}
+	if config.ReadCacheSize > 0 {
+		c.cache = newReadCache(config.ReadCacheSize, config.ReadCacheTTL)
+	}
+
+	c.TenantSTU3 = &TenantSTU3Service{timeZone: timeZone, client: c, ma: maSTU3, um: umSTU3}
+	c.OperationsSTU3 = &OperationsSTU3Service{timeZone: timeZone, client: c, ma: maSTU3, um: umSTU3}
+	c.TenantR4 = &TenantR4Service{timeZone: timeZone, client: c, ma: maR4, um: umR4}
+	c.OperationsR4 = &OperationsR4Service{timeZone: timeZone, client: c, ma: maR4, um: umR4}
 
 	return c, nil
 }
 
+// newMarshaller returns a FHIR marshaller for ver, see Config.NewMarshaller
+func (c *Client) newMarshaller(ver fhirversion.Version) (*jsonformat.Marshaller, error) {
+	if c.config.NewMarshaller != nil {
+		return c.config.NewMarshaller(ver)
+	}
+	return jsonformat.NewMarshaller(false, "", "", ver)
+}
+
+// newUnmarshaller returns a FHIR unmarshaller for ver, see Config.NewUnmarshaller
+func (c *Client) newUnmarshaller(timeZone string, ver fhirversion.Version) (*jsonformat.Unmarshaller, error) {
+	if c.config.NewUnmarshaller != nil {
+		return c.config.NewUnmarshaller(timeZone, ver)
+	}
+	return jsonformat.NewUnmarshaller(timeZone, ver)
+}
+
+// doAutoconf derives CDRURL from Region and Environment unless CDRURL or FHIRStore is set
+func doAutoconf(config *Config) {
+	if config.Region == "" || config.Environment == "" || config.CDRURL != "" || config.FHIRStore != "" {
+		return
+	}
+	c, err := autoconf.New(
+		autoconf.WithRegion(config.Region),
+		autoconf.WithEnv(config.Environment))
+	if err != nil {
+		return
+	}
+	for _, service := range []string{"cdr", "cdr-stu3"} {
+		if cdrService := c.Service(service); cdrService.URL != "" {
+			config.CDRURL = strings.TrimSuffix(cdrService.URL, "/") + "/store/fhir"
+			return
+		}
+	}
+}
+
+// rootOrgIDFormat is the format of a FHIR id, the RootOrgID is the id of an Organization
+var rootOrgIDFormat = regexp.MustCompile(`^[A-Za-z0-9\-.]{1,64}$`)
+
+// validateRootOrgID returns rootOrgID without surrounding whitespace and slashes. Anything
+// else which is not part of a FHIR id, e.g. a slash in the middle, would end up in the
+// path of every request and is rejected with an error wrapping ErrInvalidRootOrgID
+func validateRootOrgID(rootOrgID string) (string, error) {
+	normalized := strings.Trim(strings.TrimSpace(rootOrgID), "/")
+	if rootOrgID == "" {
+		return "", nil
+	}
+	if !rootOrgIDFormat.MatchString(normalized) {
+		return "", fmt.Errorf("%w: [%s]", ErrInvalidRootOrgID, rootOrgID)
+	}
+	return normalized, nil
+}
+
+// validateTimeZone checks that timeZone is a loadable IANA zone name. An empty
+// timeZone defaults to UTC
+func validateTimeZone(timeZone string) (string, error) {
+	if timeZone == "" {
+		return "UTC", nil
+	}
+	if _, err := time.LoadLocation(timeZone); err != nil {
+		return "", fmt.Errorf("%w: [%s]", ErrInvalidTimeZone, timeZone)
+	}
+	return timeZone, nil
+}
+
 // Close releases allocated resources of clients
 func (c *Client) Close() {
 }
@@ -162,7 +357,8 @@ func (c *Client) SetEndpointURL(urlStr string) error {
 // request body.
 func (c *Client) newCDRRequest(method, path string, bodyBytes []byte, options []OptionFunc) (*http.Request, error) {
 	u := *c.fhirStoreURL
-	// Set the encoded opaque data
+	// Set the encoded opaque data. Options adjust the opaque path, it is turned into an
+	// escaped path afterwards when Config.PathEncoding asks for it
 	u.Opaque = c.fhirStoreURL.Path + c.config.RootOrgID + "/" + path
 
 	req := &http.Request{
@@ -179,17 +375,13 @@ func (c *Client) newCDRRequest(method, path string, bodyBytes []byte, options []
 		bodyReader := bytes.NewReader(bodyBytes)
 		req.Body = io.NopCloser(bodyReader)
 		req.ContentLength = int64(bodyReader.Len())
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(bodyBytes)), nil
+		}
 	}
-	token, err := c.iamClient.Token()
-	if err != nil {
+	if err := c.setRequestHeaders(req); err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("API-Version", APIVersion)
-
-	if c.UserAgent != "" {
-		req.Header.Set("User-Agent", c.UserAgent)
-	}
 	for _, fn := range options {
 		if fn == nil {
 			continue
@@ -199,13 +391,169 @@ func (c *Client) newCDRRequest(method, path string, bodyBytes []byte, options []
 			return nil, err
 		}
 	}
+	if c.config.PathEncoding == PathEncodingEscaped {
+		if err := escapePath(req.URL); err != nil {
+			return nil, err
+		}
+	}
+	if req.Header.Get("Authorization") == "" {
+		return nil, ErrMissingToken
+	}
 	return req, nil
 }
 
+// escapePath moves the opaque path of u to Path and RawPath. RawPath keeps the escaping of
+// the opaque path when it is a valid one, else Path is escaped when the URL is sent
+func escapePath(u *url.URL) error {
+	if u.Opaque == "" {
+		return nil
+	}
+	path, err := url.PathUnescape(u.Opaque)
+	if err != nil {
+		return fmt.Errorf("%w: path [%s]: %v", ErrInvalidParameter, u.Opaque, err)
+	}
+	u.Path = path
+	u.RawPath = u.Opaque
+	u.Opaque = ""
+	return nil
+}
+
+// newCDRStreamRequest creates a CDR request like newCDRRequest which streams body instead
+// of holding it in memory. length is the size of body in bytes, -1 when it is not known.
+// The request has no GetBody so it will not be replayed by reauthorize
+func (c *Client) newCDRStreamRequest(method, path string, body io.Reader, length int64, options []OptionFunc) (*http.Request, error) {
+	return c.newCDRRequest(method, path, nil, append([]OptionFunc{
+		func(req *http.Request) error {
+			req.Body = io.NopCloser(body)
+			req.ContentLength = length
+			return nil
+		},
+	}, options...))
+}
+
+// reauthorize refreshes the IAM token after a 401 Unauthorized and returns a copy of
+// req with the new token. It returns nil when the token cannot be refreshed, the
+// request body cannot be replayed or req carries its own token, see WithBearerToken
+func (c *Client) reauthorize(req *http.Request) *http.Request {
+	if c.iamClient == nil || (req.Body != nil && req.GetBody == nil) || c.bearerOverride(req) {
+		return nil
+	}
+	if err := c.iamClient.TokenRefresh(); err != nil {
+		return nil
+	}
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil
+		}
+		retry.Body = body
+	}
+	if err := c.setRequestHeaders(retry); err != nil {
+		return nil
+	}
+	return retry
+}
+
+// bearerOverride reports whether req is authorized with another token than the one of the
+// IAM client, e.g. with WithBearerToken. Such requests are not reauthorized, the IAM token
+// would change the identity they are sent as
+func (c *Client) bearerOverride(req *http.Request) bool {
+	authorization := req.Header.Get("Authorization")
+	if authorization == "" {
+		return false
+	}
+	if c.iamClient == nil {
+		return true
+	}
+	token, err := c.iamClient.Token()
+	return err != nil || authorization != "Bearer "+token
+}
+
+// setRequestHeaders sets the authorization and common headers of a CDR request
+func (c *Client) setRequestHeaders(req *http.Request) error {
+	if c.iamClient != nil {
+		token, err := c.iamClient.Token()
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("API-Version", APIVersion)
+
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	if c.config.AcceptLanguage != "" && req.Header.Get("Accept-Language") == "" {
+		req.Header.Set("Accept-Language", c.config.AcceptLanguage)
+	}
+	return nil
+}
+
+// setDefaultAccept sets the Accept header of req unless an option already set one
+func setDefaultAccept(req *http.Request, mediaType string) {
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", mediaType)
+	}
+}
+
+// FHIRVersion returns the configured Config.FHIRVersion. It is empty when not configured
+func (c *Client) FHIRVersion() fhirversion.Version {
+	return c.config.FHIRVersion
+}
+
+// DetectFHIRVersion reads the fhirVersion of the CapabilityStatement of the store.
+// An error wrapping ErrUnknownFHIRVersion is returned for versions other than STU3 and R4
+func (c *Client) DetectFHIRVersion(options ...OptionFunc) (fhirversion.Version, *Response, error) {
+	req, err := c.newCDRRequest(http.MethodGet, "metadata", nil, append([]OptionFunc{c.WithoutRootOrgID()}, options...))
+	if err != nil {
+		return "", nil, err
+	}
+	setDefaultAccept(req, "application/fhir+json")
+	var capabilities struct {
+		FHIRVersion string `json:"fhirVersion"`
+	}
+	resp, err := c.do(req, &capabilities)
+	if err != nil || resp == nil {
+		if resp == nil && err != nil {
+			err = fmt.Errorf("cdr.DetectFHIRVersion: %w", ErrEmptyResult)
+		}
+		return "", resp, err
+	}
+	switch {
+	case strings.HasPrefix(capabilities.FHIRVersion, "3.0."):
+		return fhirversion.STU3, resp, nil
+	case strings.HasPrefix(capabilities.FHIRVersion, "4.0."):
+		return fhirversion.R4, resp, nil
+	}
+	return "", resp, fmt.Errorf("cdr.DetectFHIRVersion: %w: [%s]", ErrUnknownFHIRVersion, capabilities.FHIRVersion)
+}
+
+// WithoutRootOrgID returns an option which addresses the request at the FHIR store
+// root instead of below the configured RootOrgID. Use this for store level endpoints
+// like metadata or $export
+func (c *Client) WithoutRootOrgID() OptionFunc {
+	return func(req *http.Request) error {
+		prefix := c.fhirStoreURL.Path + c.config.RootOrgID + "/"
+		if !strings.HasPrefix(req.URL.Opaque, prefix) {
+			return nil
+		}
+		req.URL.Opaque = c.fhirStoreURL.Path + strings.TrimPrefix(req.URL.Opaque, prefix)
+		return nil
+	}
+}
+
 // Response is a HSDP IAM API response. This wraps the standard http.Response
 // returned from HSDP IAM and provides convenient access to things like errors
 type Response struct {
 	*http.Response
+	// Duration is the wall-clock time of the request including reading the response body
+	Duration time.Duration
+	// FromCache is true when the server answered 304 Not Modified and the body
+	// is the one of the read cache, see Config.ReadCacheSize
+	FromCache bool
+	// received is the local time the response headers arrived
+	received time.Time
 }
 
 func (r *Response) StatusCode() int {
@@ -215,6 +563,90 @@ func (r *Response) StatusCode() int {
 	return 0
 }
 
+// Created reports whether the request created a new resource (201 Created). It is
+// false when the server returned an existing resource instead, e.g. 200 OK for a
+// conditional create that matched or a store which deduplicates creates
+func (r *Response) Created() bool {
+	return r != nil && r.Response != nil && r.Response.StatusCode == http.StatusCreated
+}
+
+// RateLimitRemaining returns the value of the X-RateLimit-Remaining header and
+// whether it was present in the response
+func (r *Response) RateLimitRemaining() (int64, bool) {
+	return r.headerInt("X-RateLimit-Remaining")
+}
+
+// RateLimitReset returns the value of the X-RateLimit-Reset header and
+// whether it was present in the response
+func (r *Response) RateLimitReset() (int64, bool) {
+	return r.headerInt("X-RateLimit-Reset")
+}
+
+// ServerTime returns the Date header of the response, the time on the server when
+// it responded, and whether it was present
+func (r *Response) ServerTime() (time.Time, bool) {
+	if r == nil || r.Response == nil {
+		return time.Time{}, false
+	}
+	serverTime, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return serverTime, true
+}
+
+// ClockSkew returns how far the clock of the server is ahead of the local clock, negative
+// when it is behind, and whether the response had a Date header. Date has a resolution of
+// one second so use a margin of at least that when adjusting e.g. _lastUpdated windows
+func (r *Response) ClockSkew() (time.Duration, bool) {
+	serverTime, ok := r.ServerTime()
+	if !ok || r.received.IsZero() {
+		return 0, false
+	}
+	return serverTime.Sub(r.received), true
+}
+
+func (r *Response) headerInt(key string) (int64, bool) {
+	if r == nil || r.Response == nil {
+		return 0, false
+	}
+	value, err := strconv.ParseInt(r.Header.Get(key), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
+
+// CheckResponse is the default check of Config.CheckResponse. Responses with a 2xx status
+// the CDR uses, or 304 Not Modified, are successful. Otherwise the error holds the status
+// and the body, which is restored so it can be read again. Custom checks can delegate to it
+func CheckResponse(resp *http.Response) error {
+	return internal.CheckResponse(resp)
+}
+
+// maxBytesReader reads up to remaining bytes and fails with ErrResponseTooLarge
+// once the wrapped reader has more
+type maxBytesReader struct {
+	io.Reader
+	remaining int64
+}
+
+func (m *maxBytesReader) Read(p []byte) (int, error) {
+	if m.remaining <= 0 {
+		var probe [1]byte
+		if n, err := m.Reader.Read(probe[:]); n == 0 {
+			return 0, err
+		}
+		return 0, ErrResponseTooLarge
+	}
+	if int64(len(p)) > m.remaining {
+		p = p[:m.remaining]
+	}
+	n, err := m.Reader.Read(p)
+	m.remaining -= int64(n)
+	return n, err
+}
+
 // newResponse creates a new Response for the provided http.Response.
 func newResponse(r *http.Response) *Response {
 	response := &Response{Response: r}
@@ -229,36 +661,125 @@ func (c *Client) TokenRefresh() error {
 	return c.iamClient.TokenRefresh()
 }
 
-func (c *Client) do(req *http.Request, v interface{}) (*Response, error) {
+func (c *Client) do(req *http.Request, v interface{}) (_ *Response, err error) {
 	if req.Header.Get("Accept") == "" {
 		return nil, ErrMissingAcceptHeader
 	}
+	req, span := c.startSpan(req)
+	var key string
+	var cached *readCacheEntry
+	if c.cache != nil {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			if written := writeKey(req); written != "" {
+				c.cache.remove(written)
+			} else {
+				c.cache.clear()
+			}
+		} else if key = cacheKey(req); key != "" {
+			if cached = c.cache.get(key); cached != nil {
+				req.Header.Set("If-None-Match", cached.etag)
+			}
+		}
+	}
 
-	resp, err := c.iamClient.HttpClient().Do(req)
-	if resp != nil {
-		defer func() {
+	httpClient := c.httpClient
+	if httpClient == nil {
+		httpClient = c.iamClient.HttpClient()
+	}
+	start := time.Now()
+	resp, err := httpClient.Do(req)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		if retry := c.reauthorize(req); retry != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
 			_ = resp.Body.Close()
-		}() // Only close if we plan to read it
+			req = retry
+			resp, err = httpClient.Do(req)
+		}
 	}
 	if err != nil {
+		c.logRequest(req, resp, time.Since(start), 0, err)
+		endSpan(span, resp, 0, err)
 		return nil, err
 	}
-
+	fromCache := cached != nil && resp.StatusCode == http.StatusNotModified
+	if fromCache {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		resp.StatusCode = http.StatusOK
+		resp.Status = "200 OK"
+		date := resp.Header.Get("Date")
+		resp.Header = cached.header.Clone()
+		if date != "" {
+			resp.Header.Set("Date", date)
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(cached.body))
+		resp.ContentLength = int64(len(cached.body))
+		c.cache.touch(key)
+	}
 	response := newResponse(resp)
+	response.FromCache = fromCache
+	response.received = time.Now()
+	body := &countingReadCloser{ReadCloser: resp.Body}
+	resp.Body = body
+	tooLarge := false
+	defer func() {
+		// Drain unread bytes so the connection can be reused. CheckResponse
+		// may have replaced resp.Body so the original body is used here.
+		// A response which is too large is not worth draining
+		if !tooLarge {
+			_, _ = io.Copy(io.Discard, body)
+		}
+		_ = body.Close()
+		response.Duration = time.Since(start)
+		logErr := err
+		if logErr == io.EOF { // An empty body is not a failure
+			logErr = nil
+		}
+		c.logRequest(req, resp, response.Duration, body.count, logErr)
+		endSpan(span, resp, body.count, logErr)
+	}()
 
-	err = internal.CheckResponse(resp)
+	checkResponse := c.config.CheckResponse
+	if checkResponse == nil {
+		checkResponse = CheckResponse
+	}
+	err = checkResponse(resp)
 	if err != nil {
 		// even though there was an error, we still return the response
 		// in case the caller wants to inspect it further
-		return response, err
+		return response, operationOutcomeError(resp, err)
 	}
 
-	if v != nil {
-
+	// Responses without a body, like 204 No Content, leave v untouched
+	if v != nil && resp.StatusCode != http.StatusNoContent && resp.ContentLength != 0 {
+		var reader io.Reader = resp.Body
+		limit := c.config.MaxResponseSize
+		if limit > 0 {
+			if resp.ContentLength > limit {
+				tooLarge = true
+				return response, fmt.Errorf("%w: %d bytes exceeds the limit of %d bytes", ErrResponseTooLarge, resp.ContentLength, limit)
+			}
+			reader = &maxBytesReader{Reader: resp.Body, remaining: limit}
+		}
+		var captured *bytes.Buffer
+		if key != "" && !fromCache && resp.StatusCode == http.StatusOK && resp.Header.Get("ETag") != "" {
+			captured = &bytes.Buffer{}
+			reader = io.TeeReader(reader, captured)
+		}
 		if w, ok := v.(io.Writer); ok {
-			_, err = io.Copy(w, resp.Body)
+			_, err = io.Copy(w, reader)
 		} else {
-			err = json.NewDecoder(resp.Body).Decode(v)
+			err = json.NewDecoder(reader).Decode(v)
+		}
+		if errors.Is(err, ErrResponseTooLarge) {
+			tooLarge = true
+			err = fmt.Errorf("%w: more than the limit of %d bytes", ErrResponseTooLarge, limit)
+		}
+		if captured != nil && err == nil {
+			// The JSON decoder may stop before the end of the body
+			if _, err = io.Copy(io.Discard, reader); err == nil {
+				c.cache.put(key, resp.Header.Get("ETag"), resp.Header, captured.Bytes())
+			}
 		}
 	}
 
@@ -0,0 +1,93 @@
+package cdr
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoEmptyBody(t *testing.T) {
+	var status int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json")
+		if status == http.StatusOK {
+			w.Header().Set("Content-Length", "0")
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	c := &Client{httpClient: server.Client(), config: &Config{}}
+	for _, status = range []int{http.StatusNoContent, http.StatusOK} {
+		req, err := http.NewRequest(http.MethodDelete, server.URL, nil)
+		if !assert.Nil(t, err) {
+			return
+		}
+		req.Header.Set("Accept", "application/fhir+json")
+		var v struct {
+			ResourceType string `json:"resourceType"`
+		}
+		resp, err := c.do(req, &v)
+		assert.Nil(t, err, status)
+		if assert.NotNil(t, resp) {
+			assert.Equal(t, status, resp.StatusCode())
+		}
+	}
+}
+
+func TestDoMaxResponseSize(t *testing.T) {
+	body := `{"resourceType": "Patient", "id": "123"}`
+	chunked := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, body)
+		if chunked {
+			w.(http.Flusher).Flush()
+			_, _ = io.WriteString(w, strings.Repeat(" ", 100))
+		}
+	}))
+	defer server.Close()
+
+	for _, limit := range []int64{int64(len(body)), 20} {
+		for _, chunked = range []bool{false, true} {
+			c := &Client{httpClient: server.Client(), config: &Config{MaxResponseSize: limit}}
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			if !assert.Nil(t, err) {
+				return
+			}
+			req.Header.Set("Accept", "application/fhir+json")
+			var buf bytes.Buffer
+			_, err = c.do(req, &buf)
+			if limit == int64(len(body)) && !chunked {
+				assert.Nil(t, err)
+				assert.Equal(t, body, buf.String())
+				continue
+			}
+			assert.True(t, errors.Is(err, ErrResponseTooLarge), "limit %d chunked %v", limit, chunked)
+		}
+	}
+}
+
+func TestReadCacheTTL(t *testing.T) {
+	now := time.Now()
+	cache := newReadCache(2, time.Minute)
+	cache.now = func() time.Time { return now }
+	cache.put("a", `W/"1"`, http.Header{}, []byte("a"))
+	if !assert.NotNil(t, cache.get("a")) {
+		return
+	}
+	now = now.Add(50 * time.Second)
+	cache.touch("a")
+	now = now.Add(50 * time.Second)
+	assert.NotNil(t, cache.get("a"))
+	now = now.Add(2 * time.Minute)
+	assert.Nil(t, cache.get("a"))
+}
@@ -1,16 +1,23 @@
 package cdr_test
 
 import (
+	"bytes"
+	"errors"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/google/fhir/go/fhirversion"
 	"github.com/google/fhir/go/jsonformat"
 
 	"github.com/philips-software/go-hsdp-api/cdr"
+	"github.com/philips-software/go-hsdp-api/cdr/helper/fhir/r4"
 
 	"github.com/philips-software/go-hsdp-api/iam"
 	"github.com/stretchr/testify/assert"
@@ -230,3 +237,951 @@ func TestEndpoints(t *testing.T) {
 	assert.Equal(t, serverCDR.URL+"/store/fhir/"+rootOrgID, cdrClient.GetEndpointURL())
 
 }
+
+func TestAutoconf(t *testing.T) {
+	teardown := setup(t, fhirversion.STU3)
+	defer teardown()
+
+	autoClient, err := cdr.NewClient(iamClient, &cdr.Config{
+		Region:      "us-east",
+		Environment: "sandbox",
+		RootOrgID:   cdrOrgID,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "https://cdr-stu3-sandbox.us-east.philips-healthsuite.com/store/fhir/", autoClient.GetFHIRStoreURL())
+
+	explicitClient, err := cdr.NewClient(iamClient, &cdr.Config{
+		Region:      "us-east",
+		Environment: "sandbox",
+		CDRURL:      serverCDR.URL + "/store/fhir",
+		RootOrgID:   cdrOrgID,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, serverCDR.URL+"/store/fhir/", explicitClient.GetFHIRStoreURL())
+
+	_, err = cdr.NewClient(iamClient, &cdr.Config{
+		Region:      "us-east",
+		Environment: "bogus",
+		RootOrgID:   cdrOrgID,
+	})
+	assert.True(t, errors.Is(err, cdr.ErrCDRURLCannotBeEmpty))
+}
+
+func TestInvalidTimeZone(t *testing.T) {
+	teardown := setup(t, fhirversion.STU3)
+	defer teardown()
+
+	_, err := cdr.NewClient(iamClient, &cdr.Config{
+		CDRURL:    serverCDR.URL + "/store/fhir",
+		RootOrgID: cdrOrgID,
+		TimeZone:  "Europe/Amsterdamm",
+	})
+	if !assert.NotNil(t, err) {
+		return
+	}
+	assert.True(t, errors.Is(err, cdr.ErrInvalidTimeZone))
+	assert.Contains(t, err.Error(), "Europe/Amsterdamm")
+
+	client, err := cdr.NewClient(iamClient, &cdr.Config{
+		CDRURL:    serverCDR.URL + "/store/fhir",
+		RootOrgID: cdrOrgID,
+	})
+	assert.Nil(t, err)
+	assert.NotNil(t, client)
+}
+
+func TestWithoutRootOrgID(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	muxCDR.HandleFunc("/store/fhir/metadata", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "CapabilityStatement",
+  "status": "active",
+  "date": "2021-01-01",
+  "kind": "instance",
+  "fhirVersion": "4.0.1",
+  "format": ["json"]
+}`)
+	})
+	capabilities, resp, err := cdrClient.OperationsR4.Get("metadata", cdrClient.WithoutRootOrgID())
+	if !assert.Nil(t, err) {
+		return
+	}
+	if !assert.NotNil(t, resp) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.NotNil(t, capabilities.GetCapabilityStatement())
+}
+
+func TestConnectionReuse(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	var newConnections int32
+	mux := http.NewServeMux()
+	server := httptest.NewUnstartedServer(mux)
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&newConnections, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	mux.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"resourceType": "OperationOutcome", "issue": []}`)
+	})
+
+	client, err := cdr.NewClient(iamClient, &cdr.Config{
+		CDRURL:              server.URL + "/store/fhir",
+		RootOrgID:           cdrOrgID,
+		MaxIdleConnsPerHost: 4,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	org, err := r4.NewOrganization(timeZone, orgID, "Hospital")
+	if !assert.Nil(t, err) {
+		return
+	}
+	for i := 0; i < 5; i++ {
+		ok, _, err := client.TenantR4.Offboard(org)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&newConnections))
+}
+
+func TestSkipVerify(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	mux := http.NewServeMux()
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	mux.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"resourceType": "OperationOutcome", "issue": []}`)
+	})
+	org, err := r4.NewOrganization(timeZone, orgID, "Hospital")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	verifying, err := cdr.NewClient(iamClient, &cdr.Config{
+		CDRURL:              server.URL + "/store/fhir",
+		RootOrgID:           cdrOrgID,
+		MaxIdleConnsPerHost: 1,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, _, err = verifying.TenantR4.Offboard(org)
+	assert.NotNil(t, err)
+
+	client, err := cdr.NewClient(iamClient, &cdr.Config{
+		CDRURL:     server.URL + "/store/fhir",
+		RootOrgID:  cdrOrgID,
+		SkipVerify: true,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	ok, _, err := client.TenantR4.Offboard(org)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
+
+type recordingLogger struct {
+	entries []cdr.RequestLog
+}
+
+func (r *recordingLogger) LogRequest(entry cdr.RequestLog) {
+	r.entries = append(r.entries, entry)
+}
+
+func TestRequestLogger(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	body := `{"resourceType": "Organization", "id": "` + orgID + `", "name": "Hospital"}`
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, body)
+	})
+
+	logger := &recordingLogger{}
+	client, err := cdr.NewClient(iamClient, &cdr.Config{
+		CDRURL:    serverCDR.URL + "/store/fhir",
+		RootOrgID: cdrOrgID,
+		Logger:    logger,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, resp, err := client.OperationsR4.Put("Organization/"+orgID, []byte(body))
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, _, err = client.OperationsR4.Delete("Organization/" + orgID)
+	assert.NotNil(t, err)
+
+	if !assert.Len(t, logger.entries, 2) {
+		return
+	}
+	put := logger.entries[0]
+	assert.Equal(t, http.MethodPut, put.Method)
+	assert.Equal(t, serverCDR.URL+"/store/fhir/"+cdrOrgID+"/Organization/"+orgID, put.URL)
+	assert.Equal(t, http.StatusOK, put.StatusCode)
+	assert.Equal(t, int64(len(body)), put.RequestBytes)
+	assert.Equal(t, int64(len(body)), put.ResponseBytes)
+	assert.Greater(t, put.Duration.Nanoseconds(), int64(0))
+	assert.Equal(t, put.Duration, resp.Duration)
+	assert.Nil(t, put.Err)
+	assert.Equal(t, http.StatusNotFound, logger.entries[1].StatusCode)
+	assert.NotNil(t, logger.entries[1].Err)
+
+	limited, err := cdr.NewClient(iamClient, &cdr.Config{
+		CDRURL:          serverCDR.URL + "/store/fhir",
+		RootOrgID:       cdrOrgID,
+		Logger:          logger,
+		MaxResponseSize: 10,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, _, err = limited.OperationsR4.Get("Organization/" + orgID)
+	assert.True(t, errors.Is(err, cdr.ErrResponseTooLarge))
+	if assert.Len(t, logger.entries, 3) {
+		assert.Equal(t, http.StatusOK, logger.entries[2].StatusCode)
+		assert.True(t, errors.Is(logger.entries[2].Err, cdr.ErrResponseTooLarge))
+	}
+}
+
+func TestUnauthorizedRetry(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	body := `{"resourceType": "Organization", "id": "` + orgID + `", "name": "Hospital"}`
+	var bodies []string
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		received, err := io.ReadAll(r.Body)
+		if !assert.Nil(t, err) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		bodies = append(bodies, string(received))
+		assert.Equal(t, "Bearer 44d20214-7879-4e35-923d-f9d4e01c9746", r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		if len(bodies) == 1 { // Token expired between creating and sending the request
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(received)
+	})
+
+	updated, resp, err := cdrClient.OperationsR4.Put("Organization/"+orgID, []byte(body))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, "Hospital", updated.GetOrganization().GetName().GetValue())
+	assert.Equal(t, []string{body, body}, bodies)
+}
+
+func TestUnauthorizedWithBearerTokenNotRetried(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	var authorizations []string
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+
+	_, resp, err := cdrClient.OperationsR4.Get("Organization/"+orgID, cdr.WithBearerToken("pinned"))
+	assert.NotNil(t, err)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode())
+	}
+	assert.Equal(t, []string{"Bearer pinned"}, authorizations)
+}
+
+func TestDebugIndent(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	body := `{"resourceType":"Organization","id":"` + orgID + `","name":"Hospital"}`
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		received, err := io.ReadAll(r.Body)
+		if !assert.Nil(t, err) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		assert.Equal(t, body, string(received))
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(received)
+	})
+
+	var debugLog bytes.Buffer
+	client, err := cdr.NewClient(iamClient, &cdr.Config{
+		CDRURL:      serverCDR.URL + "/store/fhir",
+		RootOrgID:   cdrOrgID,
+		DebugLog:    &debugLog,
+		DebugIndent: true,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, _, err = client.OperationsR4.Put("Organization/"+orgID, []byte(body))
+	if !assert.Nil(t, err) {
+		return
+	}
+	dump := debugLog.String()
+	assert.Equal(t, 2, strings.Count(dump, "{\n  \"resourceType\": \"Organization\",\n"))
+	assert.Contains(t, dump, "Authorization: [sensitive]")
+}
+
+func TestCorrelationID(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	correlationID := "5c1e2a8e-6d2f-4f0e-9a51-3f4f2b7c9d10"
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, correlationID, r.Header.Get(cdr.CorrelationIDHeader))
+		assert.Equal(t, traceparent, r.Header.Get("Traceparent"))
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"resourceType": "Organization", "id": "`+orgID+`", "name": "Hospital"}`)
+	})
+
+	logger := &recordingLogger{}
+	var debugLog bytes.Buffer
+	client, err := cdr.NewClient(iamClient, &cdr.Config{
+		CDRURL:    serverCDR.URL + "/store/fhir",
+		RootOrgID: cdrOrgID,
+		Logger:    logger,
+		DebugLog:  &debugLog,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, _, err = client.OperationsR4.Get("Organization/"+orgID,
+		cdr.WithCorrelationID(correlationID),
+		cdr.WithHeader("Traceparent", traceparent))
+	if !assert.Nil(t, err) {
+		return
+	}
+	if !assert.Len(t, logger.entries, 1) {
+		return
+	}
+	assert.Equal(t, correlationID, logger.entries[0].CorrelationID)
+	assert.Contains(t, debugLog.String(), cdr.CorrelationIDHeader+": "+correlationID)
+}
+
+func TestAcceptLanguage(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	var acceptLanguage string
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		acceptLanguage = r.Header.Get("Accept-Language")
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"resourceType": "Organization", "id": "`+orgID+`", "name": "Hospital"}`)
+	})
+
+	client, err := cdr.NewClient(iamClient, &cdr.Config{
+		CDRURL:         serverCDR.URL + "/store/fhir",
+		RootOrgID:      cdrOrgID,
+		AcceptLanguage: "nl-NL",
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, _, err = client.OperationsR4.Get("Organization/" + orgID)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "nl-NL", acceptLanguage)
+
+	_, _, err = client.OperationsR4.Get("Organization/"+orgID, cdr.WithAcceptLanguage("de-DE"))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "de-DE", acceptLanguage)
+
+	_, _, err = cdrClient.OperationsR4.Get("Organization/" + orgID)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Empty(t, acceptLanguage)
+}
+
+func TestWithBearerToken(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	var authorization string
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"resourceType": "Organization", "id": "`+orgID+`", "name": "Hospital"}`)
+	})
+
+	_, _, err := cdrClient.OperationsR4.Get("Organization/"+orgID, cdr.WithBearerToken("pinned"))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "Bearer pinned", authorization)
+
+	client, err := cdr.NewClient(nil, &cdr.Config{
+		CDRURL:    serverCDR.URL + "/store/fhir",
+		RootOrgID: cdrOrgID,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, _, err = client.OperationsR4.Get("Organization/" + orgID)
+	assert.ErrorIs(t, err, cdr.ErrMissingToken)
+
+	_, _, err = client.OperationsR4.Get("Organization/"+orgID, cdr.WithBearerToken("pinned"))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "Bearer pinned", authorization)
+}
+
+func TestWithProvenance(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	var provenance string
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	body := `{"resourceType": "Organization", "id": "` + orgID + `", "name": "Hospital"}`
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		provenance = r.Header.Get(cdr.ProvenanceHeader)
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, body)
+	})
+
+	_, _, err := cdrClient.OperationsR4.Put("Organization/"+orgID, []byte(body), cdr.WithProvenance([]byte(`{
+  "resourceType": "Provenance",
+  "recorded": "2024-01-01T00:00:00Z",
+  "agent": [{"who": {"reference": "Device/importer"}}]
+}`)))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, `{"resourceType":"Provenance","recorded":"2024-01-01T00:00:00Z","agent":[{"who":{"reference":"Device/importer"}}]}`, provenance)
+
+	_, _, err = cdrClient.OperationsR4.Put("Organization/"+orgID, []byte(body), cdr.WithProvenance([]byte(body)))
+	assert.ErrorIs(t, err, cdr.ErrInvalidParameter)
+	_, _, err = cdrClient.OperationsR4.Get("Organization/"+orgID, cdr.WithProvenance([]byte(`{"resourceType": "Provenance"}`)))
+	assert.ErrorIs(t, err, cdr.ErrInvalidParameter)
+}
+
+type recordingSpan struct {
+	name       string
+	attributes map[string]interface{}
+	err        error
+	ended      bool
+}
+
+func (s *recordingSpan) SetAttribute(key string, value interface{}) {
+	s.attributes[key] = value
+}
+
+func (s *recordingSpan) RecordError(err error) {
+	s.err = err
+}
+
+func (s *recordingSpan) End() {
+	s.ended = true
+}
+
+type recordingTracer struct {
+	spans []*recordingSpan
+}
+
+func (r *recordingTracer) StartSpan(req *http.Request, name string) (*http.Request, cdr.Span) {
+	span := &recordingSpan{name: name, attributes: map[string]interface{}{}}
+	r.spans = append(r.spans, span)
+	return req, span
+}
+
+func TestTracer(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	body := `{"resourceType": "Organization", "id": "` + orgID + `", "name": "Hospital"}`
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, body)
+	})
+
+	tracer := &recordingTracer{}
+	client, err := cdr.NewClient(iamClient, &cdr.Config{
+		CDRURL:    serverCDR.URL + "/store/fhir",
+		RootOrgID: cdrOrgID,
+		Tracer:    tracer,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, _, err = client.OperationsR4.Get("Organization/" + orgID)
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, _, err = client.OperationsR4.Delete("Organization/" + orgID)
+	assert.NotNil(t, err)
+
+	if !assert.Len(t, tracer.spans, 2) {
+		return
+	}
+	read := tracer.spans[0]
+	assert.Equal(t, "CDR read Organization", read.name)
+	assert.True(t, read.ended)
+	assert.Nil(t, read.err)
+	assert.Equal(t, "Organization", read.attributes[cdr.SpanAttributeResourceType])
+	assert.Equal(t, http.StatusOK, read.attributes[cdr.SpanAttributeStatusCode])
+	assert.Equal(t, int64(len(body)), read.attributes[cdr.SpanAttributeResponseBytes])
+
+	deleted := tracer.spans[1]
+	assert.Equal(t, "delete", deleted.attributes[cdr.SpanAttributeOperation])
+	assert.Equal(t, http.StatusNotFound, deleted.attributes[cdr.SpanAttributeStatusCode])
+	assert.NotNil(t, deleted.err)
+	assert.True(t, deleted.ended)
+}
+
+func TestFHIRVersion(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	fhirVersion := "4.0.1"
+	muxCDR.HandleFunc("/store/fhir/metadata", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "CapabilityStatement",
+  "status": "active",
+  "kind": "instance",
+  "fhirVersion": "`+fhirVersion+`"
+}`)
+	})
+
+	client, err := cdr.NewClient(iamClient, &cdr.Config{
+		CDRURL:      serverCDR.URL + "/store/fhir",
+		RootOrgID:   cdrOrgID,
+		FHIRVersion: fhirversion.R4,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, fhirversion.R4, client.FHIRVersion())
+
+	version, _, err := client.DetectFHIRVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, fhirversion.R4, version)
+
+	fhirVersion = "3.0.2"
+	version, _, err = client.DetectFHIRVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, fhirversion.STU3, version)
+
+	fhirVersion = "5.0.0"
+	_, _, err = client.DetectFHIRVersion()
+	assert.True(t, errors.Is(err, cdr.ErrUnknownFHIRVersion))
+}
+
+func TestReadCache(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	var ifNoneMatch string
+	var notModified int
+	orgIDs := []string{"f5fe538f-c3b5-4454-8774-cd3789f59b9f", "dae89cf0-888d-4a26-8c1d-578e97365efc"}
+	for _, orgID := range orgIDs {
+		orgID := orgID
+		muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+			if r.Method == http.MethodDelete {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			ifNoneMatch = r.Header.Get("If-None-Match")
+			if ifNoneMatch == `W/"1"` {
+				notModified++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `W/"1"`)
+			w.WriteHeader(http.StatusOK)
+			_, _ = io.WriteString(w, `{"resourceType": "Organization", "id": "`+orgID+`", "name": "Hospital"}`)
+		})
+	}
+
+	client, err := cdr.NewClient(iamClient, &cdr.Config{
+		CDRURL:        serverCDR.URL + "/store/fhir",
+		RootOrgID:     cdrOrgID,
+		ReadCacheSize: 1,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	get := func(orgID string) *cdr.Response {
+		contained, resp, err := client.OperationsR4.Get("Organization/" + orgID)
+		if !assert.Nil(t, err) || !assert.NotNil(t, resp) {
+			return nil
+		}
+		assert.Equal(t, orgID, contained.GetOrganization().GetId().GetValue())
+		return resp
+	}
+
+	resp := get(orgIDs[0])
+	assert.Empty(t, ifNoneMatch)
+	assert.False(t, resp.FromCache)
+
+	resp = get(orgIDs[0])
+	assert.Equal(t, `W/"1"`, ifNoneMatch)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.True(t, resp.FromCache)
+	assert.Equal(t, "1", resp.VersionID())
+	assert.Equal(t, 1, notModified)
+
+	// The second resource evicts the first
+	_ = get(orgIDs[1])
+	_ = get(orgIDs[0])
+	assert.Empty(t, ifNoneMatch)
+
+	// A delete invalidates the cached resource
+	_, _, err = client.OperationsR4.Delete("Organization/" + orgIDs[0])
+	if !assert.Nil(t, err) {
+		return
+	}
+	resp = get(orgIDs[0])
+	assert.Empty(t, ifNoneMatch)
+	assert.False(t, resp.FromCache)
+
+	// A transaction may change any resource and clears the cache
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"resourceType": "Bundle", "type": "transaction-response", "entry": [{"response": {"status": "200 OK"}}]}`)
+	})
+	resp = get(orgIDs[0])
+	assert.Equal(t, `W/"1"`, ifNoneMatch)
+	bundle := []byte(`{"resourceType": "Bundle", "type": "transaction", "entry": []}`)
+	_, _, err = client.OperationsR4.Transaction(bundle, "urn:example:ingest", "msg-1")
+	if !assert.Nil(t, err) {
+		return
+	}
+	resp = get(orgIDs[0])
+	assert.Empty(t, ifNoneMatch)
+	assert.False(t, resp.FromCache)
+
+	// Without the cache a 304 is left to the caller
+	_, resp, err = cdrClient.OperationsR4.ReadIfNoneMatch("Organization", orgIDs[0], "1")
+	assert.ErrorIs(t, err, cdr.ErrNotModified)
+	assert.False(t, resp.FromCache)
+}
+
+func TestNewUnmarshaller(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	observationID := "5c4d2b3e-3e1a-4d0a-9d7f-9a4b6f2c1e11"
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Observation/"+observationID, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		// status and code are required
+		_, _ = io.WriteString(w, `{"resourceType": "Observation", "id": "`+observationID+`"}`)
+	})
+
+	_, _, err := cdrClient.OperationsR4.Get("Observation/" + observationID)
+	assert.NotNil(t, err)
+
+	var versions []fhirversion.Version
+	client, err := cdr.NewClient(iamClient, &cdr.Config{
+		CDRURL:    serverCDR.URL + "/store/fhir",
+		RootOrgID: cdrOrgID,
+		NewMarshaller: func(ver fhirversion.Version) (*jsonformat.Marshaller, error) {
+			versions = append(versions, ver)
+			return jsonformat.NewPrettyMarshaller(ver)
+		},
+		NewUnmarshaller: jsonformat.NewUnmarshallerWithoutValidation,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, []fhirversion.Version{fhirversion.STU3, fhirversion.R4}, versions)
+	contained, _, err := client.OperationsR4.Get("Observation/" + observationID)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, observationID, contained.GetObservation().GetId().GetValue())
+}
+
+func TestClockSkew(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	serverTime := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", serverTime.Format(http.TimeFormat))
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"resourceType": "Organization", "id": "`+orgID+`", "name": "Hospital"}`)
+	})
+
+	_, resp, err := cdrClient.OperationsR4.Get("Organization/" + orgID)
+	if !assert.Nil(t, err) {
+		return
+	}
+	date, ok := resp.ServerTime()
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.True(t, serverTime.Equal(date))
+	skew, ok := resp.ClockSkew()
+	assert.True(t, ok)
+	assert.InDelta(t, float64(time.Hour), float64(skew), float64(2*time.Second))
+
+	_, ok = (&cdr.Response{}).ClockSkew()
+	assert.False(t, ok)
+}
+
+func TestFailOnSeverity(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/$validate", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "OperationOutcome",
+  "issue": [{"severity": "warning", "code": "informational", "diagnostics": "name is not capitalized"}]
+}`)
+	})
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "Bundle",
+  "type": "batch-response",
+  "entry": [
+    {
+      "response": {
+        "status": "201 Created",
+        "outcome": {
+          "resourceType": "OperationOutcome",
+          "issue": [{"severity": "warning", "code": "informational", "diagnostics": "name is not capitalized"}]
+        }
+      }
+    }
+  ]
+}`)
+	})
+	body := []byte(`{"resourceType": "Organization", "name": "hospital"}`)
+	bundle := []byte(`{"resourceType": "Bundle", "type": "batch", "entry": [{"resource": {"resourceType": "Organization", "name": "hospital"}, "request": {"method": "POST", "url": "Organization"}}]}`)
+
+	contained, _, err := cdrClient.OperationsR4.Post("Organization", body, cdr.WithValidateOnly())
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.NotNil(t, contained.GetOperationOutcome())
+	results, _, err := cdrClient.OperationsR4.Batch(bundle)
+	if !assert.Nil(t, err) {
+		return
+	}
+	if !assert.Len(t, results, 1) {
+		return
+	}
+	assert.False(t, results[0].Failed())
+
+	strict, err := cdr.NewClient(iamClient, &cdr.Config{
+		CDRURL:         serverCDR.URL + "/store/fhir",
+		RootOrgID:      cdrOrgID,
+		FailOnSeverity: cdr.SeverityWarning,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	contained, _, err = strict.OperationsR4.Post("Organization", body, cdr.WithValidateOnly())
+	assert.True(t, errors.Is(err, cdr.ErrOutcomeSeverity))
+	var outcomeErr *cdr.OperationOutcomeError
+	if assert.True(t, errors.As(err, &outcomeErr)) {
+		assert.Equal(t, http.StatusOK, outcomeErr.StatusCode)
+		assert.Len(t, outcomeErr.Issues, 1)
+	}
+	assert.NotNil(t, contained.GetOperationOutcome())
+	results, _, err = strict.OperationsR4.Batch(bundle)
+	assert.True(t, errors.Is(err, cdr.ErrBatchFailed))
+	if assert.Len(t, results, 1) {
+		assert.True(t, results[0].Failed())
+	}
+
+	_, err = cdr.NewClient(iamClient, &cdr.Config{
+		CDRURL:         serverCDR.URL + "/store/fhir",
+		RootOrgID:      cdrOrgID,
+		FailOnSeverity: "bogus",
+	})
+	assert.True(t, errors.Is(err, cdr.ErrInvalidParameter))
+}
+
+func TestRootOrgIDValidation(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"resourceType": "Organization", "id": "`+orgID+`", "name": "Hospital"}`)
+	})
+
+	client, err := cdr.NewClient(iamClient, &cdr.Config{
+		CDRURL:    serverCDR.URL + "/store/fhir",
+		RootOrgID: " " + cdrOrgID + "/",
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, serverCDR.URL+"/store/fhir/"+cdrOrgID, client.GetEndpointURL())
+	contained, _, err := client.OperationsR4.Get("Organization/" + orgID)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "Hospital", contained.GetOrganization().GetName().GetValue())
+
+	for _, rootOrgID := range []string{cdrOrgID + "/Patient", "48a0183d a588", "org?x=1"} {
+		_, err = cdr.NewClient(iamClient, &cdr.Config{
+			CDRURL:    serverCDR.URL + "/store/fhir",
+			RootOrgID: rootOrgID,
+		})
+		assert.True(t, errors.Is(err, cdr.ErrInvalidRootOrgID), rootOrgID)
+	}
+}
+
+func TestCheckResponse(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusNonAuthoritativeInfo)
+		_, _ = io.WriteString(w, `{"resourceType": "Organization", "id": "`+orgID+`", "name": "Hospital"}`)
+	})
+
+	_, resp, err := cdrClient.OperationsR4.Get("Organization/" + orgID)
+	assert.NotNil(t, err)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusNonAuthoritativeInfo, resp.StatusCode())
+	}
+
+	var checked int
+	lenient, err := cdr.NewClient(iamClient, &cdr.Config{
+		CDRURL:    serverCDR.URL + "/store/fhir",
+		RootOrgID: cdrOrgID,
+		CheckResponse: func(resp *http.Response) error {
+			checked++
+			if resp.StatusCode == http.StatusNonAuthoritativeInfo {
+				return nil
+			}
+			return cdr.CheckResponse(resp)
+		},
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	contained, _, err := lenient.OperationsR4.Get("Organization/" + orgID)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, 1, checked)
+	assert.Equal(t, "Hospital", contained.GetOrganization().GetName().GetValue())
+
+	_, _, err = lenient.OperationsR4.Get("Organization/missing")
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, checked)
+}
+
+func TestPathEncoding(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	var paths []string
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/", func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"resourceType": "Bundle", "type": "searchset", "total": 0}`)
+	})
+
+	escaped, err := cdr.NewClient(iamClient, &cdr.Config{
+		CDRURL:       serverCDR.URL + "/store/fhir",
+		RootOrgID:    cdrOrgID,
+		PathEncoding: cdr.PathEncodingEscaped,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, _, err = escaped.OperationsR4.RawRequest(http.MethodGet, "Patient/a b/Observation", nil)
+	assert.Nil(t, err)
+	_, _, _, err = escaped.OperationsR4.CompartmentSearch("Patient", "a/b", "Observation", nil)
+	assert.Nil(t, err)
+	_, _, err = escaped.OperationsR4.Post("Organization", []byte(`{"resourceType": "Organization"}`), cdr.WithValidateOnly())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"/store/fhir/" + cdrOrgID + "/Patient/a%20b/Observation",
+		"/store/fhir/" + cdrOrgID + "/Patient/a%2Fb/Observation",
+		"/store/fhir/" + cdrOrgID + "/Organization/$validate",
+	}, paths)
+
+	_, err = cdr.NewClient(iamClient, &cdr.Config{
+		CDRURL:       serverCDR.URL + "/store/fhir",
+		RootOrgID:    cdrOrgID,
+		PathEncoding: "raw",
+	})
+	assert.True(t, errors.Is(err, cdr.ErrInvalidParameter))
+}
@@ -0,0 +1,46 @@
+package cdr
+
+import "net/http"
+
+// ConditionalOutcome is what a conditional create, update or patch did with the
+// resources matching its query, see Response.ConditionalOutcome
+type ConditionalOutcome string
+
+// Conditional outcomes
+const (
+	// ConditionalCreated means no resource matched and a new one was created
+	ConditionalCreated ConditionalOutcome = "created"
+	// ConditionalUpdated means the single matching resource was updated or patched
+	ConditionalUpdated ConditionalOutcome = "updated"
+	// ConditionalNoOp means a conditional create matched an existing resource which
+	// was returned unchanged
+	ConditionalNoOp ConditionalOutcome = "noop"
+	// ConditionalMultipleMatches means the query matched more than one resource and
+	// nothing was changed. The error of the call wraps ErrMultipleMatches
+	ConditionalMultipleMatches ConditionalOutcome = "multiple-matches"
+	// ConditionalUnknown means the response does not tell, e.g. the request failed
+	// for another reason or there was no response
+	ConditionalUnknown ConditionalOutcome = ""
+)
+
+// ConditionalOutcome returns the outcome of the conditional create, update or patch which
+// returned r, e.g. UpdateConditional, PatchConditional or CreateIdempotent, so callers can
+// handle each case without inspecting status codes. It is also set when the call returned
+// an error, in which case it is ConditionalMultipleMatches or ConditionalUnknown
+func (r *Response) ConditionalOutcome() ConditionalOutcome {
+	if r == nil || r.Response == nil {
+		return ConditionalUnknown
+	}
+	switch r.Response.StatusCode {
+	case http.StatusCreated:
+		return ConditionalCreated
+	case http.StatusPreconditionFailed:
+		return ConditionalMultipleMatches
+	case http.StatusOK:
+		if r.Request != nil && r.Request.Method == http.MethodPost {
+			return ConditionalNoOp
+		}
+		return ConditionalUpdated
+	}
+	return ConditionalUnknown
+}
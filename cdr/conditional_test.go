@@ -0,0 +1,34 @@
+package cdr_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/philips-software/go-hsdp-api/cdr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConditionalOutcome(t *testing.T) {
+	tests := []struct {
+		method string
+		status int
+		want   cdr.ConditionalOutcome
+	}{
+		{http.MethodPost, http.StatusCreated, cdr.ConditionalCreated},
+		{http.MethodPost, http.StatusOK, cdr.ConditionalNoOp},
+		{http.MethodPut, http.StatusCreated, cdr.ConditionalCreated},
+		{http.MethodPut, http.StatusOK, cdr.ConditionalUpdated},
+		{http.MethodPatch, http.StatusOK, cdr.ConditionalUpdated},
+		{http.MethodPatch, http.StatusPreconditionFailed, cdr.ConditionalMultipleMatches},
+		{http.MethodPut, http.StatusBadRequest, cdr.ConditionalUnknown},
+	}
+	for _, tt := range tests {
+		resp := &cdr.Response{Response: &http.Response{
+			StatusCode: tt.status,
+			Request:    &http.Request{Method: tt.method},
+		}}
+		assert.Equal(t, tt.want, resp.ConditionalOutcome(), "%s %d", tt.method, tt.status)
+	}
+	var resp *cdr.Response
+	assert.Equal(t, cdr.ConditionalUnknown, resp.ConditionalOutcome())
+}
@@ -0,0 +1,200 @@
+package cdr
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// resourceCreator is implemented by the versioned operations services
+type resourceCreator interface {
+	marshalResource(resource proto.Message) ([]byte, error)
+	postResource(resourceType string, jsonBody []byte, options ...OptionFunc) (proto.Message, *Response, error)
+	putResource(resourceID string, jsonBody []byte, options ...OptionFunc) (proto.Message, *Response, error)
+}
+
+// Create marshals resource, POSTs it to the CDR and returns the created resource
+// as the same concrete FHIR type. svc should be either OperationsSTU3 or OperationsR4
+// matching the FHIR version of T
+func Create[T proto.Message](svc resourceCreator, resource T, options ...OptionFunc) (T, *Response, error) {
+	var created T
+	jsonBody, err := svc.marshalResource(resource)
+	if err != nil {
+		return created, nil, fmt.Errorf("cdr.Create marshal: %w", err)
+	}
+	resourceType := string(resource.ProtoReflect().Descriptor().Name())
+	contained, resp, err := svc.postResource(resourceType, jsonBody, options...)
+	if err != nil {
+		return created, resp, err
+	}
+	created, err = unwrapAs[T]("cdr.Create", resourceType, contained)
+	return created, resp, err
+}
+
+// CreateWithID creates resource with the client assigned id using a PUT, e.g. to keep
+// the ids of migrated resources. The id of resource is set to id in the request. The
+// returned bool is true when the resource was created and false when an existing
+// resource with id was updated
+func CreateWithID[T proto.Message](svc resourceCreator, id string, resource T, options ...OptionFunc) (T, bool, *Response, error) {
+	var created T
+	if id == "" {
+		return created, false, nil, fmt.Errorf("cdr.CreateWithID: %w", ErrMissingIdentifier)
+	}
+	withID := proto.Clone(resource)
+	if err := setResourceID(withID, id); err != nil {
+		return created, false, nil, fmt.Errorf("cdr.CreateWithID: %w", err)
+	}
+	jsonBody, err := svc.marshalResource(withID)
+	if err != nil {
+		return created, false, nil, fmt.Errorf("cdr.CreateWithID marshal: %w", err)
+	}
+	resourceType := string(resource.ProtoReflect().Descriptor().Name())
+	contained, resp, err := svc.putResource(resourceType+"/"+id, jsonBody, options...)
+	if err != nil {
+		return created, false, resp, err
+	}
+	created, err = unwrapAs[T]("cdr.CreateWithID", resourceType, contained)
+	return created, resp.Created(), resp, err
+}
+
+// CreateIdempotent creates resource unless a resource of its type with identifier system|key
+// exists, making the create safe to retry after an ambiguous failure, e.g. a timeout or the
+// redelivery of a message. The CDR has no idempotency header so the identifier is added to
+// resource, when missing, and a conditional create with If-None-Exist is used. key must be
+// stable across retries, e.g. the id of the consumed message. The returned bool is true when
+// the resource was created and false when the existing resource was returned, see also
+// Response.ConditionalOutcome
+func CreateIdempotent[T proto.Message](svc resourceCreator, system, key string, resource T, options ...OptionFunc) (T, bool, *Response, error) {
+	var created T
+	if system == "" || key == "" {
+		return created, false, nil, fmt.Errorf("cdr.CreateIdempotent: %w", ErrMissingIdentifier)
+	}
+	withIdentifier := proto.Clone(resource)
+	if err := addIdentifier(withIdentifier, system, key); err != nil {
+		return created, false, nil, fmt.Errorf("cdr.CreateIdempotent: %w", err)
+	}
+	jsonBody, err := svc.marshalResource(withIdentifier)
+	if err != nil {
+		return created, false, nil, fmt.Errorf("cdr.CreateIdempotent marshal: %w", err)
+	}
+	resourceType := string(resource.ProtoReflect().Descriptor().Name())
+	ifNoneExist := url.Values{"identifier": []string{system + "|" + key}}.Encode()
+	contained, resp, err := svc.postResource(resourceType, jsonBody, append([]OptionFunc{
+		func(req *http.Request) error {
+			req.Header.Set("If-None-Exist", ifNoneExist)
+			return nil
+		},
+	}, options...)...)
+	if err != nil {
+		return created, false, resp, err
+	}
+	created, err = unwrapAs[T]("cdr.CreateIdempotent", resourceType, contained)
+	return created, resp.Created(), resp, err
+}
+
+// unwrapAs returns the resource in contained as T
+func unwrapAs[T proto.Message](operation, resourceType string, contained proto.Message) (T, error) {
+	var resource T
+	unwrapped := unwrapContained(contained)
+	if unwrapped == nil {
+		return resource, fmt.Errorf("%s %s: %w", operation, resourceType, ErrEmptyResult)
+	}
+	resource, ok := unwrapped.(T)
+	if !ok {
+		return resource, fmt.Errorf("%s: expected %s but got %s", operation, resourceType, unwrapped.ProtoReflect().Descriptor().Name())
+	}
+	return resource, nil
+}
+
+// setResourceID sets the id element of the FHIR resource
+func setResourceID(resource proto.Message, id string) error {
+	m := resource.ProtoReflect()
+	idField := m.Descriptor().Fields().ByName("id")
+	if idField == nil || idField.Kind() != protoreflect.MessageKind {
+		return fmt.Errorf("%w: %s has no id", ErrInvalidParameter, m.Descriptor().Name())
+	}
+	idMessage := m.Mutable(idField).Message()
+	valueField := idMessage.Descriptor().Fields().ByName("value")
+	if valueField == nil || valueField.Kind() != protoreflect.StringKind {
+		return fmt.Errorf("%w: %s has no id", ErrInvalidParameter, m.Descriptor().Name())
+	}
+	idMessage.Set(valueField, protoreflect.ValueOfString(id))
+	return nil
+}
+
+// addIdentifier adds an identifier with system and value to the FHIR resource unless
+// it already has it
+func addIdentifier(resource proto.Message, system, value string) error {
+	m := resource.ProtoReflect()
+	identifierField := m.Descriptor().Fields().ByName("identifier")
+	if identifierField == nil || identifierField.Kind() != protoreflect.MessageKind {
+		return fmt.Errorf("%w: %s has no identifier", ErrInvalidParameter, m.Descriptor().Name())
+	}
+	var identifier protoreflect.Message
+	if identifierField.IsList() {
+		identifiers := m.Mutable(identifierField).List()
+		for i := 0; i < identifiers.Len(); i++ {
+			existing := identifiers.Get(i).Message()
+			if primitiveValue(existing, "system") == system && primitiveValue(existing, "value") == value {
+				return nil
+			}
+		}
+		element := identifiers.NewElement()
+		identifiers.Append(element)
+		identifier = element.Message()
+	} else {
+		identifier = m.Mutable(identifierField).Message()
+	}
+	if err := setPrimitiveValue(identifier, "system", system); err != nil {
+		return err
+	}
+	return setPrimitiveValue(identifier, "value", value)
+}
+
+// primitiveValue returns the string value of the primitive element name of m
+func primitiveValue(m protoreflect.Message, name string) string {
+	field := m.Descriptor().Fields().ByName(protoreflect.Name(name))
+	if field == nil || field.Kind() != protoreflect.MessageKind || !m.Has(field) {
+		return ""
+	}
+	element := m.Get(field).Message()
+	valueField := element.Descriptor().Fields().ByName("value")
+	if valueField == nil || valueField.Kind() != protoreflect.StringKind {
+		return ""
+	}
+	return element.Get(valueField).String()
+}
+
+// setPrimitiveValue sets the string value of the primitive element name of m
+func setPrimitiveValue(m protoreflect.Message, name, value string) error {
+	field := m.Descriptor().Fields().ByName(protoreflect.Name(name))
+	if field == nil || field.Kind() != protoreflect.MessageKind {
+		return fmt.Errorf("%w: %s has no %s", ErrInvalidParameter, m.Descriptor().Name(), name)
+	}
+	element := m.Mutable(field).Message()
+	valueField := element.Descriptor().Fields().ByName("value")
+	if valueField == nil || valueField.Kind() != protoreflect.StringKind {
+		return fmt.Errorf("%w: %s has no %s", ErrInvalidParameter, m.Descriptor().Name(), name)
+	}
+	element.Set(valueField, protoreflect.ValueOfString(value))
+	return nil
+}
+
+// unwrapContained returns the resource set in a ContainedResource or nil if none is set
+func unwrapContained(contained proto.Message) proto.Message {
+	if contained == nil {
+		return nil
+	}
+	var resource proto.Message
+	contained.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Kind() == protoreflect.MessageKind {
+			resource = v.Message().Interface()
+			return false
+		}
+		return true
+	})
+	return resource
+}
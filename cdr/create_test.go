@@ -0,0 +1,193 @@
+package cdr_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/google/fhir/go/fhirversion"
+	"github.com/philips-software/go-hsdp-api/cdr"
+	"github.com/philips-software/go-hsdp-api/cdr/helper/fhir/r4"
+	"github.com/philips-software/go-hsdp-api/cdr/helper/fhir/stu3"
+	"github.com/stretchr/testify/assert"
+)
+
+// createHandler creates the first resource posted and returns existing resources for further posts
+func createHandler(t *testing.T, contentType string) func(w http.ResponseWriter, r *http.Request) {
+	posts := 0
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		switch r.Method {
+		case "POST":
+			body, err := io.ReadAll(r.Body)
+			if !assert.Nil(t, err) {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			posts++
+			if posts > 1 {
+				w.WriteHeader(http.StatusOK)
+			} else {
+				w.WriteHeader(http.StatusCreated)
+			}
+			_, _ = w.Write(body)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func TestR4Create(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization", createHandler(t, "application/fhir+json;fhirVersion=4.0"))
+
+	org, err := r4.NewOrganization(timeZone, orgID, "Hospital")
+	if !assert.Nil(t, err) {
+		return
+	}
+	created, resp, err := cdr.Create(cdrClient.OperationsR4, org)
+	if !assert.Nil(t, err) {
+		return
+	}
+	if !assert.NotNil(t, resp) {
+		return
+	}
+	assert.Equal(t, http.StatusCreated, resp.StatusCode())
+	assert.True(t, resp.Created())
+	if !assert.NotNil(t, created) {
+		return
+	}
+	assert.Equal(t, "Hospital", created.Name.Value)
+
+	existing, resp, err := cdr.Create(cdrClient.OperationsR4, org)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.False(t, resp.Created())
+	assert.Equal(t, "Hospital", existing.Name.Value)
+}
+
+func TestSTU3Create(t *testing.T) {
+	teardown := setup(t, fhirversion.STU3)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization", createHandler(t, "application/fhir+json"))
+
+	org, err := stu3.NewOrganization(timeZone, orgID, "Hospital")
+	if !assert.Nil(t, err) {
+		return
+	}
+	created, resp, err := cdr.Create(cdrClient.OperationsSTU3, org)
+	if !assert.Nil(t, err) {
+		return
+	}
+	if !assert.NotNil(t, resp) {
+		return
+	}
+	assert.Equal(t, http.StatusCreated, resp.StatusCode())
+	assert.True(t, resp.Created())
+	if !assert.NotNil(t, created) {
+		return
+	}
+	assert.Equal(t, "Hospital", created.Name.Value)
+}
+
+func TestR4CreateWithID(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	id := "source-org-42"
+	puts := 0
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+id, func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, http.MethodPut, r.Method) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if !assert.Nil(t, err) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		assert.Contains(t, string(body), `"id":"`+id+`"`)
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		puts++
+		if puts > 1 {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+		_, _ = w.Write(body)
+	})
+
+	org, err := r4.NewOrganization(timeZone, "f5fe538f-c3b5-4454-8774-cd3789f59b9f", "Hospital")
+	if !assert.Nil(t, err) {
+		return
+	}
+	created, isNew, resp, err := cdr.CreateWithID(cdrClient.OperationsR4, id, org)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusCreated, resp.StatusCode())
+	assert.True(t, isNew)
+	assert.Equal(t, id, created.Id.Value)
+	assert.Equal(t, "Hospital", created.Name.Value)
+	assert.Equal(t, "f5fe538f-c3b5-4454-8774-cd3789f59b9f", org.Id.Value, "resource of the caller is not modified")
+
+	_, isNew, _, err = cdr.CreateWithID(cdrClient.OperationsR4, id, org)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.False(t, isNew)
+
+	_, _, _, err = cdr.CreateWithID(cdrClient.OperationsR4, "", org)
+	assert.True(t, errors.Is(err, cdr.ErrMissingIdentifier))
+}
+
+func TestR4CreateIdempotent(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	create := createHandler(t, "application/fhir+json;fhirVersion=4.0")
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "identifier=urn%3Aexample%3Amessages%7Cmsg-1", r.Header.Get("If-None-Exist"))
+		create(w, r)
+	})
+
+	org, err := r4.NewOrganization(timeZone, orgID, "Hospital")
+	if !assert.Nil(t, err) {
+		return
+	}
+	identifiers := len(org.Identifier)
+	created, isNew, resp, err := cdr.CreateIdempotent(cdrClient.OperationsR4, "urn:example:messages", "msg-1", org)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.True(t, isNew)
+	assert.Equal(t, cdr.ConditionalCreated, resp.ConditionalOutcome())
+	assert.Len(t, org.Identifier, identifiers)
+	if !assert.Len(t, created.Identifier, identifiers+1) {
+		return
+	}
+	added := created.Identifier[identifiers]
+	assert.Equal(t, "urn:example:messages", added.GetSystem().GetValue())
+	assert.Equal(t, "msg-1", added.GetValue().GetValue())
+
+	// A retry with the identifier already present does not add it again
+	existing, isNew, resp, err := cdr.CreateIdempotent(cdrClient.OperationsR4, "urn:example:messages", "msg-1", created)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.False(t, isNew)
+	assert.Equal(t, cdr.ConditionalNoOp, resp.ConditionalOutcome())
+	assert.Len(t, existing.Identifier, identifiers+1)
+
+	_, _, _, err = cdr.CreateIdempotent(cdrClient.OperationsR4, "urn:example:messages", "", org)
+	assert.True(t, errors.Is(err, cdr.ErrMissingIdentifier))
+}
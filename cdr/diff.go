@@ -0,0 +1,89 @@
+package cdr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DiffOperation is a field-level change reported by the $diff operation. Type is the
+// kind of change, e.g. add, delete, replace or insert, and Path the FHIRPath of the
+// changed element. PreviousValue and Value hold the JSON of the element before and
+// after the change and are nil when not applicable, e.g. Value of a delete
+type DiffOperation struct {
+	Type          string
+	Path          string
+	PreviousValue json.RawMessage
+	Value         json.RawMessage
+}
+
+// diffOptions returns the option which sets the $diff query parameters. Empty
+// versions are left out so the server picks its default, the current version
+// against the previous one
+func diffOptions(fromVersion, toVersion string) OptionFunc {
+	return func(req *http.Request) error {
+		q := req.URL.Query()
+		if fromVersion != "" {
+			q.Set("fromVersion", fromVersion)
+		}
+		if toVersion != "" {
+			q.Set("toVersion", toVersion)
+		}
+		req.URL.RawQuery = q.Encode()
+		return nil
+	}
+}
+
+// parseDiff returns the operations of the Parameters resource returned by $diff.
+// The JSON is the same for STU3 and R4
+func parseDiff(body []byte) ([]DiffOperation, error) {
+	type parameter struct {
+		Name string                       `json:"name"`
+		Part []map[string]json.RawMessage `json:"part"`
+	}
+	var parameters struct {
+		ResourceType string      `json:"resourceType"`
+		Parameter    []parameter `json:"parameter"`
+	}
+	if err := json.Unmarshal(body, &parameters); err != nil {
+		return nil, err
+	}
+	if parameters.ResourceType != "Parameters" {
+		return nil, fmt.Errorf("%w: %s", ErrNotParameters, parameters.ResourceType)
+	}
+	operations := make([]DiffOperation, 0, len(parameters.Parameter))
+	for _, p := range parameters.Parameter {
+		if p.Name != "operation" {
+			continue
+		}
+		var operation DiffOperation
+		for _, part := range p.Part {
+			var name string
+			_ = json.Unmarshal(part["name"], &name)
+			value := partValue(part)
+			switch name {
+			case "type":
+				_ = json.Unmarshal(value, &operation.Type)
+			case "path":
+				_ = json.Unmarshal(value, &operation.Path)
+			case "previousValue":
+				operation.PreviousValue = value
+			case "value":
+				operation.Value = value
+			}
+		}
+		operations = append(operations, operation)
+	}
+	return operations, nil
+}
+
+// partValue returns the value[x] of a Parameters part
+func partValue(part map[string]json.RawMessage) json.RawMessage {
+	for key, value := range part {
+		if strings.HasPrefix(key, "value") {
+			return value
+		}
+	}
+	return nil
+}
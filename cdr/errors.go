@@ -9,4 +9,25 @@ var (
 	ErrCDRURLCannotBeEmpty = errors.New("base CDR URL cannot be empty")
 	ErrEmptyResult         = errors.New("empty result")
 	ErrMissingAcceptHeader = errors.New("missing accept header")
+	ErrInvalidTimeZone     = errors.New("invalid timezone")
+	ErrNotABundle          = errors.New("response is not a bundle")
+	ErrInvalidParameter    = errors.New("invalid parameter value")
+	ErrMissingIdentifier   = errors.New("missing identifier")
+	ErrRoundTrip           = errors.New("resource does not survive a marshal round-trip")
+	ErrMultipleMatches     = errors.New("search criteria match multiple resources")
+	ErrNotModified         = errors.New("resource not modified")
+	ErrBatchFailed         = errors.New("all batch entries failed")
+	ErrInvalidReference    = errors.New("invalid reference")
+	ErrMissingReference    = errors.New("missing reference")
+	ErrBundleMismatch      = errors.New("bundle entries do not match the results")
+	ErrUnknownFHIRVersion  = errors.New("unknown FHIR version")
+	ErrMissingToken        = errors.New("missing bearer token, use an IAM client or WithBearerToken")
+	ErrAlreadyProcessed    = errors.New("transaction already processed")
+	ErrResponseTooLarge    = errors.New("response too large")
+	ErrNotAnOutcome        = errors.New("response is not an OperationOutcome")
+	ErrPatchConflict       = errors.New("patch conflicts with the current resource")
+	ErrNotParameters       = errors.New("response is not a Parameters resource")
+	ErrInvalidRootOrgID    = errors.New("invalid root organization ID")
+	ErrOutcomeSeverity     = errors.New("operation outcome has issues at or above the failure severity")
+	ErrAsyncInProgress     = errors.New("request accepted but still in progress, no status endpoint to wait for")
 )
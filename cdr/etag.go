@@ -0,0 +1,41 @@
+package cdr
+
+import (
+	"net/http"
+	"strings"
+)
+
+// VersionFromETag returns the bare version id of a weak or strong ETag, e.g. 3 for
+// both W/"3" and "3". A value which is not quoted is returned as is
+func VersionFromETag(etag string) string {
+	etag = strings.TrimSpace(etag)
+	etag = strings.TrimPrefix(etag, "W/")
+	if len(etag) >= 2 && strings.HasPrefix(etag, `"`) && strings.HasSuffix(etag, `"`) {
+		etag = etag[1 : len(etag)-1]
+	}
+	return etag
+}
+
+// ETag returns the weak ETag FHIR uses for versionID, e.g. W/"3". versionID may
+// itself be an ETag in which case it is normalized first
+func ETag(versionID string) string {
+	return `W/"` + VersionFromETag(versionID) + `"`
+}
+
+// VersionID returns the version id of the ETag header of the response, empty
+// when there is none
+func (r *Response) VersionID() string {
+	if r == nil || r.Response == nil {
+		return ""
+	}
+	return VersionFromETag(r.Header.Get("ETag"))
+}
+
+// WithIfMatch makes a Put or Delete conditional on the current version of the resource
+// being versionID, a bare version id or an ETag. A mismatch fails with 412 Precondition Failed
+func WithIfMatch(versionID string) OptionFunc {
+	return func(req *http.Request) error {
+		req.Header.Set("If-Match", ETag(versionID))
+		return nil
+	}
+}
@@ -0,0 +1,61 @@
+package cdr_test
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/google/fhir/go/fhirversion"
+	"github.com/philips-software/go-hsdp-api/cdr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionFromETag(t *testing.T) {
+	for etag, version := range map[string]string{
+		`W/"3"`:   "3",
+		`"3"`:     "3",
+		`3`:       "3",
+		` W/"3" `: "3",
+		`W/""`:    "",
+		``:        "",
+	} {
+		assert.Equal(t, version, cdr.VersionFromETag(etag), etag)
+	}
+	assert.Equal(t, `W/"3"`, cdr.ETag("3"))
+	assert.Equal(t, `W/"3"`, cdr.ETag(`W/"3"`))
+	assert.Equal(t, `W/"3"`, cdr.ETag(`"3"`))
+}
+
+func TestWithIfMatch(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	body := `{"resourceType": "Organization", "id": "` + orgID + `", "name": "Hospital"}`
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		if r.Header.Get("If-Match") != `W/"3"` {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		w.Header().Set("ETag", `W/"4"`)
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, body)
+	})
+
+	_, resp, err := cdrClient.OperationsR4.Put("Organization/"+orgID, []byte(body), cdr.WithIfMatch("3"))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "4", resp.VersionID())
+
+	_, _, err = cdrClient.OperationsR4.Put("Organization/"+orgID, []byte(body), cdr.WithIfMatch(`"3"`))
+	assert.Nil(t, err)
+
+	_, resp, err = cdrClient.OperationsR4.Put("Organization/"+orgID, []byte(body), cdr.WithIfMatch("2"))
+	assert.NotNil(t, err)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode())
+		assert.Equal(t, "", resp.VersionID())
+	}
+}
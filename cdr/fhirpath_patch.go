@@ -0,0 +1,73 @@
+package cdr
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Types of FHIRPath Patch operations
+const (
+	PatchAdd     = "add"
+	PatchInsert  = "insert"
+	PatchDelete  = "delete"
+	PatchReplace = "replace"
+	PatchMove    = "move"
+)
+
+// FHIRPathPatchOperation is a single operation of a FHIRPath Patch. Value is rendered
+// as value[x] using ValueType, e.g. ValueType "String" results in valueString
+type FHIRPathPatchOperation struct {
+	Type        string
+	Path        string
+	Name        string
+	ValueType   string
+	Value       interface{}
+	Index       *int
+	Source      *int
+	Destination *int
+}
+
+// buildFHIRPathPatch renders operations as a FHIR Parameters resource
+func buildFHIRPathPatch(operations []FHIRPathPatchOperation) ([]byte, error) {
+	if len(operations) == 0 {
+		return nil, fmt.Errorf("FHIRPath Patch: %w: no operations", ErrInvalidParameter)
+	}
+	type part map[string]interface{}
+	parameters := make([]part, 0, len(operations))
+	for i, op := range operations {
+		switch op.Type {
+		case PatchAdd, PatchInsert, PatchDelete, PatchReplace, PatchMove:
+		default:
+			return nil, fmt.Errorf("FHIRPath Patch operation %d: %w: type [%s]", i, ErrInvalidParameter, op.Type)
+		}
+		if op.Path == "" {
+			return nil, fmt.Errorf("FHIRPath Patch operation %d: %w: missing path", i, ErrInvalidParameter)
+		}
+		parts := []part{
+			{"name": "type", "valueCode": op.Type},
+			{"name": "path", "valueString": op.Path},
+		}
+		if op.Name != "" {
+			parts = append(parts, part{"name": "name", "valueString": op.Name})
+		}
+		if op.Value != nil {
+			if op.ValueType == "" {
+				return nil, fmt.Errorf("FHIRPath Patch operation %d: %w: missing value type", i, ErrInvalidParameter)
+			}
+			parts = append(parts, part{"name": "value", "value" + op.ValueType: op.Value})
+		}
+		for _, index := range []struct {
+			name  string
+			value *int
+		}{{"index", op.Index}, {"source", op.Source}, {"destination", op.Destination}} {
+			if index.value != nil {
+				parts = append(parts, part{"name": index.name, "valueInteger": *index.value})
+			}
+		}
+		parameters = append(parameters, part{"name": "operation", "part": parts})
+	}
+	return json.Marshal(map[string]interface{}{
+		"resourceType": "Parameters",
+		"parameter":    parameters,
+	})
+}
@@ -0,0 +1,39 @@
+package r4
+
+import (
+	"github.com/google/fhir/go/jsonformat"
+	r4dt "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/datatypes_go_proto"
+)
+
+// NewReference returns a Reference to the resourceType resource with id, e.g. for the
+// subject of an Observation. The reference is normalized to its typed field, e.g.
+// PatientId, like references read from the CDR
+func NewReference(resourceType, id string) *r4dt.Reference {
+	reference := &r4dt.Reference{
+		Reference: &r4dt.Reference_Uri{Uri: &r4dt.String{Value: resourceType + "/" + id}},
+	}
+	// Only types unknown to this FHIR version fail, those are kept as a literal reference
+	_ = jsonformat.NormalizeReference(reference)
+	return reference
+}
+
+// NewIdentifier returns an Identifier with the given system and value
+func NewIdentifier(system, value string) *r4dt.Identifier {
+	return &r4dt.Identifier{
+		System: &r4dt.Uri{Value: system},
+		Value:  &r4dt.String{Value: value},
+	}
+}
+
+// NewCodeableConcept returns a CodeableConcept with a single Coding of code in system.
+// An empty display is left out
+func NewCodeableConcept(system, code, display string) *r4dt.CodeableConcept {
+	coding := &r4dt.Coding{
+		System: &r4dt.Uri{Value: system},
+		Code:   &r4dt.Code{Value: code},
+	}
+	if display != "" {
+		coding.Display = &r4dt.String{Value: display}
+	}
+	return &r4dt.CodeableConcept{Coding: []*r4dt.Coding{coding}}
+}
@@ -0,0 +1,39 @@
+package stu3
+
+import (
+	"github.com/google/fhir/go/jsonformat"
+	stu3dt "github.com/google/fhir/go/proto/google/fhir/proto/stu3/datatypes_go_proto"
+)
+
+// NewReference returns a Reference to the resourceType resource with id, e.g. for the
+// subject of an Observation. The reference is normalized to its typed field, e.g.
+// PatientId, like references read from the CDR
+func NewReference(resourceType, id string) *stu3dt.Reference {
+	reference := &stu3dt.Reference{
+		Reference: &stu3dt.Reference_Uri{Uri: &stu3dt.String{Value: resourceType + "/" + id}},
+	}
+	// Only types unknown to this FHIR version fail, those are kept as a literal reference
+	_ = jsonformat.NormalizeReference(reference)
+	return reference
+}
+
+// NewIdentifier returns an Identifier with the given system and value
+func NewIdentifier(system, value string) *stu3dt.Identifier {
+	return &stu3dt.Identifier{
+		System: &stu3dt.Uri{Value: system},
+		Value:  &stu3dt.String{Value: value},
+	}
+}
+
+// NewCodeableConcept returns a CodeableConcept with a single Coding of code in system.
+// An empty display is left out
+func NewCodeableConcept(system, code, display string) *stu3dt.CodeableConcept {
+	coding := &stu3dt.Coding{
+		System: &stu3dt.Uri{Value: system},
+		Code:   &stu3dt.Code{Value: code},
+	}
+	if display != "" {
+		coding.Display = &stu3dt.String{Value: display}
+	}
+	return &stu3dt.CodeableConcept{Coding: []*stu3dt.Coding{coding}}
+}
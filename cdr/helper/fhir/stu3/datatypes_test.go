@@ -0,0 +1,36 @@
+package stu3_test
+
+import (
+	"testing"
+
+	"github.com/philips-software/go-hsdp-api/cdr/helper/fhir/stu3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewReference(t *testing.T) {
+	reference := stu3.NewReference("Patient", "123")
+	assert.Equal(t, "123", reference.GetPatientId().GetValue())
+
+	reference = stu3.NewReference("Unknown", "123")
+	assert.Equal(t, "Unknown/123", reference.GetUri().GetValue())
+}
+
+func TestNewIdentifier(t *testing.T) {
+	identifier := stu3.NewIdentifier("https://example.com/mrn", "42")
+	assert.Equal(t, "https://example.com/mrn", identifier.GetSystem().GetValue())
+	assert.Equal(t, "42", identifier.GetValue().GetValue())
+}
+
+func TestNewCodeableConcept(t *testing.T) {
+	concept := stu3.NewCodeableConcept("http://loinc.org", "8867-4", "Heart rate")
+	if !assert.Len(t, concept.GetCoding(), 1) {
+		return
+	}
+	coding := concept.GetCoding()[0]
+	assert.Equal(t, "http://loinc.org", coding.GetSystem().GetValue())
+	assert.Equal(t, "8867-4", coding.GetCode().GetValue())
+	assert.Equal(t, "Heart rate", coding.GetDisplay().GetValue())
+
+	concept = stu3.NewCodeableConcept("http://loinc.org", "8867-4", "")
+	assert.Nil(t, concept.GetCoding()[0].GetDisplay())
+}
@@ -0,0 +1,77 @@
+package cdr
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// RequestLog is a structured record of a single CDR request. It never contains
+// request headers so the bearer token is not exposed
+type RequestLog struct {
+	Method string
+	URL    string
+	// CorrelationID is the X-Correlation-Id header of the request, see WithCorrelationID
+	CorrelationID string
+	// StatusCode is 0 when no response was received
+	StatusCode    int
+	Duration      time.Duration
+	RequestBytes  int64
+	ResponseBytes int64
+	// Err is the error of the request, if any, e.g. a transport error, a response rejected
+	// by Config.CheckResponse or Config.MaxResponseSize or a body which failed to decode
+	Err error
+}
+
+// RequestLogger receives a RequestLog after every CDR request completed
+// and its response body was consumed. Implementations must be safe for concurrent use
+type RequestLogger interface {
+	LogRequest(entry RequestLog)
+}
+
+// countingReadCloser counts the bytes read from the wrapped body
+type countingReadCloser struct {
+	io.ReadCloser
+	count int64
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.count += int64(n)
+	return n, err
+}
+
+// logRequest reports a completed request to the configured RequestLogger
+func (c *Client) logRequest(req *http.Request, resp *http.Response, duration time.Duration, responseBytes int64, err error) {
+	if c.config.Logger == nil {
+		return
+	}
+	entry := RequestLog{
+		Method:        req.Method,
+		URL:           requestURL(req.URL),
+		CorrelationID: req.Header.Get(CorrelationIDHeader),
+		Duration:      duration,
+		ResponseBytes: responseBytes,
+		Err:           err,
+	}
+	if req.ContentLength > 0 {
+		entry.RequestBytes = req.ContentLength
+	}
+	if resp != nil {
+		entry.StatusCode = resp.StatusCode
+	}
+	c.config.Logger.LogRequest(entry)
+}
+
+// requestURL renders u including the host, also when the path is set as Opaque
+func requestURL(u *url.URL) string {
+	if u.Opaque == "" {
+		return u.String()
+	}
+	rendered := u.Scheme + "://" + u.Host + u.Opaque
+	if u.RawQuery != "" {
+		rendered += "?" + u.RawQuery
+	}
+	return rendered
+}
@@ -0,0 +1,57 @@
+package cdr
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+)
+
+// rootContentID is the Content-ID of the FHIR resource part of a multipart/related body
+const rootContentID = "<root>"
+
+// Attachment is a binary part of a multipart/related request. ContentID is how the
+// FHIR resource refers to it, e.g. from an Attachment.url of "cid:scan1"
+type Attachment struct {
+	ContentID   string
+	ContentType string
+	Data        []byte
+}
+
+// multipartRelated builds a multipart/related body with resource as the root part followed
+// by attachments. It returns the body and the Content-Type header to send it with
+func multipartRelated(resource []byte, resourceContentType string, attachments []Attachment) ([]byte, string, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	parts := append([]Attachment{{ContentID: rootContentID, ContentType: resourceContentType, Data: resource}}, attachments...)
+	for _, part := range parts {
+		if part.ContentID == "" || part.ContentType == "" {
+			return nil, "", fmt.Errorf("%w: attachment needs a ContentID and ContentType", ErrInvalidParameter)
+		}
+		contentID := part.ContentID
+		if contentID[0] != '<' {
+			contentID = "<" + contentID + ">"
+		}
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", part.ContentType)
+		header.Set("Content-ID", contentID)
+		header.Set("Content-Transfer-Encoding", "binary")
+		pw, err := w.CreatePart(header)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := pw.Write(part.Data); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	contentType := mime.FormatMediaType("multipart/related", map[string]string{
+		"type":     resourceContentType,
+		"start":    rootContentID,
+		"boundary": w.Boundary(),
+	})
+	return body.Bytes(), contentType, nil
+}
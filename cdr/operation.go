@@ -0,0 +1,58 @@
+package cdr
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ExpungeParams are the parameters of the $expunge operation. ExpungeDeletedResources
+// removes resources which were logically deleted, ExpungePreviousVersions the history
+// of current resources. Limit caps the number of resources removed, zero leaves the
+// server default
+type ExpungeParams struct {
+	ExpungeDeletedResources bool
+	ExpungePreviousVersions bool
+	Limit                   int
+}
+
+// operationPath returns the path of a FHIR operation at the system level, on
+// resourceType or on the resourceType instance with id. The leading $ of
+// operation is optional
+func operationPath(resourceType, id, operation string) string {
+	operation = "$" + strings.TrimPrefix(operation, "$")
+	switch {
+	case resourceType == "":
+		return operation
+	case id == "":
+		return resourceType + "/" + operation
+	}
+	return resourceType + "/" + id + "/" + operation
+}
+
+// expungeParameters returns params as a Parameters resource. The JSON is the same
+// for STU3 and R4
+func expungeParameters(params ExpungeParams) ([]byte, error) {
+	if params.Limit < 0 {
+		return nil, fmt.Errorf("%w: limit [%d]", ErrInvalidParameter, params.Limit)
+	}
+	type parameter struct {
+		Name         string `json:"name"`
+		ValueBoolean *bool  `json:"valueBoolean,omitempty"`
+		ValueInteger *int   `json:"valueInteger,omitempty"`
+	}
+	parameters := struct {
+		ResourceType string      `json:"resourceType"`
+		Parameter    []parameter `json:"parameter,omitempty"`
+	}{ResourceType: "Parameters"}
+	if params.ExpungeDeletedResources {
+		parameters.Parameter = append(parameters.Parameter, parameter{Name: "expungeDeletedResources", ValueBoolean: &params.ExpungeDeletedResources})
+	}
+	if params.ExpungePreviousVersions {
+		parameters.Parameter = append(parameters.Parameter, parameter{Name: "expungePreviousVersions", ValueBoolean: &params.ExpungePreviousVersions})
+	}
+	if params.Limit > 0 {
+		parameters.Parameter = append(parameters.Parameter, parameter{Name: "limit", ValueInteger: &params.Limit})
+	}
+	return json.Marshal(parameters)
+}
@@ -1,11 +1,19 @@
 package cdr_test
 
 import (
+	"encoding/json"
+	"errors"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/google/fhir/go/fhirversion"
+	r4dt "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/datatypes_go_proto"
+	r4parameterspb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/parameters_go_proto"
 	"github.com/philips-software/go-hsdp-api/cdr"
 
 	jsonpatch "github.com/evanphx/json-patch/v5"
@@ -77,6 +85,79 @@ func TestR4PatchOperation(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.StatusCode())
 }
 
+func TestR4FHIRPatchOperation(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		if !assert.Equal(t, http.MethodPatch, r.Method) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !assert.Equal(t, "application/fhir+json;fhirVersion=4.0", r.Header.Get("Content-Type")) {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if !assert.Nil(t, err) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		contained, err := um.UnmarshalR4(body)
+		if !assert.Nil(t, err) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		operations := contained.GetParameters().GetParameter()
+		if !assert.Len(t, operations, 2) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		parts := operations[0].GetPart()
+		if !assert.Len(t, parts, 3) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		assert.Equal(t, "replace", parts[0].GetValue().GetCode().GetValue())
+		assert.Equal(t, "Organization.name", parts[1].GetValue().GetStringValue().GetValue())
+		assert.Equal(t, "Hospital2", parts[2].GetValue().GetStringValue().GetValue())
+		parts = operations[1].GetPart()
+		if !assert.Len(t, parts, 3) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		assert.Equal(t, "delete", parts[0].GetValue().GetCode().GetValue())
+		assert.Equal(t, int32(0), parts[2].GetValue().GetInteger().GetValue())
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "Organization",
+  "id": "`+orgID+`",
+  "name": "Hospital2"
+}`)
+	})
+	index := 0
+	patched, resp, err := cdrClient.OperationsR4.FHIRPatch("Organization", orgID, []cdr.FHIRPathPatchOperation{
+		{Type: cdr.PatchReplace, Path: "Organization.name", ValueType: "String", Value: "Hospital2"},
+		{Type: cdr.PatchDelete, Path: "Organization.alias", Index: &index},
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	if !assert.NotNil(t, resp) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, "Hospital2", patched.GetOrganization().GetName().GetValue())
+
+	_, _, err = cdrClient.OperationsR4.FHIRPatch("Organization", orgID, []cdr.FHIRPathPatchOperation{
+		{Type: "upsert", Path: "Organization.name"},
+	})
+	assert.True(t, errors.Is(err, cdr.ErrInvalidParameter))
+}
+
 func TestR4PostOperation(t *testing.T) {
 	teardown := setup(t, fhirversion.R4)
 	defer teardown()
@@ -230,3 +311,1337 @@ func TestR4DeleteOperation(t *testing.T) {
 	}
 	assert.True(t, ok)
 }
+
+func TestR4WithTimeZone(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	patientID := "a8a3e8b0-2a6c-4a6a-9f1a-1f2b3c4d5e6f"
+
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Patient/"+patientID, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		switch r.Method {
+		case "GET":
+			w.WriteHeader(http.StatusOK)
+			_, _ = io.WriteString(w, `{
+  "resourceType": "Patient",
+  "id": "`+patientID+`",
+  "birthDate": "1970-01-01"
+}
+`)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	_, err := cdrClient.OperationsR4.WithTimeZone("Not/AZone")
+	assert.NotNil(t, err)
+
+	operations, err := cdrClient.OperationsR4.WithTimeZone("America/New_York")
+	if !assert.Nil(t, err) {
+		return
+	}
+	retrieved, _, err := operations.Get("Patient/" + patientID)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "America/New_York", retrieved.GetPatient().BirthDate.Timezone)
+
+	retrieved, _, err = cdrClient.OperationsR4.Get("Patient/" + patientID)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, timeZone, retrieved.GetPatient().BirthDate.Timezone)
+}
+
+func TestR4SearchOperation(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		switch r.Method {
+		case "GET":
+			if !assert.Equal(t, cdr.APIVersion, r.Header.Get("API-Version")) {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			if r.URL.Query().Get("name") != "Hospital" {
+				_, _ = io.WriteString(w, `{
+  "resourceType": "Bundle",
+  "type": "searchset",
+  "total": 0
+}`)
+				return
+			}
+			_, _ = io.WriteString(w, `{
+  "resourceType": "Bundle",
+  "type": "searchset",
+  "total": 1,
+  "entry": [
+    {
+      "fullUrl": "Organization/`+orgID+`",
+      "resource": {
+        "resourceType": "Organization",
+        "id": "`+orgID+`",
+        "name": "Hospital"
+      }
+    }
+  ]
+}`)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	entries, total, resp, err := cdrClient.OperationsR4.Search("Organization", url.Values{"name": {"Hospital"}})
+	if !assert.Nil(t, err) {
+		return
+	}
+	if !assert.NotNil(t, resp) {
+		return
+	}
+	assert.Equal(t, 1, total)
+	if !assert.Len(t, entries, 1) {
+		return
+	}
+	assert.Equal(t, "Hospital", entries[0].GetOrganization().Name.Value)
+
+	entries, total, resp, err = cdrClient.OperationsR4.Search("Organization", url.Values{"name": {"Clinic"}})
+	if !assert.Nil(t, err) {
+		return
+	}
+	if !assert.NotNil(t, resp) {
+		return
+	}
+	assert.Equal(t, 0, total)
+	assert.Len(t, entries, 0)
+}
+
+func TestR4SearchSummary(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Observation", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		switch r.Method {
+		case "GET":
+			w.WriteHeader(http.StatusOK)
+			switch r.URL.Query().Get("_summary") {
+			case "count":
+				_, _ = io.WriteString(w, `{
+  "resourceType": "Bundle",
+  "type": "searchset",
+  "total": 42
+}`)
+			default:
+				_, _ = io.WriteString(w, `{
+  "resourceType": "Bundle",
+  "type": "searchset",
+  "total": 1,
+  "entry": [
+    {
+      "resource": {
+        "resourceType": "Observation",
+        "id": "8e0d7a1c-9a4e-4b0a-8a89-3c1f5f2a4b6d",
+        "meta": {
+          "tag": [
+            {
+              "system": "http://terminology.hl7.org/CodeSystem/v3-ObservationValue",
+              "code": "SUBSETTED"
+            }
+          ]
+        },
+        "status": "final"
+      }
+    }
+  ]
+}`)
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	entries, total, _, err := cdrClient.OperationsR4.Search("Observation", nil, cdr.WithSummary(cdr.SummaryCount))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, 42, total)
+	assert.Len(t, entries, 0)
+
+	entries, total, _, err = cdrClient.OperationsR4.Search("Observation", nil, cdr.WithSummary(cdr.SummaryTrue))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, 1, total)
+	assert.Len(t, entries, 1)
+
+	_, _, _, err = cdrClient.OperationsR4.Search("Observation", nil, cdr.WithSummary("bogus"))
+	assert.True(t, errors.Is(err, cdr.ErrInvalidParameter))
+}
+
+func TestR4RateLimitHeaders(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.Header().Set("X-RateLimit-Remaining", "99")
+		w.Header().Set("X-RateLimit-Reset", "1718200000")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "Organization",
+  "id": "`+orgID+`",
+  "name": "Hospital"
+}`)
+	})
+	_, resp, err := cdrClient.OperationsR4.Get("Organization/" + orgID)
+	if !assert.Nil(t, err) {
+		return
+	}
+	if !assert.NotNil(t, resp) {
+		return
+	}
+	remaining, ok := resp.RateLimitRemaining()
+	assert.True(t, ok)
+	assert.Equal(t, int64(99), remaining)
+	reset, ok := resp.RateLimitReset()
+	assert.True(t, ok)
+	assert.Equal(t, int64(1718200000), reset)
+
+	var empty *cdr.Response
+	_, ok = empty.RateLimitRemaining()
+	assert.False(t, ok)
+}
+
+func TestR4RoundTripCheck(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	var posts int
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		if !assert.Equal(t, http.MethodPost, r.Method) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		posts++
+		body, err := io.ReadAll(r.Body)
+		if !assert.Nil(t, err) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(body)
+	})
+
+	created, resp, err := cdrClient.OperationsR4.Post("Organization", []byte(`{
+  "resourceType": "Organization",
+  "id": "dae89cf0-888d-4a26-8c1d-578e97365efc",
+  "name": "Hospital"
+}`), cdrClient.OperationsR4.WithRoundTripCheck())
+	if !assert.Nil(t, err) {
+		return
+	}
+	if !assert.NotNil(t, resp) {
+		return
+	}
+	assert.Equal(t, "Hospital", created.GetOrganization().GetName().GetValue())
+	assert.Equal(t, 1, posts)
+
+	_, resp, err = cdrClient.OperationsR4.Post("Organization", []byte(`{
+  "resourceType": "Organization",
+  "name": 42
+}`), cdrClient.OperationsR4.WithRoundTripCheck())
+	assert.Nil(t, resp)
+	assert.True(t, errors.Is(err, cdr.ErrRoundTrip))
+	assert.Equal(t, 1, posts)
+}
+
+func TestR4WithAccept(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "dae89cf0-888d-4a26-8c1d-578e97365efc"
+	accept := "application/fhir+json;fhirVersion=4.0"
+
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, accept, r.Header.Get("Accept")) {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "Organization",
+  "id": "`+orgID+`",
+  "name": "Hospital"
+}`)
+	})
+
+	_, resp, err := cdrClient.OperationsR4.Get("Organization/" + orgID)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+
+	accept = "application/json"
+	contained, resp, err := cdrClient.OperationsR4.Get("Organization/"+orgID, cdr.WithAccept(accept))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, "Hospital", contained.GetOrganization().GetName().GetValue())
+}
+
+func TestR4UpdateConditional(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	body := `{"resourceType": "Organization", "id": "` + orgID + `", "name": "Hospital"}`
+	var puts int
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		if !assert.Equal(t, http.MethodPut, r.Method) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		switch r.URL.Query().Get("identifier") {
+		case "https://example.org|hospital":
+		case "https://example.org|duplicate":
+			w.WriteHeader(http.StatusPreconditionFailed)
+			_, _ = io.WriteString(w, `{"resourceType": "OperationOutcome", "issue": [{"severity": "error", "code": "multiple-matches"}]}`)
+			return
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received, err := io.ReadAll(r.Body)
+		if !assert.Nil(t, err) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		puts++
+		if puts == 1 {
+			w.WriteHeader(http.StatusCreated)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+		_, _ = w.Write(received)
+	})
+
+	query := url.Values{"identifier": {cdr.Token("https://example.org", "hospital")}}
+	contained, created, resp, err := cdrClient.OperationsR4.UpdateConditional("Organization", query, []byte(body))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.NotNil(t, resp)
+	assert.True(t, created)
+	assert.Equal(t, cdr.ConditionalCreated, resp.ConditionalOutcome())
+	assert.Equal(t, "Hospital", contained.GetOrganization().GetName().GetValue())
+
+	_, created, resp, err = cdrClient.OperationsR4.UpdateConditional("Organization", query, []byte(body))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.False(t, created)
+	assert.Equal(t, cdr.ConditionalUpdated, resp.ConditionalOutcome())
+
+	query = url.Values{"identifier": {cdr.Token("https://example.org", "duplicate")}}
+	_, created, resp, err = cdrClient.OperationsR4.UpdateConditional("Organization", query, []byte(body))
+	assert.False(t, created)
+	if !assert.NotNil(t, resp) {
+		return
+	}
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode())
+	assert.True(t, errors.Is(err, cdr.ErrMultipleMatches))
+	assert.Equal(t, cdr.ConditionalMultipleMatches, resp.ConditionalOutcome())
+}
+
+func TestR4ValidateOnly(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	body := `{"resourceType": "Organization", "id": "` + orgID + `", "name": "Hospital"}`
+	outcome := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		if !assert.Equal(t, http.MethodPost, r.Method) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "OperationOutcome",
+  "issue": [{"severity": "information", "code": "informational", "diagnostics": "`+r.URL.Query().Get("mode")+`"}]
+}`)
+	}
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/$validate", outcome)
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID+"/$validate", outcome)
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected write: %s", r.Method)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	contained, _, err := cdrClient.OperationsR4.Post("Organization", []byte(body), cdr.WithValidateOnly())
+	if !assert.Nil(t, err) {
+		return
+	}
+	issues := contained.GetOperationOutcome().GetIssue()
+	if assert.Len(t, issues, 1) {
+		assert.Equal(t, "", issues[0].GetDiagnostics().GetValue())
+	}
+
+	contained, _, err = cdrClient.OperationsR4.Put("Organization/"+orgID, []byte(body), cdr.WithValidateOnly())
+	if !assert.Nil(t, err) {
+		return
+	}
+	issues = contained.GetOperationOutcome().GetIssue()
+	if assert.Len(t, issues, 1) {
+		assert.Equal(t, "update", issues[0].GetDiagnostics().GetValue())
+	}
+
+	_, _, err = cdrClient.OperationsR4.Delete("Organization/"+orgID, cdr.WithValidateOnly())
+	assert.True(t, errors.Is(err, cdr.ErrInvalidParameter))
+}
+
+func TestR4ReadIfNoneMatch(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	etag := `W/"4cbb8588-444a-11eb-917c-1f1d96935807"`
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"resourceType": "Organization", "id": "`+orgID+`", "name": "Hospital"}`)
+	})
+
+	contained, resp, err := cdrClient.OperationsR4.ReadIfNoneMatch("Organization", orgID, `W/"outdated"`)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "Hospital", contained.GetOrganization().GetName().GetValue())
+	assert.Equal(t, etag, resp.Header.Get("ETag"))
+
+	contained, resp, err = cdrClient.OperationsR4.ReadIfNoneMatch("Organization", orgID, etag)
+	assert.True(t, errors.Is(err, cdr.ErrNotModified))
+	assert.Nil(t, contained)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusNotModified, resp.StatusCode())
+	}
+
+	_, _, err = cdrClient.OperationsR4.ReadIfNoneMatch("Organization", orgID, cdr.VersionFromETag(etag))
+	assert.True(t, errors.Is(err, cdr.ErrNotModified))
+}
+
+func TestR4LastN(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Observation/$lastn", func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, http.MethodGet, r.Method) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		query := r.URL.Query()
+		assert.Equal(t, "3", query.Get("max"))
+		assert.Equal(t, "Patient/123", query.Get("patient"))
+		assert.Equal(t, "vital-signs", query.Get("category"))
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "Bundle",
+  "type": "searchset",
+  "entry": [
+    {"resource": {"resourceType": "Observation", "id": "hr-1", "status": "final", "code": {"coding": [{"system": "http://loinc.org", "code": "8867-4"}]}}},
+    {"resource": {"resourceType": "Observation", "id": "bw-1", "status": "final", "code": {"coding": [{"system": "http://loinc.org", "code": "29463-7"}]}}}
+  ]
+}`)
+	})
+
+	entries, resp, err := cdrClient.OperationsR4.LastN(url.Values{
+		"max":      {"3"},
+		"patient":  {"Patient/123"},
+		"category": {"vital-signs"},
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	if !assert.Len(t, entries, 2) {
+		return
+	}
+	assert.Equal(t, "hr-1", entries[0].GetObservation().GetId().GetValue())
+	assert.Equal(t, "bw-1", entries[1].GetObservation().GetId().GetValue())
+
+	_, _, err = cdrClient.OperationsR4.LastN(url.Values{"max": {"0"}})
+	assert.True(t, errors.Is(err, cdr.ErrInvalidParameter))
+}
+
+func TestR4Batch(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	allFailed := false
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID, func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, http.MethodPost, r.Method) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		created := `{"response": {"status": "201 Created", "location": "Patient/123/_history/1", "etag": "W/\"1\""}}`
+		if allFailed {
+			created = `{"response": {"status": "409 Conflict"}}`
+		}
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "Bundle",
+  "type": "batch-response",
+  "entry": [
+    `+created+`,
+    {"response": {"status": "400 Bad Request", "outcome": {"resourceType": "OperationOutcome", "issue": [{"severity": "error", "code": "invalid", "diagnostics": "missing status"}]}}}
+  ]
+}`)
+	})
+
+	bundle := []byte(`{"resourceType": "Bundle", "type": "batch", "entry": []}`)
+	results, resp, err := cdrClient.OperationsR4.Batch(bundle)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	if !assert.Len(t, results, 2) {
+		return
+	}
+	assert.False(t, results[0].Failed())
+	assert.Equal(t, http.StatusCreated, results[0].Status)
+	assert.Equal(t, "Patient/123/_history/1", results[0].Location)
+	assert.Equal(t, `W/"1"`, results[0].ETag)
+	assert.Nil(t, results[0].Outcome)
+	assert.True(t, results[1].Failed())
+	assert.Equal(t, 1, results[1].Index)
+	assert.Equal(t, http.StatusBadRequest, results[1].Status)
+	assert.NotNil(t, results[1].Outcome)
+
+	allFailed = true
+	results, _, err = cdrClient.OperationsR4.Batch(bundle)
+	assert.True(t, errors.Is(err, cdr.ErrBatchFailed))
+	assert.Len(t, results, 2)
+}
+
+func TestR4ReadRaw(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	body := `{"resourceType":"Patient","id":"123","meta":{"profile":["http://example.com/unknown"]}}`
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Patient/123", func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, http.MethodGet, r.Method) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		assert.Equal(t, "application/fhir+json;fhirVersion=4.0", r.Header.Get("Accept"))
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, body)
+	})
+
+	raw, resp, err := cdrClient.OperationsR4.ReadRaw("Patient", "123")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, body, string(raw))
+}
+
+func TestR4WithQueryParam(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "0b4f5c5c-3b6e-4a3e-9d64-0c1b2d6f5e11"
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "json", r.URL.Query().Get("_format"))
+		assert.Equal(t, "true", r.URL.Query().Get("_pretty"))
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "Organization",
+  "id": "`+orgID+`",
+  "name": "Hospital"
+}`)
+	})
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Hospital", r.URL.Query().Get("name"))
+		assert.Equal(t, "true", r.URL.Query().Get("_pretty"))
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "Bundle",
+  "type": "searchset",
+  "total": 0
+}`)
+	})
+
+	contained, _, err := cdrClient.OperationsR4.Get("Organization/"+orgID,
+		cdr.WithQueryParam("_format", "json"),
+		cdr.WithQueryParam("_pretty", "true"))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "Hospital", contained.GetOrganization().GetName().GetValue())
+
+	_, _, _, err = cdrClient.OperationsR4.Search("Organization", url.Values{"name": {"Hospital"}},
+		cdr.WithQueryParam("_pretty", "true"))
+	assert.Nil(t, err)
+}
+
+func TestR4ResolveReference(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Observation/obs-1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "Observation",
+  "id": "obs-1",
+  "status": "final",
+  "code": {"coding": [{"system": "http://loinc.org", "code": "8867-4"}]},
+  "subject": {"reference": "Patient/123"}
+}`)
+	})
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Patient/123", func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, http.MethodGet, r.Method) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "Patient",
+  "id": "123"
+}`)
+	})
+
+	observation, _, err := cdrClient.OperationsR4.Get("Observation/obs-1")
+	if !assert.Nil(t, err) {
+		return
+	}
+	patient, resp, err := cdrClient.OperationsR4.ResolveReference(observation.GetObservation(), "subject")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, "123", patient.GetPatient().GetId().GetValue())
+
+	patient, resp, err = cdrClient.OperationsR4.ResolveReference(observation, "subject")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, "123", patient.GetPatient().GetId().GetValue())
+
+	_, _, err = cdrClient.OperationsR4.ResolveReference(observation.GetObservation(), "performer")
+	assert.True(t, errors.Is(err, cdr.ErrMissingReference))
+	_, _, err = cdrClient.OperationsR4.ResolveReference(observation.GetObservation(), "code")
+	assert.True(t, errors.Is(err, cdr.ErrMissingReference))
+}
+
+func TestR4Count(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Patient", func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, http.MethodGet, r.Method) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		assert.Equal(t, cdr.SummaryCount, r.URL.Query().Get("_summary"))
+		assert.Equal(t, "female", r.URL.Query().Get("gender"))
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "Bundle",
+  "type": "searchset",
+  "total": 42
+}`)
+	})
+
+	count, resp, err := cdrClient.OperationsR4.Count("Patient", url.Values{"gender": {"female"}})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, 42, count)
+
+	// The options of the caller are not written to
+	options := make([]cdr.OptionFunc, 1, 2)
+	options[0] = cdr.WithHeader("X-Test", "count")
+	_, _, err = cdrClient.OperationsR4.Count("Patient", url.Values{"gender": {"female"}}, options...)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Nil(t, options[:2][1])
+}
+
+func TestR4CreateRawUpdateRaw(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	body := `{"resourceType":"Patient","meta":{"profile":["http://example.com/unknown"]}}`
+	created := `{"resourceType":"Patient","id":"123","meta":{"versionId":"1","profile":["http://example.com/unknown"]}}`
+	updated := `{"resourceType":"Patient","id":"123","meta":{"versionId":"2","profile":["http://example.com/unknown"]}}`
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Patient", func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, http.MethodPost, r.Method) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		assert.Equal(t, "application/fhir+json;fhirVersion=4.0", r.Header.Get("Content-Type"))
+		received, _ := io.ReadAll(r.Body)
+		assert.Equal(t, body, string(received))
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, created)
+	})
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Patient/123", func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, http.MethodPut, r.Method) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		assert.Equal(t, "application/fhir+json;fhirVersion=4.0", r.Header.Get("Content-Type"))
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, updated)
+	})
+
+	raw, resp, err := cdrClient.OperationsR4.CreateRaw("Patient", []byte(body))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.True(t, resp.Created())
+	assert.Equal(t, created, string(raw))
+
+	raw, resp, err = cdrClient.OperationsR4.UpdateRaw("Patient", "123", []byte(body))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, updated, string(raw))
+}
+
+func TestR4InvokeOperation(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/$process-message", func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, http.MethodPost, r.Method) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		assert.Contains(t, string(body), `"name":"async"`)
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "OperationOutcome",
+  "issue": [{"severity": "information", "code": "informational"}]
+}`)
+	})
+
+	params := &r4parameterspb.Parameters{
+		Parameter: []*r4parameterspb.Parameters_Parameter{
+			{Name: &r4dt.String{Value: "async"}},
+		},
+	}
+	result, _, err := cdrClient.OperationsR4.InvokeOperation("", "", "$process-message", params)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.NotNil(t, result.GetOperationOutcome())
+}
+
+func TestR4OperationOutcomeError(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "OperationOutcome",
+  "issue": [
+    {
+      "severity": "error",
+      "code": "required",
+      "diagnostics": "Organization.name: minimum required = 1, but only found 0",
+      "expression": ["Organization.name"],
+      "location": ["/f:Organization"]
+    },
+    {
+      "severity": "warning",
+      "code": "invalid",
+      "diagnostics": "Unknown code"
+    }
+  ]
+}`)
+	})
+	_, resp, err := cdrClient.OperationsR4.Get("Organization/" + orgID)
+	if !assert.NotNil(t, err) {
+		return
+	}
+	if !assert.NotNil(t, resp) {
+		return
+	}
+	var outcomeErr *cdr.OperationOutcomeError
+	if !assert.True(t, errors.As(err, &outcomeErr)) {
+		return
+	}
+	assert.Equal(t, http.StatusUnprocessableEntity, outcomeErr.StatusCode)
+	assert.Contains(t, err.Error(), "StatusCode 422")
+	if !assert.Len(t, outcomeErr.Issues, 2) {
+		return
+	}
+	assert.Equal(t, "error", outcomeErr.Issues[0].Severity)
+	assert.Equal(t, "required", outcomeErr.Issues[0].Code)
+	assert.Equal(t, []string{"Organization.name"}, outcomeErr.Issues[0].Expression)
+	assert.Equal(t, []string{"/f:Organization"}, outcomeErr.Issues[0].Location)
+	assert.Equal(t, "Unknown code", outcomeErr.Issues[1].Diagnostics)
+	assert.Empty(t, outcomeErr.Issues[1].Expression)
+}
+
+func TestR4PostMultipartRelated(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	docID := "0f8b2b1e-6f0c-4e3a-9c52-5b8e1c1d2a3f"
+	document := `{"resourceType": "DocumentReference", "status": "current", "content": [{"attachment": {"contentType": "application/pdf", "url": "cid:scan1"}}]}`
+	scan := []byte("%PDF-1.4 scan")
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/DocumentReference", func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, http.MethodPost, r.Method) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if !assert.Nil(t, err) {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		assert.Equal(t, "multipart/related", mediaType)
+		assert.Equal(t, "application/fhir+json;fhirVersion=4.0", params["type"])
+		assert.Equal(t, "<root>", params["start"])
+		reader := multipart.NewReader(r.Body, params["boundary"])
+		var parts []string
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if !assert.Nil(t, err) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			data, _ := io.ReadAll(part)
+			parts = append(parts, part.Header.Get("Content-ID")+" "+part.Header.Get("Content-Type")+" "+string(data))
+		}
+		assert.Equal(t, []string{
+			"<root> application/fhir+json;fhirVersion=4.0 " + document,
+			"<scan1> application/pdf " + string(scan),
+		}, parts)
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, `{"resourceType": "DocumentReference", "id": "`+docID+`", "status": "current", "content": [{"attachment": {"url": "cid:scan1"}}]}`)
+	})
+
+	created, resp, err := cdrClient.OperationsR4.PostMultipartRelated("DocumentReference", []byte(document), []cdr.Attachment{
+		{ContentID: "scan1", ContentType: "application/pdf", Data: scan},
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	if !assert.NotNil(t, resp) {
+		return
+	}
+	assert.Equal(t, http.StatusCreated, resp.StatusCode())
+	assert.Equal(t, docID, created.GetDocumentReference().GetId().GetValue())
+
+	_, _, err = cdrClient.OperationsR4.PostMultipartRelated("DocumentReference", []byte(document), []cdr.Attachment{
+		{ContentID: "scan1", Data: scan},
+	})
+	assert.ErrorIs(t, err, cdr.ErrInvalidParameter)
+}
+
+func TestR4Transaction(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	processed := map[string]bool{}
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID, func(w http.ResponseWriter, r *http.Request) {
+		var bundle struct {
+			Type       string `json:"type"`
+			Identifier struct {
+				System string `json:"system"`
+				Value  string `json:"value"`
+			} `json:"identifier"`
+		}
+		if !assert.Nil(t, json.NewDecoder(r.Body).Decode(&bundle)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		assert.Equal(t, "transaction", bundle.Type)
+		assert.Equal(t, "urn:example:ingest", bundle.Identifier.System)
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		if processed[bundle.Identifier.Value] {
+			w.WriteHeader(http.StatusConflict)
+			_, _ = io.WriteString(w, `{"resourceType": "OperationOutcome", "issue": [{"severity": "error", "code": "duplicate", "diagnostics": "transaction already processed"}]}`)
+			return
+		}
+		processed[bundle.Identifier.Value] = true
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "Bundle",
+  "type": "transaction-response",
+  "entry": [{"response": {"status": "201 Created", "location": "Patient/123/_history/1"}}]
+}`)
+	})
+
+	bundle := []byte(`{"resourceType": "Bundle", "type": "transaction", "entry": []}`)
+	results, _, err := cdrClient.OperationsR4.Transaction(bundle, "urn:example:ingest", "msg-1")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Len(t, results, 1)
+
+	_, resp, err := cdrClient.OperationsR4.Transaction(bundle, "urn:example:ingest", "msg-1")
+	assert.True(t, errors.Is(err, cdr.ErrAlreadyProcessed))
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusConflict, resp.StatusCode())
+	}
+
+	_, _, err = cdrClient.OperationsR4.Transaction(bundle, "urn:example:ingest", "")
+	assert.True(t, errors.Is(err, cdr.ErrMissingIdentifier))
+	_, _, err = cdrClient.OperationsR4.Transaction([]byte(`{"resourceType": "Bundle", "type": "batch"}`), "urn:example:ingest", "msg-2")
+	assert.True(t, errors.Is(err, cdr.ErrInvalidParameter))
+	_, _, err = cdrClient.OperationsR4.Transaction([]byte(`{"resourceType": "Bundle", "type": "transaction", "identifier": {"value": "msg-3"}}`), "urn:example:ingest", "msg-2")
+	assert.True(t, errors.Is(err, cdr.ErrInvalidParameter))
+}
+
+func TestR4Expunge(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	patientID := "a7fd5b3a-5ce6-4b58-b2d4-37d4d9a8f6b6"
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Patient/"+patientID+"/$expunge", func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, http.MethodPost, r.Method) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		assert.JSONEq(t, `{
+  "resourceType": "Parameters",
+  "parameter": [
+    {"name": "expungeDeletedResources", "valueBoolean": true},
+    {"name": "expungePreviousVersions", "valueBoolean": true},
+    {"name": "limit", "valueInteger": 10}
+  ]
+}`, string(body))
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "OperationOutcome",
+  "issue": [{"severity": "information", "code": "informational", "diagnostics": "Expunged 3 resource versions"}]
+}`)
+	})
+
+	outcome, _, err := cdrClient.OperationsR4.Expunge("Patient", patientID, cdr.ExpungeParams{
+		ExpungeDeletedResources: true,
+		ExpungePreviousVersions: true,
+		Limit:                   10,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	if !assert.Len(t, outcome.GetIssue(), 1) {
+		return
+	}
+	assert.Equal(t, "Expunged 3 resource versions", outcome.GetIssue()[0].GetDiagnostics().GetValue())
+
+	_, _, err = cdrClient.OperationsR4.Expunge("Patient", patientID, cdr.ExpungeParams{Limit: -1})
+	assert.True(t, errors.Is(err, cdr.ErrInvalidParameter))
+}
+
+func TestR4PatchConflict(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	status := http.StatusConflict
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "OperationOutcome",
+  "issue": [{"severity": "error", "code": "conflict", "diagnostics": "test operation failed"}]
+}`)
+	})
+	patch := []byte(`[{"op": "test", "path": "/name", "value": "Hospital"},{"op": "replace", "path": "/name", "value": "Hospital2"}]`)
+	for _, status = range []int{http.StatusConflict, http.StatusPreconditionFailed} {
+		_, resp, err := cdrClient.OperationsR4.Patch("Organization/"+orgID, patch)
+		if !assert.NotNil(t, resp) {
+			return
+		}
+		assert.Equal(t, status, resp.StatusCode())
+		assert.True(t, errors.Is(err, cdr.ErrPatchConflict), status)
+	}
+	status = http.StatusBadRequest
+	_, _, err := cdrClient.OperationsR4.Patch("Organization/"+orgID, patch)
+	assert.NotNil(t, err)
+	assert.False(t, errors.Is(err, cdr.ErrPatchConflict))
+}
+
+func TestR4BatchStream(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	bundle := `{"resourceType": "Bundle", "type": "batch", "entry": []}`
+	var received string
+	var contentLength int64
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID, func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, http.MethodPost, r.Method) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		contentLength = r.ContentLength
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "Bundle",
+  "type": "batch-response",
+  "entry": [{"response": {"status": "201 Created", "location": "Patient/123/_history/1"}}]
+}`)
+	})
+
+	for _, length := range []int64{int64(len(bundle)), -1} {
+		// A bare io.Reader so the length can not be derived from the type
+		body := io.MultiReader(strings.NewReader(bundle))
+		results, _, err := cdrClient.OperationsR4.BatchStream(body, length)
+		if !assert.Nil(t, err) {
+			return
+		}
+		assert.Len(t, results, 1)
+		assert.Equal(t, bundle, received)
+		assert.Equal(t, length, contentLength)
+	}
+}
+
+func TestR4PatchConditional(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization", func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, http.MethodPatch, r.Method) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		assert.Equal(t, "application/json-patch+json", r.Header.Get("Content-Type"))
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		if r.URL.Query().Get("identifier") != "https://example.com|123" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			_, _ = io.WriteString(w, `{
+  "resourceType": "OperationOutcome",
+  "issue": [{"severity": "error", "code": "multiple-matches", "diagnostics": "multiple resources match"}]
+}`)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"resourceType": "Organization", "id": "`+orgID+`", "name": "Hospital2"}`)
+	})
+
+	patch := []byte(`[{"op": "replace", "path": "/name", "value": "Hospital2"}]`)
+	contained, _, err := cdrClient.OperationsR4.PatchConditional("Organization", url.Values{
+		"identifier": []string{"https://example.com|123"},
+	}, patch, "")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "Hospital2", contained.GetOrganization().GetName().GetValue())
+
+	_, _, err = cdrClient.OperationsR4.PatchConditional("Organization", url.Values{
+		"name": []string{"Hospital"},
+	}, patch, "application/json-patch+json")
+	assert.True(t, errors.Is(err, cdr.ErrMultipleMatches))
+}
+
+func TestR4RawRequest(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Patient/123/$custom-op", func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, http.MethodPost, r.Method) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		assert.Equal(t, "application/fhir+json;fhirVersion=4.0", r.Header.Get("Content-Type"))
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, `{"resourceType":"Parameters"}`, string(body))
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"resourceType":"Parameters","parameter":[{"name":"result","valueBoolean":true}]}`)
+	})
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = io.WriteString(w, `{"resourceType": "OperationOutcome", "issue": [{"severity": "error", "code": "not-found"}]}`)
+	})
+
+	raw, resp, err := cdrClient.OperationsR4.RawRequest(http.MethodPost, "Patient/123/$custom-op", []byte(`{"resourceType":"Parameters"}`))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, `{"resourceType":"Parameters","parameter":[{"name":"result","valueBoolean":true}]}`, string(raw))
+
+	_, resp, err = cdrClient.OperationsR4.RawRequest(http.MethodGet, "", nil)
+	var outcomeErr *cdr.OperationOutcomeError
+	assert.True(t, errors.As(err, &outcomeErr))
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode())
+	}
+}
+
+func TestR4SearchByPost(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/_search", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		switch r.Method {
+		case "POST":
+			assert.Equal(t, "", r.URL.RawQuery)
+			assert.Equal(t, "application/x-www-form-urlencoded", r.Header.Get("Content-Type"))
+			if !assert.Nil(t, r.ParseForm()) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			assert.Equal(t, "Hospital", r.PostForm.Get("name"))
+			assert.Equal(t, "none", r.PostForm.Get("_total"))
+			w.WriteHeader(http.StatusOK)
+			_, _ = io.WriteString(w, `{
+  "resourceType": "Bundle",
+  "type": "searchset",
+  "entry": [
+    {
+      "fullUrl": "Organization/`+orgID+`",
+      "resource": {
+        "resourceType": "Organization",
+        "id": "`+orgID+`",
+        "name": "Hospital"
+      }
+    }
+  ]
+}`)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	entries, total, resp, err := cdrClient.OperationsR4.SearchByPost("Organization", url.Values{"name": {"Hospital"}}, cdr.WithTotal(cdr.TotalNone))
+	if !assert.Nil(t, err) {
+		return
+	}
+	if !assert.NotNil(t, resp) {
+		return
+	}
+	assert.Equal(t, cdr.TotalUnknown, total)
+	if !assert.Len(t, entries, 1) {
+		return
+	}
+	assert.Equal(t, "Hospital", entries[0].GetOrganization().Name.Value)
+}
+
+func TestR4Diff(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	patientID := "a7fd5b3a-5ce6-4b58-b2d4-37d4d9a8f6b6"
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Patient/"+patientID+"/$diff", func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, http.MethodGet, r.Method) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		assert.Equal(t, "1", r.URL.Query().Get("fromVersion"))
+		assert.Equal(t, "2", r.URL.Query().Get("toVersion"))
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "Parameters",
+  "parameter": [
+    {
+      "name": "operation",
+      "part": [
+        {"name": "type", "valueCode": "replace"},
+        {"name": "path", "valueString": "Patient.name.family"},
+        {"name": "previousValue", "valueString": "Doe"},
+        {"name": "value", "valueString": "Smith"}
+      ]
+    },
+    {
+      "name": "operation",
+      "part": [
+        {"name": "type", "valueCode": "delete"},
+        {"name": "path", "valueString": "Patient.telecom[0]"}
+      ]
+    }
+  ]
+}`)
+	})
+
+	operations, _, err := cdrClient.OperationsR4.Diff("Patient", patientID, "1", "2")
+	if !assert.Nil(t, err) {
+		return
+	}
+	if !assert.Len(t, operations, 2) {
+		return
+	}
+	assert.Equal(t, "replace", operations[0].Type)
+	assert.Equal(t, "Patient.name.family", operations[0].Path)
+	assert.JSONEq(t, `"Doe"`, string(operations[0].PreviousValue))
+	assert.JSONEq(t, `"Smith"`, string(operations[0].Value))
+	assert.Equal(t, "delete", operations[1].Type)
+	assert.Nil(t, operations[1].Value)
+
+	_, _, err = cdrClient.OperationsR4.Diff("Patient", "", "1", "2")
+	assert.True(t, errors.Is(err, cdr.ErrInvalidParameter))
+}
+
+func TestR4ResolveReferenceForms(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Observation/obs-2", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "Observation",
+  "id": "obs-2",
+  "contained": [{"resourceType": "Patient", "id": "p1", "gender": "female"}],
+  "status": "final",
+  "code": {"coding": [{"system": "http://loinc.org", "code": "8867-4"}]},
+  "subject": {"reference": "#p1"},
+  "specimen": {"reference": "`+serverCDR.URL+`/store/fhir/other-org/Specimen/s1"},
+  "device": {"reference": "`+serverCDR.URL+`/store/fhir/`+cdrOrgID+`/Device/d1"}
+}`)
+	})
+	muxCDR.HandleFunc("/store/fhir/other-org/Specimen/s1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"resourceType": "Specimen", "id": "s1"}`)
+	})
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Device/d1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"resourceType": "Device", "id": "d1"}`)
+	})
+
+	observation, _, err := cdrClient.OperationsR4.Get("Observation/obs-2")
+	if !assert.Nil(t, err) {
+		return
+	}
+	patient, resp, err := cdrClient.OperationsR4.ResolveReference(observation, "subject")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Nil(t, resp)
+	assert.Equal(t, "p1", patient.GetPatient().GetId().GetValue())
+
+	specimen, resp, err := cdrClient.OperationsR4.ResolveReference(observation, "specimen")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, "s1", specimen.GetSpecimen().GetId().GetValue())
+
+	device, _, err := cdrClient.OperationsR4.ResolveReference(observation, "device")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "d1", device.GetDevice().GetId().GetValue())
+
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Observation/obs-3", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "Observation",
+  "id": "obs-3",
+  "status": "final",
+  "code": {"coding": [{"system": "http://loinc.org", "code": "8867-4"}]},
+  "subject": {"reference": "https://fhir.example.com/Patient/123"},
+  "device": {"reference": "#missing"}
+}`)
+	})
+	observation, _, err = cdrClient.OperationsR4.Get("Observation/obs-3")
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, _, err = cdrClient.OperationsR4.ResolveReference(observation, "subject")
+	assert.True(t, errors.Is(err, cdr.ErrInvalidReference))
+	_, _, err = cdrClient.OperationsR4.ResolveReference(observation, "device")
+	assert.True(t, errors.Is(err, cdr.ErrInvalidReference))
+}
+
+func TestR4CompartmentSearch(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	patientID := "a7fd5b3a-5ce6-4b58-b2d4-37d4d9a8f6b6"
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Patient/"+patientID+"/Observation", func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, http.MethodGet, r.Method) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		assert.Equal(t, "http://loinc.org|8867-4", r.URL.Query().Get("code"))
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "Bundle",
+  "type": "searchset",
+  "total": 1,
+  "entry": [
+    {
+      "resource": {
+        "resourceType": "Observation",
+        "id": "obs-1",
+        "status": "final",
+        "code": {"text": "Heart rate"}
+      }
+    }
+  ]
+}`)
+	})
+
+	entries, total, resp, err := cdrClient.OperationsR4.CompartmentSearch("Patient", patientID, "Observation", url.Values{"code": {"http://loinc.org|8867-4"}})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.NotNil(t, resp)
+	assert.Equal(t, 1, total)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "obs-1", entries[0].GetObservation().GetId().GetValue())
+	}
+
+	_, _, _, err = cdrClient.OperationsR4.CompartmentSearch("Patient", "", "Observation", nil)
+	assert.True(t, errors.Is(err, cdr.ErrInvalidParameter))
+}
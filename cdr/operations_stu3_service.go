@@ -2,12 +2,20 @@ package cdr
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
+	"github.com/google/fhir/go/fhirversion"
 	"github.com/google/fhir/go/jsonformat"
 	stu3pb "github.com/google/fhir/go/proto/google/fhir/proto/stu3/resources_go_proto"
+
+	"github.com/philips-software/go-hsdp-api/internal"
+	"google.golang.org/protobuf/proto"
 )
 
 type OperationsSTU3Service struct {
@@ -17,23 +25,81 @@ type OperationsSTU3Service struct {
 	um       *jsonformat.Unmarshaller
 }
 
-// Patch makes changes to a FHIR resources accepting the JSONPatch format set
+// WithTimeZone returns a copy of the service which localizes parsed dates and times
+// to timeZone instead of the client-wide Config.TimeZone
+func (o *OperationsSTU3Service) WithTimeZone(timeZone string) (*OperationsSTU3Service, error) {
+	timeZone, err := validateTimeZone(timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("OperationsSTU3Service.WithTimeZone: %w", err)
+	}
+	um, err := o.client.newUnmarshaller(timeZone, fhirversion.STU3)
+	if err != nil {
+		return nil, fmt.Errorf("OperationsSTU3Service.WithTimeZone (timezone=[%s]): %w", timeZone, err)
+	}
+	clone := *o
+	clone.timeZone = timeZone
+	clone.um = um
+	return &clone, nil
+}
+
+// WithRoundTripCheck returns an option for Post and Put which parses the request body,
+// marshals it again and fails locally with ErrRoundTrip when the result differs.
+// This catches resources the CDR would reject before they are sent
+func (o *OperationsSTU3Service) WithRoundTripCheck() OptionFunc {
+	return func(req *http.Request) error {
+		return checkRoundTrip(req, func(data []byte) (proto.Message, error) {
+			return o.um.UnmarshalR3(data)
+		}, o.ma.Marshal)
+	}
+}
+
+// Patch makes changes to a FHIR resources accepting the JSONPatch format set.
+// When a test operation of the patch fails or the resource changed since the
+// version of WithIfMatch the error wraps ErrPatchConflict. Read the resource
+// again and retry with a new patch
 func (o *OperationsSTU3Service) Patch(resourceID string, jsonPatch []byte, options ...OptionFunc) (*stu3pb.ContainedResource, *Response, error) {
-	req, err := o.client.newCDRRequest(http.MethodPatch, resourceID, jsonPatch, append([]OptionFunc{
+	return o.patch("Patch", resourceID, jsonPatch, "application/json-patch+json", options...)
+}
+
+// PatchConditional patches the single resourceType resource matching query. contentType is
+// the media type of patch and defaults to application/json-patch+json. When query matches
+// more than one resource an error wrapping ErrMultipleMatches is returned. See
+// Response.ConditionalOutcome
+func (o *OperationsSTU3Service) PatchConditional(resourceType string, query url.Values, patch []byte, contentType string, options ...OptionFunc) (*stu3pb.ContainedResource, *Response, error) {
+	if contentType == "" {
+		contentType = "application/json-patch+json"
+	}
+	contained, resp, err := o.patch("PatchConditional", resourceType, patch, contentType, append([]OptionFunc{
 		func(req *http.Request) error {
-			req.Header.Set("Content-Type", "application/json-patch+json")
+			req.URL.RawQuery = query.Encode()
+			return nil
+		},
+	}, options...)...)
+	if err != nil && resp != nil && resp.StatusCode() == http.StatusPreconditionFailed {
+		err = fmt.Errorf("OperationsSTU3Service.PatchConditional: %w: %v", ErrMultipleMatches, err)
+	}
+	return contained, resp, err
+}
+
+func (o *OperationsSTU3Service) patch(operation, resourceID string, body []byte, contentType string, options ...OptionFunc) (*stu3pb.ContainedResource, *Response, error) {
+	req, err := o.client.newCDRRequest(http.MethodPatch, resourceID, body, append([]OptionFunc{
+		func(req *http.Request) error {
+			req.Header.Set("Content-Type", contentType)
 			return nil
 		},
 	}, options...))
 	if err != nil {
 		return nil, nil, err
 	}
-	req.Header.Set("Accept", "application/fhir+json")
+	setDefaultAccept(req, "application/fhir+json")
 	var patchResponse bytes.Buffer
 	resp, err := o.client.do(req, &patchResponse)
 	if (err != nil && err != io.EOF) || resp == nil {
 		if resp == nil && err != nil {
-			err = fmt.Errorf("OperationsSTU3Service.Patch: %w", ErrEmptyResult)
+			err = fmt.Errorf("OperationsSTU3Service.%s: %w", operation, ErrEmptyResult)
+		}
+		if resp != nil && (resp.StatusCode() == http.StatusConflict || resp.StatusCode() == http.StatusPreconditionFailed) {
+			err = fmt.Errorf("OperationsSTU3Service.%s: %w: %v", operation, ErrPatchConflict, err)
 		}
 		return nil, resp, err
 	}
@@ -54,6 +120,26 @@ func (o *OperationsSTU3Service) Put(resourceID string, jsonBody []byte, options
 	return o.postOrPut(http.MethodPut, resourceID, jsonBody, options...)
 }
 
+// UpdateConditional creates or replaces the single resourceType resource matching query
+// using a FHIR conditional update. The returned bool reports whether the resource was
+// created. When query matches more than one resource an error wrapping
+// ErrMultipleMatches is returned. See Response.ConditionalOutcome
+func (o *OperationsSTU3Service) UpdateConditional(resourceType string, query url.Values, jsonBody []byte, options ...OptionFunc) (*stu3pb.ContainedResource, bool, *Response, error) {
+	contained, resp, err := o.postOrPut(http.MethodPut, resourceType, jsonBody, append([]OptionFunc{
+		func(req *http.Request) error {
+			req.URL.RawQuery = query.Encode()
+			return nil
+		},
+	}, options...)...)
+	if err != nil {
+		if resp != nil && resp.StatusCode() == http.StatusPreconditionFailed {
+			err = fmt.Errorf("OperationsSTU3Service.UpdateConditional: %w: %v", ErrMultipleMatches, err)
+		}
+		return nil, false, resp, err
+	}
+	return contained, resp.Created(), resp, nil
+}
+
 // Get returns a FHIR resource
 func (o *OperationsSTU3Service) Get(resourceID string, options ...OptionFunc) (*stu3pb.ContainedResource, *Response, error) {
 	req, err := o.client.newCDRRequest(http.MethodGet, resourceID, nil, append([]OptionFunc{
@@ -65,7 +151,7 @@ func (o *OperationsSTU3Service) Get(resourceID string, options ...OptionFunc) (*
 	if err != nil {
 		return nil, nil, err
 	}
-	req.Header.Set("Accept", "application/fhir+json")
+	setDefaultAccept(req, "application/fhir+json")
 	var operationResponse bytes.Buffer
 	resp, err := o.client.do(req, &operationResponse)
 	if (err != nil && err != io.EOF) || resp == nil {
@@ -74,6 +160,9 @@ func (o *OperationsSTU3Service) Get(resourceID string, options ...OptionFunc) (*
 		}
 		return nil, resp, err
 	}
+	if resp.StatusCode() == http.StatusNotModified {
+		return nil, resp, ErrNotModified
+	}
 	contained, err := o.um.UnmarshalR3(operationResponse.Bytes())
 	if err != nil {
 		return nil, resp, fmt.Errorf("FHIR unmarshal: %w", err)
@@ -81,6 +170,118 @@ func (o *OperationsSTU3Service) Get(resourceID string, options ...OptionFunc) (*
 	return contained, resp, nil
 }
 
+// ReadIfNoneMatch gets the resourceType resource with the given id unless its current
+// version matches etag, the ETag header of an earlier read or its version id. ErrNotModified
+// is returned together with the response when the cached version is still current
+func (o *OperationsSTU3Service) ReadIfNoneMatch(resourceType, id, etag string, options ...OptionFunc) (*stu3pb.ContainedResource, *Response, error) {
+	return o.Get(resourceType+"/"+id, append([]OptionFunc{
+		func(req *http.Request) error {
+			req.Header.Set("If-None-Match", ETag(etag))
+			return nil
+		},
+	}, options...)...)
+}
+
+// ReadRaw returns the resourceType resource with the given id as the untouched JSON
+// response body. Use it to pass resources on without unmarshalling them
+func (o *OperationsSTU3Service) ReadRaw(resourceType, id string, options ...OptionFunc) ([]byte, *Response, error) {
+	return o.doRaw("ReadRaw", http.MethodGet, resourceType+"/"+id, nil, options...)
+}
+
+// CreateRaw creates a resourceType resource from the FHIR JSON in body without
+// parsing it and returns the untouched response body
+func (o *OperationsSTU3Service) CreateRaw(resourceType string, body []byte, options ...OptionFunc) ([]byte, *Response, error) {
+	return o.doRaw("CreateRaw", http.MethodPost, resourceType, body, options...)
+}
+
+// UpdateRaw creates or replaces the resourceType resource with the given id using
+// the FHIR JSON in body without parsing it and returns the untouched response body
+func (o *OperationsSTU3Service) UpdateRaw(resourceType, id string, body []byte, options ...OptionFunc) ([]byte, *Response, error) {
+	return o.doRaw("UpdateRaw", http.MethodPut, resourceType+"/"+id, body, options...)
+}
+
+// RawRequest sends body to path, relative to the FHIR store of the tenant, using method and
+// returns the untouched response body. It is meant for CDR operations this package does not
+// model yet, e.g. RawRequest(http.MethodPost, "Patient/123/$custom-op", body). Leave path
+// empty for the store itself. JSON bodies are sent as FHIR, use an option to set another
+// Content-Type or Accept header. Error responses are returned as errors, see OperationOutcomeError
+func (o *OperationsSTU3Service) RawRequest(method, path string, body []byte, options ...OptionFunc) ([]byte, *Response, error) {
+	if path == "" {
+		options = append([]OptionFunc{
+			func(req *http.Request) error {
+				req.URL.Opaque = strings.TrimSuffix(req.URL.Opaque, "/")
+				return nil
+			},
+		}, options...)
+	}
+	return o.doRaw("RawRequest", method, path, body, options...)
+}
+
+func (o *OperationsSTU3Service) doRaw(operation, method, resourceID string, body []byte, options ...OptionFunc) ([]byte, *Response, error) {
+	req, err := o.client.newCDRRequest(method, resourceID, body, append([]OptionFunc{
+		func(req *http.Request) error {
+			if body != nil {
+				req.Header.Set("Content-Type", "application/fhir+json")
+			}
+			return nil
+		},
+	}, options...))
+	if err != nil {
+		return nil, nil, err
+	}
+	setDefaultAccept(req, "application/fhir+json")
+	var operationResponse bytes.Buffer
+	resp, err := o.client.do(req, &operationResponse)
+	if (err != nil && err != io.EOF) || resp == nil {
+		if resp == nil && err != nil {
+			err = fmt.Errorf("OperationsSTU3Service.%s: %w", operation, ErrEmptyResult)
+		}
+		return nil, resp, err
+	}
+	return operationResponse.Bytes(), resp, nil
+}
+
+// ResolveReference reads the resource referenced by the Reference element field of
+// resource, e.g. the subject of an Observation. resource can also be a ContainedResource.
+// Relative Type/id references are read from the tenant. Contained #id references are taken from
+// the contained resources of resource, without a request so the Response is nil. Absolute
+// references are read from their URL, which must be on the host of the FHIR store
+func (o *OperationsSTU3Service) ResolveReference(resource proto.Message, field string, options ...OptionFunc) (*stu3pb.ContainedResource, *Response, error) {
+	marshal := o.ma.MarshalResource
+	if _, ok := resource.(*stu3pb.ContainedResource); ok {
+		marshal = o.ma.Marshal
+	}
+	data, err := marshal(resource)
+	if err != nil {
+		return nil, nil, fmt.Errorf("OperationsSTU3Service.ResolveReference: %w", err)
+	}
+	reference, err := referenceField(data, field)
+	if err != nil {
+		return nil, nil, fmt.Errorf("OperationsSTU3Service.ResolveReference: %w", err)
+	}
+	form, target, err := o.client.referenceTarget(reference)
+	if err != nil {
+		return nil, nil, fmt.Errorf("OperationsSTU3Service.ResolveReference: %w", err)
+	}
+	var resp *Response
+	switch form {
+	case referenceContained:
+		data, err = containedResource(data, target)
+	case referenceAbsolute:
+		data, resp, err = o.doRaw("ResolveReference", http.MethodGet, "", nil, append([]OptionFunc{withAbsoluteURL(target)}, options...)...)
+	default:
+		return o.Get(target, options...)
+	}
+	if err != nil {
+		return nil, resp, fmt.Errorf("OperationsSTU3Service.ResolveReference: %w", err)
+	}
+	contained, err := o.um.UnmarshalR3(data)
+	if err != nil {
+		return nil, resp, fmt.Errorf("FHIR unmarshal: %w", err)
+	}
+	return contained, resp, nil
+}
+
 // Delete removes a FHIR resource
 func (o *OperationsSTU3Service) Delete(resourceID string, options ...OptionFunc) (bool, *Response, error) {
 	req, err := o.client.newCDRRequest(http.MethodDelete, resourceID, nil, append([]OptionFunc{
@@ -92,7 +293,7 @@ func (o *OperationsSTU3Service) Delete(resourceID string, options ...OptionFunc)
 	if err != nil {
 		return false, nil, err
 	}
-	req.Header.Set("Accept", "application/fhir+json")
+	setDefaultAccept(req, "application/fhir+json")
 	var operationResponse bytes.Buffer
 	resp, err := o.client.do(req, &operationResponse)
 	if (err != nil && err != io.EOF) || resp == nil {
@@ -104,6 +305,316 @@ func (o *OperationsSTU3Service) Delete(resourceID string, options ...OptionFunc)
 	return resp.StatusCode() == http.StatusNoContent, resp, nil
 }
 
+// Search searches for resources of resourceType matching query. A successful search
+// without matches returns an empty list, a total of 0 and a nil error. The total is the
+// Bundle total or, when it is absent, the number of entries. When _total=none was
+// requested, see WithTotal, an absent total is returned as TotalUnknown
+func (o *OperationsSTU3Service) Search(resourceType string, query url.Values, options ...OptionFunc) ([]*stu3pb.ContainedResource, int, *Response, error) {
+	req, err := o.client.newCDRRequest(http.MethodGet, resourceType, nil, append([]OptionFunc{
+		func(req *http.Request) error {
+			req.Header.Set("Content-Type", "application/fhir+json")
+			req.URL.RawQuery = query.Encode()
+			return nil
+		},
+	}, options...))
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return o.search("Search", req, req.URL.Query())
+}
+
+// SearchByPost is Search using POST [type]/_search with params sent as a form body instead
+// of in the URL, e.g. for searches with many _has parameters which exceed URL length limits.
+// Search parameters set by options, like WithTotal, are sent in the body as well
+func (o *OperationsSTU3Service) SearchByPost(resourceType string, params url.Values, options ...OptionFunc) ([]*stu3pb.ContainedResource, int, *Response, error) {
+	var form url.Values
+	req, err := o.client.newCDRRequest(http.MethodPost, resourceType+"/_search", nil, append(append([]OptionFunc{
+		func(req *http.Request) error {
+			req.URL.RawQuery = params.Encode()
+			return nil
+		},
+	}, options...), func(req *http.Request) error {
+		form = req.URL.Query()
+		req.URL.RawQuery = ""
+		body := []byte(form.Encode())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return nil
+	}))
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return o.search("SearchByPost", req, form)
+}
+
+// CompartmentSearch searches for resources of resourceType in the compartment of the
+// compartmentType resource with compartmentID, e.g. the Observations of a patient with
+// GET Patient/123/Observation?code=... An empty resourceType searches all resource types
+// of the compartment. The results are those of Search
+func (o *OperationsSTU3Service) CompartmentSearch(compartmentType, compartmentID, resourceType string, params url.Values, options ...OptionFunc) ([]*stu3pb.ContainedResource, int, *Response, error) {
+	if compartmentType == "" || compartmentID == "" {
+		return nil, 0, nil, fmt.Errorf("OperationsSTU3Service.CompartmentSearch: %w: compartment type and id are required", ErrInvalidParameter)
+	}
+	if resourceType == "" {
+		resourceType = "*"
+	}
+	path := compartmentType + "/" + url.PathEscape(compartmentID) + "/" + resourceType
+	req, err := o.client.newCDRRequest(http.MethodGet, path, nil, append([]OptionFunc{
+		func(req *http.Request) error {
+			req.Header.Set("Content-Type", "application/fhir+json")
+			req.URL.RawQuery = params.Encode()
+			return nil
+		},
+	}, options...))
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return o.search("CompartmentSearch", req, req.URL.Query())
+}
+
+// search sends the search request req with the search parameters params and returns the
+// resources of the searchset Bundle together with its total
+func (o *OperationsSTU3Service) search(operation string, req *http.Request, params url.Values) ([]*stu3pb.ContainedResource, int, *Response, error) {
+	setDefaultAccept(req, "application/fhir+json")
+	var searchResponse bytes.Buffer
+	resp, err := o.client.do(req, &searchResponse)
+	if (err != nil && err != io.EOF) || resp == nil {
+		if resp == nil && err != nil {
+			err = fmt.Errorf("OperationsSTU3Service.%s: %w", operation, ErrEmptyResult)
+		}
+		return nil, 0, resp, err
+	}
+	summary := params.Get("_summary")
+	if summary == SummaryCount { // Only the total is returned
+		var bundle internal.Bundle
+		if err := json.Unmarshal(searchResponse.Bytes(), &bundle); err != nil {
+			return nil, 0, resp, fmt.Errorf("OperationsSTU3Service.%s: %w", operation, err)
+		}
+		return []*stu3pb.ContainedResource{}, int(bundle.Total), resp, nil
+	}
+	um := o.um
+	if summary != "" && summary != SummaryFalse { // SUBSETTED resources can miss required elements
+		um, err = jsonformat.NewUnmarshallerWithoutValidation(o.timeZone, fhirversion.STU3)
+		if err != nil {
+			return nil, 0, resp, fmt.Errorf("OperationsSTU3Service.%s: %w", operation, err)
+		}
+	}
+	contained, err := um.UnmarshalR3(searchResponse.Bytes())
+	if err != nil {
+		return nil, 0, resp, fmt.Errorf("FHIR unmarshal: %w", err)
+	}
+	bundle := contained.GetBundle()
+	if bundle == nil {
+		return nil, 0, resp, fmt.Errorf("OperationsSTU3Service.%s: %w", operation, ErrNotABundle)
+	}
+	entries := make([]*stu3pb.ContainedResource, 0, len(bundle.GetEntry()))
+	for _, entry := range bundle.GetEntry() {
+		if entry.GetResource() != nil {
+			entries = append(entries, entry.GetResource())
+		}
+	}
+	total := len(entries)
+	if params.Get(SearchParamTotal) == TotalNone {
+		total = TotalUnknown
+	}
+	if bundle.GetTotal() != nil {
+		total = int(bundle.GetTotal().GetValue())
+	}
+	return entries, total, resp, nil
+}
+
+// Count returns the number of resourceType resources matching query. Only the
+// Bundle total is requested using _summary=count so no resources are transferred
+func (o *OperationsSTU3Service) Count(resourceType string, query url.Values, options ...OptionFunc) (int, *Response, error) {
+	_, total, resp, err := o.Search(resourceType, query, append(append([]OptionFunc{}, options...), WithSummary(SummaryCount))...)
+	return total, resp, err
+}
+
+// LastN calls the Observation $lastn operation which returns the most recent
+// Observations per code. Supported parameters include max, patient, subject,
+// category and code
+func (o *OperationsSTU3Service) LastN(params url.Values, options ...OptionFunc) ([]*stu3pb.ContainedResource, *Response, error) {
+	if maxValue := params.Get("max"); maxValue != "" {
+		if n, err := strconv.Atoi(maxValue); err != nil || n < 1 {
+			return nil, nil, fmt.Errorf("OperationsSTU3Service.LastN: %w: max [%s]", ErrInvalidParameter, maxValue)
+		}
+	}
+	entries, _, resp, err := o.Search("Observation/$lastn", params, options...)
+	return entries, resp, err
+}
+
+// Batch posts a batch or transaction bundle and returns the result of every entry.
+// The CDR responds to a batch with 200 OK even when entries fail, so check
+// BatchEntryResult.Failed to find the entries to retry. An error wrapping
+// ErrBatchFailed is only returned when every entry failed. Use ResolvePlaceholders
+// to find the resources created by a transaction
+func (o *OperationsSTU3Service) Batch(bundle []byte, options ...OptionFunc) ([]BatchEntryResult, *Response, error) {
+	req, err := o.client.newCDRRequest(http.MethodPost, "", bundle, append([]OptionFunc{o.batchOptions()}, options...))
+	if err != nil {
+		return nil, nil, err
+	}
+	return o.batch(req)
+}
+
+// BatchStream is Batch with the bundle read from body while it is sent instead of being
+// held in memory, e.g. for very large transaction bundles. length is the size of body in
+// bytes, -1 when it is not known in which case the bundle is sent chunked. As body can not
+// be replayed a 401 Unauthorized is not retried after refreshing the token like other
+// requests are. Options which inspect the body, like WithRoundTripCheck, and a DebugLog
+// read the whole bundle into memory
+func (o *OperationsSTU3Service) BatchStream(body io.Reader, length int64, options ...OptionFunc) ([]BatchEntryResult, *Response, error) {
+	req, err := o.client.newCDRStreamRequest(http.MethodPost, "", body, length, append([]OptionFunc{o.batchOptions()}, options...))
+	if err != nil {
+		return nil, nil, err
+	}
+	return o.batch(req)
+}
+
+func (o *OperationsSTU3Service) batchOptions() OptionFunc {
+	return func(req *http.Request) error {
+		req.Header.Set("Content-Type", "application/fhir+json")
+		req.URL.Opaque = strings.TrimSuffix(req.URL.Opaque, "/")
+		return nil
+	}
+}
+
+func (o *OperationsSTU3Service) batch(req *http.Request) ([]BatchEntryResult, *Response, error) {
+	setDefaultAccept(req, "application/fhir+json")
+	var batchResponse bytes.Buffer
+	resp, err := o.client.do(req, &batchResponse)
+	if (err != nil && err != io.EOF) || resp == nil {
+		if resp == nil && err != nil {
+			err = fmt.Errorf("OperationsSTU3Service.Batch: %w", ErrEmptyResult)
+		}
+		return nil, resp, err
+	}
+	contained, err := o.um.UnmarshalR3(batchResponse.Bytes())
+	if err != nil {
+		return nil, resp, fmt.Errorf("FHIR unmarshal: %w", err)
+	}
+	responseBundle := contained.GetBundle()
+	if responseBundle == nil {
+		return nil, resp, fmt.Errorf("OperationsSTU3Service.Batch: %w", ErrNotABundle)
+	}
+	results := make([]BatchEntryResult, 0, len(responseBundle.GetEntry()))
+	for i, entry := range responseBundle.GetEntry() {
+		response := entry.GetResponse()
+		result := BatchEntryResult{
+			Index:    i,
+			Status:   parseBatchStatus(response.GetStatus().GetValue()),
+			Location: response.GetLocation().GetValue(),
+			ETag:     response.GetEtag().GetValue(),
+		}
+		if outcome := response.GetOutcome().GetOperationOutcome(); outcome != nil {
+			result.Outcome = outcome
+			for _, issue := range outcome.GetIssue() {
+				result.outcomeFailed = result.outcomeFailed || o.client.failsOn(issue.GetSeverity().GetValue().String())
+			}
+		}
+		results = append(results, result)
+	}
+	return results, resp, batchError("OperationsSTU3Service.Batch", results)
+}
+
+// Transaction posts the transaction bundle with its Bundle.identifier set to system and
+// value so the server can detect a retried submission. Use a stable value per logical
+// transaction, e.g. the id of the ingested message. When the server reports the transaction
+// as processed before an error wrapping ErrAlreadyProcessed is returned, which a retry
+// can treat as success. The results are those of Batch. The server may process the entries
+// in another order than they are in the bundle, see WithStrictOrder
+func (o *OperationsSTU3Service) Transaction(bundle []byte, system, value string, options ...OptionFunc) ([]BatchEntryResult, *Response, error) {
+	bundle, err := withBundleIdentifier(bundle, system, value)
+	if err != nil {
+		return nil, nil, fmt.Errorf("OperationsSTU3Service.Transaction: %w", err)
+	}
+	results, resp, err := o.Batch(bundle, options...)
+	if err != nil {
+		return results, resp, alreadyProcessed(err)
+	}
+	return results, resp, nil
+}
+
+// InvokeOperation POSTs params to the FHIR operation, e.g. $process-message or $apply,
+// of the resourceType instance with id. Leave id empty for type level and both
+// resourceType and id empty for system level operations. The result is often a
+// Parameters resource or an OperationOutcome
+func (o *OperationsSTU3Service) InvokeOperation(resourceType, id, operation string, params *stu3pb.Parameters, options ...OptionFunc) (*stu3pb.ContainedResource, *Response, error) {
+	if operation == "" || operation == "$" {
+		return nil, nil, fmt.Errorf("OperationsSTU3Service.InvokeOperation: %w: missing operation", ErrInvalidParameter)
+	}
+	if params == nil {
+		params = &stu3pb.Parameters{}
+	}
+	jsonBody, err := o.ma.MarshalResource(params)
+	if err != nil {
+		return nil, nil, fmt.Errorf("OperationsSTU3Service.InvokeOperation: %w", err)
+	}
+	return o.postOrPut(http.MethodPost, operationPath(resourceType, id, operation), jsonBody, options...)
+}
+
+// Expunge physically removes the resourceType resource with id and its history using the
+// $expunge operation, e.g. to honour an erasure request. Leave id empty to expunge on the
+// type level. Unlike Delete this cannot be undone. The returned OperationOutcome summarizes
+// what was removed
+func (o *OperationsSTU3Service) Expunge(resourceType, id string, params ExpungeParams, options ...OptionFunc) (*stu3pb.OperationOutcome, *Response, error) {
+	if resourceType == "" {
+		return nil, nil, fmt.Errorf("OperationsSTU3Service.Expunge: %w: missing resourceType", ErrInvalidParameter)
+	}
+	jsonBody, err := expungeParameters(params)
+	if err != nil {
+		return nil, nil, fmt.Errorf("OperationsSTU3Service.Expunge: %w", err)
+	}
+	contained, resp, err := o.postOrPut(http.MethodPost, operationPath(resourceType, id, "$expunge"), jsonBody, options...)
+	if err != nil {
+		return nil, resp, err
+	}
+	outcome := contained.GetOperationOutcome()
+	if outcome == nil {
+		return nil, resp, fmt.Errorf("OperationsSTU3Service.Expunge: %w", ErrNotAnOutcome)
+	}
+	return outcome, resp, nil
+}
+
+// Diff returns the field-level changes between the fromVersion and toVersion of the
+// resourceType resource with id using the $diff operation, e.g. to show what changed to
+// an audit user. Leave fromVersion empty for the predecessor of toVersion and toVersion
+// empty for the current version
+func (o *OperationsSTU3Service) Diff(resourceType, id, fromVersion, toVersion string, options ...OptionFunc) ([]DiffOperation, *Response, error) {
+	if resourceType == "" || id == "" {
+		return nil, nil, fmt.Errorf("OperationsSTU3Service.Diff: %w: missing resourceType or id", ErrInvalidParameter)
+	}
+	body, resp, err := o.doRaw("Diff", http.MethodGet, operationPath(resourceType, id, "$diff"), nil,
+		append([]OptionFunc{diffOptions(fromVersion, toVersion)}, options...)...)
+	if err != nil {
+		return nil, resp, err
+	}
+	operations, err := parseDiff(body)
+	if err != nil {
+		return nil, resp, fmt.Errorf("OperationsSTU3Service.Diff: %w", err)
+	}
+	return operations, resp, nil
+}
+
+// PostMultipartRelated creates a resourceType resource from a multipart/related body with
+// resource as the root part followed by attachments. It is used for documents, e.g. a
+// DocumentReference, which refer to their binary content by Content-ID
+func (o *OperationsSTU3Service) PostMultipartRelated(resourceType string, resource []byte, attachments []Attachment, options ...OptionFunc) (*stu3pb.ContainedResource, *Response, error) {
+	body, contentType, err := multipartRelated(resource, "application/fhir+json", attachments)
+	if err != nil {
+		return nil, nil, fmt.Errorf("OperationsSTU3Service.PostMultipartRelated: %w", err)
+	}
+	return o.postOrPut(http.MethodPost, resourceType, body, append([]OptionFunc{
+		func(req *http.Request) error {
+			req.Header.Set("Content-Type", contentType)
+			return nil
+		},
+	}, options...)...)
+}
+
 func (o *OperationsSTU3Service) postOrPut(method, resourceID string, jsonBody []byte, options ...OptionFunc) (*stu3pb.ContainedResource, *Response, error) {
 	req, err := o.client.newCDRRequest(method, resourceID, jsonBody, append([]OptionFunc{
 		func(req *http.Request) error {
@@ -114,7 +625,7 @@ func (o *OperationsSTU3Service) postOrPut(method, resourceID string, jsonBody []
 	if err != nil {
 		return nil, nil, err
 	}
-	req.Header.Set("Accept", "application/fhir+json")
+	setDefaultAccept(req, "application/fhir+json")
 	var operationResponse bytes.Buffer
 	resp, err := o.client.do(req, &operationResponse)
 	if (err != nil && err != io.EOF) || resp == nil {
@@ -130,5 +641,20 @@ func (o *OperationsSTU3Service) postOrPut(method, resourceID string, jsonBody []
 	if err != nil {
 		return nil, resp, fmt.Errorf("FHIR unmarshal: %w", err)
 	}
+	if contained.GetOperationOutcome() != nil {
+		return contained, resp, o.client.checkOutcome(resp, operationResponse.Bytes())
+	}
 	return contained, resp, nil
 }
+
+func (o *OperationsSTU3Service) marshalResource(resource proto.Message) ([]byte, error) {
+	return o.ma.MarshalResource(resource)
+}
+
+func (o *OperationsSTU3Service) postResource(resourceType string, jsonBody []byte, options ...OptionFunc) (proto.Message, *Response, error) {
+	return o.Post(resourceType, jsonBody, options...)
+}
+
+func (o *OperationsSTU3Service) putResource(resourceID string, jsonBody []byte, options ...OptionFunc) (proto.Message, *Response, error) {
+	return o.Put(resourceID, jsonBody, options...)
+}
@@ -0,0 +1,235 @@
+package cdr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Values of the FHIR _summary search parameter
+const (
+	SummaryTrue  = "true"
+	SummaryText  = "text"
+	SummaryData  = "data"
+	SummaryCount = "count"
+	SummaryFalse = "false"
+)
+
+// WithSummary sets the FHIR _summary search parameter. The server then returns
+// SUBSETTED resources or, in case of SummaryCount, only the total number of matches
+func WithSummary(summary string) OptionFunc {
+	return func(req *http.Request) error {
+		switch summary {
+		case SummaryTrue, SummaryText, SummaryData, SummaryCount, SummaryFalse:
+		default:
+			return fmt.Errorf("WithSummary: %w: [%s]", ErrInvalidParameter, summary)
+		}
+		q := req.URL.Query()
+		q.Set("_summary", summary)
+		req.URL.RawQuery = q.Encode()
+		return nil
+	}
+}
+
+// WithTotal sets the _total search parameter to TotalAccurate, TotalEstimate or
+// TotalNone. TotalNone saves the server from counting high-cardinality matches
+func WithTotal(total string) OptionFunc {
+	return func(req *http.Request) error {
+		switch total {
+		case TotalAccurate, TotalEstimate, TotalNone:
+		default:
+			return fmt.Errorf("WithTotal: %w: [%s]", ErrInvalidParameter, total)
+		}
+		q := req.URL.Query()
+		q.Set(SearchParamTotal, total)
+		req.URL.RawQuery = q.Encode()
+		return nil
+	}
+}
+
+// WithContained sets the _contained search parameter to ContainedFalse, ContainedTrue
+// or ContainedBoth and, unless empty, _containedType to ContainedTypeContainer or
+// ContainedTypeContained. Contained resources are part of the returned entries
+func WithContained(contained, containedType string) OptionFunc {
+	return func(req *http.Request) error {
+		switch contained {
+		case ContainedFalse, ContainedTrue, ContainedBoth:
+		default:
+			return fmt.Errorf("WithContained: %w: [%s]", ErrInvalidParameter, contained)
+		}
+		switch containedType {
+		case "", ContainedTypeContainer, ContainedTypeContained:
+		default:
+			return fmt.Errorf("WithContained: %w: type [%s]", ErrInvalidParameter, containedType)
+		}
+		q := req.URL.Query()
+		q.Set(SearchParamContained, contained)
+		if containedType != "" {
+			q.Set(SearchParamContainedType, containedType)
+		}
+		req.URL.RawQuery = q.Encode()
+		return nil
+	}
+}
+
+// WithQueryParam adds a query parameter to the request, e.g. the FHIR _format or
+// _pretty parameters when debugging against a store. Parameters passed to Search
+// are kept
+func WithQueryParam(key, value string) OptionFunc {
+	return func(req *http.Request) error {
+		q := req.URL.Query()
+		q.Add(key, value)
+		req.URL.RawQuery = q.Encode()
+		return nil
+	}
+}
+
+// CorrelationIDHeader is the header WithCorrelationID sets
+const CorrelationIDHeader = "X-Correlation-Id"
+
+// WithHeader sets the request header key to value, e.g. to propagate tracing headers
+func WithHeader(key, value string) OptionFunc {
+	return func(req *http.Request) error {
+		req.Header.Set(key, value)
+		return nil
+	}
+}
+
+// WithCorrelationID sets the X-Correlation-Id header so the request can be found in
+// the HSDP logs. The id is also part of the debug log and of the RequestLog
+func WithCorrelationID(id string) OptionFunc {
+	return WithHeader(CorrelationIDHeader, id)
+}
+
+// WithAccept overrides the Accept header of the request. By default requests accept
+// application/fhir+json for the FHIR version of the service. Responses are still
+// parsed as FHIR JSON so mediaType should select a JSON representation
+func WithAccept(mediaType string) OptionFunc {
+	return func(req *http.Request) error {
+		req.Header.Set("Accept", mediaType)
+		return nil
+	}
+}
+
+// WithBearerToken authorizes the request with token instead of a token of the IAM
+// client, e.g. for contract tests. A client created without an IAM client requires it
+// on every request
+func WithBearerToken(token string) OptionFunc {
+	return func(req *http.Request) error {
+		if token == "" {
+			return fmt.Errorf("WithBearerToken: %w", ErrMissingToken)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+}
+
+// ProvenanceHeader is the header of the FHIR Provenance resource of a write, see WithProvenance
+const ProvenanceHeader = "X-Provenance"
+
+// WithProvenance attributes a write to the JSON FHIR Provenance resource provenance by
+// sending it in the X-Provenance header. The target of the Provenance is filled in by the
+// server. It fails for requests which do not write
+func WithProvenance(provenance []byte) OptionFunc {
+	return func(req *http.Request) error {
+		switch req.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			return fmt.Errorf("WithProvenance: %w: method [%s]", ErrInvalidParameter, req.Method)
+		}
+		var resource struct {
+			ResourceType string `json:"resourceType"`
+		}
+		if err := json.Unmarshal(provenance, &resource); err != nil || resource.ResourceType != "Provenance" {
+			return fmt.Errorf("WithProvenance: %w: not a Provenance resource", ErrInvalidParameter)
+		}
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, provenance); err != nil {
+			return fmt.Errorf("WithProvenance: %w", err)
+		}
+		req.Header.Set(ProvenanceHeader, compact.String())
+		return nil
+	}
+}
+
+// WithAcceptLanguage sets the Accept-Language header, e.g. "de-DE", so stores which
+// localize OperationOutcome diagnostics return them in that language. It overrides
+// Config.AcceptLanguage
+func WithAcceptLanguage(tag string) OptionFunc {
+	return WithHeader("Accept-Language", tag)
+}
+
+// WithValidateOnly turns a Post or Put into a call of the FHIR $validate operation
+// of the resource. Nothing is persisted and the returned resource is the
+// OperationOutcome of the validation. A Put is validated with mode=update
+func WithValidateOnly() OptionFunc {
+	return func(req *http.Request) error {
+		switch req.Method {
+		case http.MethodPost:
+		case http.MethodPut:
+			req.Method = http.MethodPost
+			q := req.URL.Query()
+			q.Set("mode", "update")
+			req.URL.RawQuery = q.Encode()
+		default:
+			return fmt.Errorf("WithValidateOnly: %w: method [%s]", ErrInvalidParameter, req.Method)
+		}
+		req.URL.Opaque = strings.TrimSuffix(req.URL.Opaque, "/") + "/$validate"
+		return nil
+	}
+}
+
+// WithIfModifiedSince sets the If-Modified-Since header so stores which honor it only
+// return resources changed after t. Combine it with a SearchParamLastUpdated filter
+// for stores which do not
+func WithIfModifiedSince(t time.Time) OptionFunc {
+	return func(req *http.Request) error {
+		req.Header.Set("If-Modified-Since", t.UTC().Format(http.TimeFormat))
+		return nil
+	}
+}
+
+// WithContext runs the request with the provided context
+func WithContext(ctx context.Context) OptionFunc {
+	return func(req *http.Request) error {
+		*req = *req.WithContext(ctx)
+		return nil
+	}
+}
+
+// checkRoundTrip unmarshals the FHIR body of req, marshals the result again and
+// verifies the re-parsed resource is identical. The body is restored afterwards
+func checkRoundTrip(req *http.Request, unmarshal func([]byte) (proto.Message, error), marshal func(proto.Message) ([]byte, error)) error {
+	if req.Body == nil || !strings.HasPrefix(req.Header.Get("Content-Type"), "application/fhir+json") {
+		return nil
+	}
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	first, err := unmarshal(body)
+	if err != nil {
+		return fmt.Errorf("%w: unmarshal: %v", ErrRoundTrip, err)
+	}
+	remarshalled, err := marshal(first)
+	if err != nil {
+		return fmt.Errorf("%w: marshal: %v", ErrRoundTrip, err)
+	}
+	second, err := unmarshal(remarshalled)
+	if err != nil {
+		return fmt.Errorf("%w: unmarshal: %v", ErrRoundTrip, err)
+	}
+	if !proto.Equal(first, second) {
+		return fmt.Errorf("%w: resource changed after marshalling", ErrRoundTrip)
+	}
+	return nil
+}
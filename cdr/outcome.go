@@ -0,0 +1,118 @@
+package cdr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// OutcomeIssue is an issue of an OperationOutcome returned by CDR. Expression holds the
+// FHIRPath expressions of the elements the issue is about, Location their XPath
+type OutcomeIssue struct {
+	Severity    string   `json:"severity"`
+	Code        string   `json:"code"`
+	Diagnostics string   `json:"diagnostics,omitempty"`
+	Expression  []string `json:"expression,omitempty"`
+	Location    []string `json:"location,omitempty"`
+}
+
+// OperationOutcomeError is returned when CDR answers a request with an error status and an
+// OperationOutcome body. Use errors.As to get the issues, e.g. to map failed validations back
+// to input fields. The error message is the one of the underlying response error
+type OperationOutcomeError struct {
+	StatusCode int
+	Issues     []OutcomeIssue
+	err        error
+}
+
+func (e *OperationOutcomeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *OperationOutcomeError) Unwrap() error {
+	return e.err
+}
+
+// operationOutcomeError wraps err in an OperationOutcomeError when the body of resp is an
+// OperationOutcome. The body is restored so it can still be read by the caller
+func operationOutcomeError(resp *http.Response, err error) error {
+	if resp.Body == nil {
+		return err
+	}
+	data, readErr := io.ReadAll(resp.Body)
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	if readErr != nil {
+		return err
+	}
+	issues, ok := outcomeIssues(data)
+	if !ok {
+		return err
+	}
+	return &OperationOutcomeError{StatusCode: resp.StatusCode, Issues: issues, err: err}
+}
+
+// outcomeIssues returns the issues of data when it is an OperationOutcome
+func outcomeIssues(data []byte) ([]OutcomeIssue, bool) {
+	var outcome struct {
+		ResourceType string         `json:"resourceType"`
+		Issue        []OutcomeIssue `json:"issue"`
+	}
+	if json.Unmarshal(data, &outcome) != nil || outcome.ResourceType != "OperationOutcome" {
+		return nil, false
+	}
+	return outcome.Issue, true
+}
+
+// OperationOutcome issue severities, see Config.FailOnSeverity
+const (
+	SeverityFatal       = "fatal"
+	SeverityError       = "error"
+	SeverityWarning     = "warning"
+	SeverityInformation = "information"
+)
+
+// severityRank orders severities from information up to fatal. Unknown severities rank lowest
+func severityRank(severity string) int {
+	switch strings.ToLower(severity) {
+	case SeverityFatal:
+		return 4
+	case SeverityError:
+		return 3
+	case SeverityWarning:
+		return 2
+	case SeverityInformation:
+		return 1
+	}
+	return 0
+}
+
+// failsOn reports whether an issue of severity makes an operation fail given Config.FailOnSeverity
+func (c *Client) failsOn(severity string) bool {
+	threshold := c.config.FailOnSeverity
+	if threshold == "" {
+		threshold = SeverityError
+	}
+	return severityRank(severity) >= severityRank(threshold)
+}
+
+// checkOutcome returns an OperationOutcomeError wrapping ErrOutcomeSeverity when data, the body
+// of a successful response, is an OperationOutcome with an issue at or above Config.FailOnSeverity
+func (c *Client) checkOutcome(resp *Response, data []byte) error {
+	issues, ok := outcomeIssues(data)
+	if !ok {
+		return nil
+	}
+	for _, issue := range issues {
+		if c.failsOn(issue.Severity) {
+			return &OperationOutcomeError{
+				StatusCode: resp.StatusCode(),
+				Issues:     issues,
+				err:        fmt.Errorf("%w: %s: %s", ErrOutcomeSeverity, issue.Severity, issue.Diagnostics),
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package cdr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ParseReference splits a relative FHIR reference of the form Type/id into its
+// resource type and id. Contained (#id), versioned and absolute references are
+// not supported and return an error wrapping ErrInvalidReference
+func ParseReference(reference string) (string, string, error) {
+	parts := strings.Split(reference, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || strings.ContainsAny(parts[0], ":#") {
+		return "", "", fmt.Errorf("%w: [%s]", ErrInvalidReference, reference)
+	}
+	return parts[0], parts[1], nil
+}
+
+// referenceField returns the reference of the Reference element field of the JSON resource in data
+func referenceField(data []byte, field string) (string, error) {
+	var resource map[string]json.RawMessage
+	if err := json.Unmarshal(data, &resource); err != nil {
+		return "", err
+	}
+	element, ok := resource[field]
+	if !ok {
+		return "", fmt.Errorf("%w: [%s]", ErrMissingReference, field)
+	}
+	var reference struct {
+		Reference string `json:"reference"`
+	}
+	if err := json.Unmarshal(element, &reference); err != nil {
+		return "", fmt.Errorf("%w: [%s] is not a single reference", ErrInvalidReference, field)
+	}
+	if reference.Reference == "" {
+		return "", fmt.Errorf("%w: [%s]", ErrMissingReference, field)
+	}
+	return reference.Reference, nil
+}
+
+// Forms of a reference, see referenceTarget
+const (
+	referenceRelative = iota
+	referenceContained
+	referenceAbsolute
+)
+
+// referenceTarget returns the form of reference and what it points at: the Type/id of a relative
+// reference, the id of a contained (#id) reference or the URL of an absolute reference. Absolute
+// references below the endpoint of the client are relative references. Other absolute references
+// must be on the host of the FHIR store, so the bearer token is never sent elsewhere
+func (c *Client) referenceTarget(reference string) (int, string, error) {
+	if strings.HasPrefix(reference, "#") {
+		if len(reference) == 1 {
+			return 0, "", fmt.Errorf("%w: [%s]", ErrInvalidReference, reference)
+		}
+		return referenceContained, reference[1:], nil
+	}
+	if !strings.HasPrefix(reference, "http://") && !strings.HasPrefix(reference, "https://") {
+		resourceType, id, err := ParseReference(reference)
+		if err != nil {
+			return 0, "", err
+		}
+		return referenceRelative, resourceType + "/" + id, nil
+	}
+	if relative, ok := strings.CutPrefix(reference, c.GetEndpointURL()+"/"); ok {
+		if resourceType, id, err := ParseReference(relative); err == nil {
+			return referenceRelative, resourceType + "/" + id, nil
+		}
+	}
+	u, err := url.Parse(reference)
+	if err != nil || u.Scheme != c.fhirStoreURL.Scheme || u.Host != c.fhirStoreURL.Host {
+		return 0, "", fmt.Errorf("%w: [%s] is not on the host of the FHIR store", ErrInvalidReference, reference)
+	}
+	return referenceAbsolute, reference, nil
+}
+
+// withAbsoluteURL returns an option which sends the request to the absolute URL target
+func withAbsoluteURL(target string) OptionFunc {
+	return func(req *http.Request) error {
+		u, err := url.Parse(target)
+		if err != nil {
+			return err
+		}
+		req.URL = u
+		req.Host = u.Host
+		return nil
+	}
+}
+
+// containedResource returns the JSON of the resource with id contained in the JSON resource in data
+func containedResource(data []byte, id string) ([]byte, error) {
+	var resource struct {
+		Contained []json.RawMessage `json:"contained"`
+	}
+	if err := json.Unmarshal(data, &resource); err != nil {
+		return nil, err
+	}
+	for _, contained := range resource.Contained {
+		var element struct {
+			ID string `json:"id"`
+		}
+		if json.Unmarshal(contained, &element) == nil && element.ID == id {
+			return contained, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no contained resource [#%s]", ErrInvalidReference, id)
+}
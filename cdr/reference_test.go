@@ -0,0 +1,23 @@
+package cdr_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/philips-software/go-hsdp-api/cdr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReference(t *testing.T) {
+	resourceType, id, err := cdr.ParseReference("Patient/123")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "Patient", resourceType)
+	assert.Equal(t, "123", id)
+
+	for _, invalid := range []string{"", "#contained", "Patient", "Patient/", "/123", "Patient/123/_history/2", "https://example.com/fhir/Patient/123", "urn:uuid:Patient/1"} {
+		_, _, err = cdr.ParseReference(invalid)
+		assert.True(t, errors.Is(err, cdr.ErrInvalidReference), invalid)
+	}
+}
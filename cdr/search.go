@@ -0,0 +1,87 @@
+package cdr
+
+import (
+	"strings"
+	"time"
+)
+
+// Search parameters which apply to all FHIR resources and match against Resource.meta
+const (
+	SearchParamTag         = "_tag"
+	SearchParamSecurity    = "_security"
+	SearchParamProfile     = "_profile"
+	SearchParamLastUpdated = "_lastUpdated"
+)
+
+// Search parameters controlling whether contained resources are returned as search
+// matches, see WithContained
+const (
+	SearchParamContained     = "_contained"
+	SearchParamContainedType = "_containedType"
+)
+
+// Values of the _contained and _containedType search parameters
+const (
+	ContainedFalse         = "false"
+	ContainedTrue          = "true"
+	ContainedBoth          = "both"
+	ContainedTypeContainer = "container"
+	ContainedTypeContained = "contained"
+)
+
+// SearchParamTotal requests the Bundle total of a search, see WithTotal
+const SearchParamTotal = "_total"
+
+// Values of the _total search parameter. With TotalNone the server omits the total
+// and Search returns TotalUnknown
+const (
+	TotalAccurate = "accurate"
+	TotalEstimate = "estimate"
+	TotalNone     = "none"
+)
+
+// TotalUnknown is the total returned by Search when _total=none was requested and the
+// server did not return a total
+const TotalUnknown = -1
+
+// Prefixes of date search values
+const (
+	PrefixGreaterThan    = "gt"
+	PrefixGreaterOrEqual = "ge"
+	PrefixLessThan       = "lt"
+	PrefixLessOrEqual    = "le"
+)
+
+var tokenEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`, `,`, `\,`, `$`, `\$`)
+
+// Token formats a system qualified FHIR token search value as system|code, e.g. for
+// the _tag and _security parameters. An empty system matches codes without a system
+// and an empty code matches any code of system. Reserved characters are escaped.
+// To match code in any system, use EscapeSearchValue(code) instead
+func Token(system, code string) string {
+	return EscapeSearchValue(system) + "|" + EscapeSearchValue(code)
+}
+
+// EscapeSearchValue escapes the FHIR search reserved characters \ | , and $ of value
+func EscapeSearchValue(value string) string {
+	return tokenEscaper.Replace(value)
+}
+
+// Has formats the name of a _has reverse chaining search parameter selecting resources
+// referred to by the reference parameter of resourceType resources matching param, e.g.
+// Has("Observation", "patient", "code") for Patient?_has:Observation:patient:code=1234-5.
+// Chains nest by passing another Has as param
+func Has(resourceType, reference, param string) string {
+	return "_has:" + resourceType + ":" + reference + ":" + param
+}
+
+// Instant formats t as a FHIR instant in UTC
+func Instant(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// LastUpdated formats a _lastUpdated search value comparing against t using one of
+// the Prefix constants, e.g. LastUpdated(PrefixGreaterThan, lastSync)
+func LastUpdated(prefix string, t time.Time) string {
+	return prefix + Instant(t)
+}
@@ -0,0 +1,213 @@
+package cdr_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/fhir/go/fhirversion"
+	r4pb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/bundle_and_contained_resource_go_proto"
+	"github.com/philips-software/go-hsdp-api/cdr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToken(t *testing.T) {
+	assert.Equal(t, "http://terminology.hl7.org/CodeSystem/v3-Confidentiality|R", cdr.Token("http://terminology.hl7.org/CodeSystem/v3-Confidentiality", "R"))
+	assert.Equal(t, "|R", cdr.Token("", "R"))
+	assert.Equal(t, "http://example.org/tags|", cdr.Token("http://example.org/tags", ""))
+	assert.Equal(t, `urn:sys\|1|a\,b\$c\\d`, cdr.Token("urn:sys|1", `a,b$c\d`))
+}
+
+func TestR4SearchMeta(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	tag := cdr.Token("http://example.org/governance", "retain,7y")
+	security := cdr.Token("http://terminology.hl7.org/CodeSystem/v3-Confidentiality", "R")
+	profile := "http://hl7.org/fhir/StructureDefinition/vitalsigns"
+
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Observation", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		assert.Equal(t, []string{`http://example.org/governance|retain\,7y`}, query[cdr.SearchParamTag])
+		assert.Equal(t, []string{"http://terminology.hl7.org/CodeSystem/v3-Confidentiality|R"}, query[cdr.SearchParamSecurity])
+		assert.Equal(t, []string{profile}, query[cdr.SearchParamProfile])
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "Bundle",
+  "type": "searchset",
+  "total": 0
+}`)
+	})
+
+	entries, total, _, err := cdrClient.OperationsR4.Search("Observation", url.Values{
+		cdr.SearchParamTag:      {tag},
+		cdr.SearchParamSecurity: {security},
+		cdr.SearchParamProfile:  {profile},
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, 0, total)
+	assert.Len(t, entries, 0)
+}
+
+func TestLastUpdated(t *testing.T) {
+	since := time.Date(2023, 3, 14, 15, 9, 26, 535000000, time.FixedZone("CET", 3600))
+	assert.Equal(t, "2023-03-14T14:09:26.535Z", cdr.Instant(since))
+	assert.Equal(t, "gt2023-03-14T14:09:26.535Z", cdr.LastUpdated(cdr.PrefixGreaterThan, since))
+	assert.Equal(t, "le2023-03-14T14:09:26.535Z", cdr.LastUpdated(cdr.PrefixLessOrEqual, since))
+}
+
+func TestR4SearchIfModifiedSince(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	since := time.Date(2023, 3, 14, 14, 9, 26, 0, time.UTC)
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Patient", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, []string{"ge2023-03-14T14:09:26Z"}, r.URL.Query()[cdr.SearchParamLastUpdated])
+		assert.Equal(t, "Tue, 14 Mar 2023 14:09:26 GMT", r.Header.Get("If-Modified-Since"))
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "Bundle",
+  "type": "searchset",
+  "total": 0
+}`)
+	})
+
+	_, total, _, err := cdrClient.OperationsR4.Search("Patient", url.Values{
+		cdr.SearchParamLastUpdated: {cdr.LastUpdated(cdr.PrefixGreaterOrEqual, since)},
+	}, cdr.WithIfModifiedSince(since))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, 0, total)
+}
+
+func TestR4SearchContained(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/MedicationRequest", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, cdr.ContainedBoth, r.URL.Query().Get(cdr.SearchParamContained))
+		assert.Equal(t, cdr.ContainedTypeContainer, r.URL.Query().Get(cdr.SearchParamContainedType))
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "Bundle",
+  "type": "searchset",
+  "total": 1,
+  "entry": [
+    {
+      "resource": {
+        "resourceType": "MedicationRequest",
+        "id": "mr-1",
+        "contained": [
+          {"resourceType": "Medication", "id": "med1", "code": {"text": "Paracetamol 500mg"}}
+        ],
+        "status": "active",
+        "intent": "order",
+        "medicationReference": {"reference": "#med1"},
+        "subject": {"reference": "Patient/123"}
+      }
+    }
+  ]
+}`)
+	})
+
+	entries, total, _, err := cdrClient.OperationsR4.Search("MedicationRequest", url.Values{
+		"subject": {"Patient/123"},
+	}, cdr.WithContained(cdr.ContainedBoth, cdr.ContainedTypeContainer))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, 1, total)
+	if !assert.Len(t, entries, 1) {
+		return
+	}
+	contained := entries[0].GetMedicationRequest().GetContained()
+	if !assert.Len(t, contained, 1) {
+		return
+	}
+	var medication r4pb.ContainedResource
+	if !assert.Nil(t, contained[0].UnmarshalTo(&medication)) {
+		return
+	}
+	assert.Equal(t, "Paracetamol 500mg", medication.GetMedication().GetCode().GetText().GetValue())
+
+	_, _, _, err = cdrClient.OperationsR4.Search("MedicationRequest", nil, cdr.WithContained("all", ""))
+	assert.True(t, errors.Is(err, cdr.ErrInvalidParameter))
+}
+
+func TestR4SearchTotal(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Patient", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		total := `"total": 1234,`
+		if r.URL.Query().Get(cdr.SearchParamTotal) == cdr.TotalNone {
+			total = ""
+		}
+		_, _ = io.WriteString(w, `{
+  "resourceType": "Bundle",
+  "type": "searchset",
+  `+total+`
+  "entry": [
+    {"resource": {"resourceType": "Patient", "id": "p1"}}
+  ]
+}`)
+	})
+
+	entries, total, _, err := cdrClient.OperationsR4.Search("Patient", nil, cdr.WithTotal(cdr.TotalAccurate))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Len(t, entries, 1)
+	assert.Equal(t, 1234, total)
+
+	entries, total, _, err = cdrClient.OperationsR4.Search("Patient", nil, cdr.WithTotal(cdr.TotalNone))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Len(t, entries, 1)
+	assert.Equal(t, cdr.TotalUnknown, total)
+
+	_, _, _, err = cdrClient.OperationsR4.Search("Patient", nil, cdr.WithTotal("exact"))
+	assert.True(t, errors.Is(err, cdr.ErrInvalidParameter))
+}
+
+func TestR4SearchHas(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Patient", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "1234-5", r.URL.Query().Get("_has:Observation:patient:code"))
+		assert.Equal(t, "Practitioner/1", r.URL.Query().Get("_has:Observation:patient:_has:AuditEvent:entity:agent"))
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "resourceType": "Bundle",
+  "type": "searchset",
+  "total": 1,
+  "entry": [
+    {"resource": {"resourceType": "Patient", "id": "p1"}}
+  ]
+}`)
+	})
+
+	query := url.Values{}
+	query.Set(cdr.Has("Observation", "patient", "code"), "1234-5")
+	query.Set(cdr.Has("Observation", "patient", cdr.Has("AuditEvent", "entity", "agent")), "Practitioner/1")
+	entries, total, _, err := cdrClient.OperationsR4.Search("Patient", query)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, 1, total)
+	assert.Len(t, entries, 1)
+}
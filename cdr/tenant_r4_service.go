@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 
+	"github.com/google/fhir/go/fhirversion"
 	"github.com/google/fhir/go/jsonformat"
 
 	r4pb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/organization_go_proto"
@@ -18,19 +19,42 @@ type TenantR4Service struct {
 	um       *jsonformat.Unmarshaller
 }
 
-// Onboard onboards the organization on the CDR under the rootOrgID
+// WithTimeZone returns a copy of the service which localizes parsed dates and times
+// to timeZone instead of the client-wide Config.TimeZone
+func (t *TenantR4Service) WithTimeZone(timeZone string) (*TenantR4Service, error) {
+	timeZone, err := validateTimeZone(timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("TenantR4Service.WithTimeZone: %w", err)
+	}
+	um, err := t.client.newUnmarshaller(timeZone, fhirversion.R4)
+	if err != nil {
+		return nil, fmt.Errorf("TenantR4Service.WithTimeZone (timezone=[%s]): %w", timeZone, err)
+	}
+	clone := *t
+	clone.timeZone = timeZone
+	clone.um = um
+	return &clone, nil
+}
+
+// Onboard onboards the organization on the CDR under the rootOrgID. When the CDR provisions
+// the store asynchronously Onboard polls the status endpoint and reads the organization
+// afterwards. ErrAsyncInProgress is returned when the CDR accepted the request without a
+// status endpoint to poll
 func (t *TenantR4Service) Onboard(organization *r4pb.Organization, options ...OptionFunc) (*r4pb.Organization, *Response, error) {
 	organizationJSON, err := t.ma.MarshalResource(organization)
 	if err != nil {
 		return nil, nil, err
 	}
+	if len(organization.GetIdentifier()) == 0 {
+		return nil, nil, ErrMissingIdentifier
+	}
 	orgID := organization.Identifier[0].GetValue().Value
 
 	req, err := t.client.newCDRRequest(http.MethodPut, fmt.Sprintf("Organization/%s", orgID), organizationJSON, options)
 	if err != nil {
 		return nil, nil, err
 	}
-	req.Header.Set("Accept", "application/fhir+json;fhirVersion=4.0")
+	setDefaultAccept(req, "application/fhir+json;fhirVersion=4.0")
 	req.Header.Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
 
 	var onboardResponse bytes.Buffer
@@ -41,6 +65,13 @@ func (t *TenantR4Service) Onboard(organization *r4pb.Organization, options ...Op
 		}
 		return nil, resp, err
 	}
+	if resp.StatusCode() == http.StatusAccepted { // Provisioning continues asynchronously
+		resp, err = t.client.completeAsync(req, resp, "application/fhir+json;fhirVersion=4.0")
+		if err != nil {
+			return nil, resp, err
+		}
+		return t.GetOrganizationByID(orgID, t.client.asyncReadOptions(req)...)
+	}
 	contained, err := t.um.UnmarshalR4(onboardResponse.Bytes())
 	if err != nil {
 		return nil, resp, err
@@ -49,12 +80,45 @@ func (t *TenantR4Service) Onboard(organization *r4pb.Organization, options ...Op
 	return organization, resp, nil
 }
 
-func (t *TenantR4Service) GetOrganizationByID(orgID string) (*r4pb.Organization, *Response, error) {
-	req, err := t.client.newCDRRequest(http.MethodGet, fmt.Sprintf("Organization/%s", orgID), nil, nil)
+// Offboard removes the organization from the CDR. When the CDR processes the request
+// asynchronously Offboard polls the status endpoint until offboarding has completed.
+// Use WithContext to bound the time spent waiting. ErrAsyncInProgress is returned when
+// the CDR accepted the request without a status endpoint to poll
+func (t *TenantR4Service) Offboard(organization *r4pb.Organization, options ...OptionFunc) (bool, *Response, error) {
+	if len(organization.GetIdentifier()) == 0 {
+		return false, nil, ErrMissingIdentifier
+	}
+	orgID := organization.Identifier[0].GetValue().Value
+
+	req, err := t.client.newCDRRequest(http.MethodDelete, fmt.Sprintf("Organization/%s", orgID), nil, options)
+	if err != nil {
+		return false, nil, err
+	}
+	setDefaultAccept(req, "application/fhir+json;fhirVersion=4.0")
+	req.Header.Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+
+	resp, err := t.client.do(req, nil)
+	if (err != nil && err != io.EOF) || resp == nil {
+		if resp == nil && err != nil {
+			err = fmt.Errorf("offboard: %w", ErrEmptyResult)
+		}
+		return false, resp, err
+	}
+	resp, err = t.client.completeAsync(req, resp, "application/fhir+json;fhirVersion=4.0")
+	if err != nil {
+		return false, resp, err
+	}
+	status := resp.StatusCode()
+	return status == http.StatusOK || status == http.StatusNoContent, resp, nil
+}
+
+// GetOrganizationByID returns the onboarded organization with orgID
+func (t *TenantR4Service) GetOrganizationByID(orgID string, options ...OptionFunc) (*r4pb.Organization, *Response, error) {
+	req, err := t.client.newCDRRequest(http.MethodGet, fmt.Sprintf("Organization/%s", orgID), nil, options)
 	if err != nil {
 		return nil, nil, err
 	}
-	req.Header.Set("Accept", "application/fhir+json;fhirVersion=4.0")
+	setDefaultAccept(req, "application/fhir+json;fhirVersion=4.0")
 	req.Header.Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
 
 	var getResponse bytes.Buffer
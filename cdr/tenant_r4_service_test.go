@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/google/fhir/go/fhirversion"
+	"github.com/philips-software/go-hsdp-api/cdr"
 	"github.com/philips-software/go-hsdp-api/cdr/helper/fhir/r4"
 	"github.com/stretchr/testify/assert"
 )
@@ -86,3 +87,200 @@ func TestR4TenantService(t *testing.T) {
 	}
 	assert.Equal(t, "Hospital", foundOrg.Name.Value)
 }
+
+func TestR4TenantOffboard(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	polls := 0
+
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		switch r.Method {
+		case "DELETE":
+			w.Header().Set("Content-Location", "/store/fhir/"+cdrOrgID+"/$status/"+orgID)
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/$status/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, "GET", r.Method) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		polls++
+		if polls < 2 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	org, err := r4.NewOrganization(timeZone, orgID, "Hospital")
+	if !assert.Nil(t, err) {
+		return
+	}
+	ok, resp, err := cdrClient.TenantR4.Offboard(org)
+	if !assert.Nil(t, err) {
+		return
+	}
+	if !assert.NotNil(t, resp) {
+		return
+	}
+	assert.True(t, ok)
+	assert.Equal(t, 2, polls)
+}
+
+func TestR4TenantOffboardWithBearerToken(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	var authorizations []string
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.Header().Set("Content-Location", "/store/fhir/"+cdrOrgID+"/$status/"+orgID)
+		w.WriteHeader(http.StatusAccepted)
+	})
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/$status/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusOK)
+	})
+	client, err := cdr.NewClient(nil, &cdr.Config{
+		CDRURL:    serverCDR.URL + "/store/fhir",
+		RootOrgID: cdrOrgID,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	org, err := r4.NewOrganization(timeZone, orgID, "Hospital")
+	if !assert.Nil(t, err) {
+		return
+	}
+	ok, _, err := client.TenantR4.Offboard(org, cdr.WithBearerToken("pinned"))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.True(t, ok)
+	assert.Equal(t, []string{"Bearer pinned", "Bearer pinned"}, authorizations)
+}
+
+func TestR4TenantOnboardAsyncWithBearerToken(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	var requests []string
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		switch r.Method {
+		case "PUT":
+			w.Header().Set("Content-Location", "/store/fhir/"+cdrOrgID+"/$status/"+orgID)
+			w.WriteHeader(http.StatusAccepted)
+		case "GET":
+			w.WriteHeader(http.StatusOK)
+			_, _ = io.WriteString(w, `{"resourceType": "Organization", "id": "`+orgID+`", "name": "Hospital"}`)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/$status/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, "poll "+r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusOK)
+	})
+	client, err := cdr.NewClient(nil, &cdr.Config{
+		CDRURL:    serverCDR.URL + "/store/fhir",
+		RootOrgID: cdrOrgID,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	org, err := r4.NewOrganization(timeZone, orgID, "Hospital")
+	if !assert.Nil(t, err) {
+		return
+	}
+	onboarded, _, err := client.TenantR4.Onboard(org, cdr.WithBearerToken("pinned"))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "Hospital", onboarded.GetName().GetValue())
+	assert.Equal(t, []string{"PUT Bearer pinned", "poll Bearer pinned", "GET Bearer pinned"}, requests)
+}
+
+func TestR4TenantOnboardAsyncWithProvenance(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	var requests []string
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.Header.Get(cdr.ProvenanceHeader))
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		switch r.Method {
+		case "PUT":
+			w.Header().Set("Content-Location", "/store/fhir/"+cdrOrgID+"/$status/"+orgID)
+			w.WriteHeader(http.StatusAccepted)
+		case "GET":
+			w.WriteHeader(http.StatusOK)
+			_, _ = io.WriteString(w, `{"resourceType": "Organization", "id": "`+orgID+`", "name": "Hospital"}`)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/$status/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	org, err := r4.NewOrganization(timeZone, orgID, "Hospital")
+	if !assert.Nil(t, err) {
+		return
+	}
+	onboarded, _, err := cdrClient.TenantR4.Onboard(org, cdr.WithProvenance([]byte(`{"resourceType": "Provenance"}`)))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "Hospital", onboarded.GetName().GetValue())
+	assert.Equal(t, []string{`PUT {"resourceType":"Provenance"}`, "GET "}, requests)
+}
+
+func TestR4TenantAsyncWithoutStatusEndpoint(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	orgID := "f5fe538f-c3b5-4454-8774-cd3789f59b9f"
+	muxCDR.HandleFunc("/store/fhir/"+cdrOrgID+"/Organization/"+orgID, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json;fhirVersion=4.0")
+		w.WriteHeader(http.StatusAccepted)
+	})
+	org, err := r4.NewOrganization(timeZone, orgID, "Hospital")
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, resp, err := cdrClient.TenantR4.Onboard(org)
+	assert.ErrorIs(t, err, cdr.ErrAsyncInProgress)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode())
+	}
+	ok, resp, err := cdrClient.TenantR4.Offboard(org)
+	assert.ErrorIs(t, err, cdr.ErrAsyncInProgress)
+	assert.False(t, ok)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode())
+	}
+}
+
+func TestR4TenantOnboardMissingIdentifier(t *testing.T) {
+	teardown := setup(t, fhirversion.R4)
+	defer teardown()
+
+	org, err := r4.NewOrganization(timeZone, "f5fe538f-c3b5-4454-8774-cd3789f59b9f", "Hospital")
+	if !assert.Nil(t, err) {
+		return
+	}
+	org.Identifier = nil
+	_, _, err = cdrClient.TenantR4.Onboard(org)
+	assert.ErrorIs(t, err, cdr.ErrMissingIdentifier)
+}
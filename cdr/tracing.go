@@ -0,0 +1,120 @@
+package cdr
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Tracer starts a span for every CDR request, e.g. by adapting an OpenTelemetry
+// trace.Tracer, so the cdr package does not depend on a tracing library. The
+// returned request, usually req.WithContext of the span context, is the one sent
+// so an instrumented transport can propagate it. Implementations must be safe for
+// concurrent use
+type Tracer interface {
+	StartSpan(req *http.Request, name string) (*http.Request, Span)
+}
+
+// Span is a span started by a Tracer. It is ended once the response body was consumed
+type Span interface {
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End()
+}
+
+// Attributes set on spans
+const (
+	SpanAttributeResourceType  = "cdr.resource_type"
+	SpanAttributeOperation     = "cdr.operation"
+	SpanAttributeMethod        = "http.method"
+	SpanAttributeStatusCode    = "http.status_code"
+	SpanAttributeRequestBytes  = "http.request_content_length"
+	SpanAttributeResponseBytes = "http.response_content_length"
+)
+
+// startSpan starts the span of req. It returns req unchanged and a nil span without Config.Tracer
+func (c *Client) startSpan(req *http.Request) (*http.Request, Span) {
+	if c.config.Tracer == nil {
+		return req, nil
+	}
+	resourceType, operation := c.describeRequest(req)
+	name := "CDR " + operation
+	if resourceType != "" {
+		name += " " + resourceType
+	}
+	req, span := c.config.Tracer.StartSpan(req, name)
+	span.SetAttribute(SpanAttributeMethod, req.Method)
+	span.SetAttribute(SpanAttributeOperation, operation)
+	if resourceType != "" {
+		span.SetAttribute(SpanAttributeResourceType, resourceType)
+	}
+	if req.ContentLength > 0 {
+		span.SetAttribute(SpanAttributeRequestBytes, req.ContentLength)
+	}
+	return req, span
+}
+
+// endSpan records the outcome of the request on span and ends it
+func endSpan(span Span, resp *http.Response, responseBytes int64, err error) {
+	if span == nil {
+		return
+	}
+	if resp != nil {
+		span.SetAttribute(SpanAttributeStatusCode, resp.StatusCode)
+		span.SetAttribute(SpanAttributeResponseBytes, responseBytes)
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// describeRequest returns the resource type and the FHIR interaction or operation of req,
+// e.g. "Patient" and "read" or "Observation" and "$lastn"
+func (c *Client) describeRequest(req *http.Request) (string, string) {
+	path := req.URL.Opaque
+	if path == "" {
+		path = req.URL.Path
+	}
+	path = strings.TrimPrefix(path, c.fhirStoreURL.Path+c.config.RootOrgID)
+	var segments []string
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	if len(segments) == 1 && segments[0] == "metadata" {
+		return "", "capabilities"
+	}
+	resourceType := ""
+	if len(segments) > 0 && !strings.HasPrefix(segments[0], "$") && !strings.HasPrefix(segments[0], "_") {
+		resourceType = segments[0]
+	}
+	for _, segment := range segments {
+		if strings.HasPrefix(segment, "$") {
+			return resourceType, segment
+		}
+	}
+	instance := len(segments) > 1
+	switch req.Method {
+	case http.MethodGet:
+		if len(segments) > 2 && segments[2] == "_history" {
+			return resourceType, "vread"
+		}
+		if instance {
+			return resourceType, "read"
+		}
+		return resourceType, "search"
+	case http.MethodPost:
+		if resourceType == "" {
+			return resourceType, "batch"
+		}
+		return resourceType, "create"
+	case http.MethodPut:
+		return resourceType, "update"
+	case http.MethodPatch:
+		return resourceType, "patch"
+	case http.MethodDelete:
+		return resourceType, "delete"
+	}
+	return resourceType, strings.ToLower(req.Method)
+}
@@ -0,0 +1,227 @@
+package cdr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// BundleProblem is a structural problem of a bundle found by ValidateBundleLocally. Entry is
+// the index of the entry, -1 for the bundle itself, and Path the location of the problem,
+// e.g. Bundle.entry[2].request.method
+type BundleProblem struct {
+	Entry   int
+	Path    string
+	Message string
+}
+
+func (p BundleProblem) String() string {
+	return p.Path + ": " + p.Message
+}
+
+var (
+	// uuidURN is a urn:uuid: fullUrl or reference
+	uuidURN = regexp.MustCompile(`^urn:uuid:[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	// oidURN is a urn:oid: fullUrl or reference
+	oidURN = regexp.MustCompile(`^urn:oid:[0-2](\.(0|[1-9][0-9]*))+$`)
+	// resourceTypeName is the name of a FHIR resource type
+	resourceTypeName = regexp.MustCompile(`^[A-Z][A-Za-z]+$`)
+)
+
+// bundleMethods are the valid Bundle.entry.request.method values
+var bundleMethods = map[string]bool{
+	http.MethodGet:    true,
+	http.MethodHead:   true,
+	http.MethodPost:   true,
+	http.MethodPut:    true,
+	http.MethodDelete: true,
+	http.MethodPatch:  true,
+}
+
+// ValidateBundleLocally checks the structure of the JSON bundle without a server round trip,
+// e.g. before a Transaction, and returns the problems found, none when it looks fine. Entries
+// of a transaction or batch need a request with a valid method and url, fullUrls must be
+// absolute URLs or urn:uuid: or urn:oid: placeholders and unique, and references in the
+// resources must be well-formed and urn: references must point at an entry. It complements
+// but does not replace WithValidateOnly, the resources themselves are not validated. An error
+// is returned when bundle is not a JSON Bundle
+func ValidateBundleLocally(bundle []byte) ([]BundleProblem, error) {
+	var parsed struct {
+		ResourceType string `json:"resourceType"`
+		Type         string `json:"type"`
+		Entry        []struct {
+			FullURL  string          `json:"fullUrl"`
+			Resource json.RawMessage `json:"resource"`
+			Request  *struct {
+				Method string `json:"method"`
+				URL    string `json:"url"`
+			} `json:"request"`
+		} `json:"entry"`
+	}
+	if err := json.Unmarshal(bundle, &parsed); err != nil {
+		return nil, fmt.Errorf("ValidateBundleLocally: %w", err)
+	}
+	if parsed.ResourceType != "Bundle" {
+		return nil, fmt.Errorf("ValidateBundleLocally: %w: %s", ErrNotABundle, parsed.ResourceType)
+	}
+	problems := make([]BundleProblem, 0)
+	add := func(entry int, path, format string, args ...interface{}) {
+		problems = append(problems, BundleProblem{Entry: entry, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	if parsed.Type == "" {
+		add(-1, "Bundle.type", "missing")
+	}
+	requests := parsed.Type == "transaction" || parsed.Type == "batch"
+	fullURLs := make(map[string]int)
+	for i, entry := range parsed.Entry {
+		path := fmt.Sprintf("Bundle.entry[%d]", i)
+		if entry.FullURL != "" {
+			if !validFullURL(entry.FullURL) {
+				add(i, path+".fullUrl", "[%s] is not an absolute URL or a urn:uuid: or urn:oid:", entry.FullURL)
+			} else if first, ok := fullURLs[entry.FullURL]; ok {
+				add(i, path+".fullUrl", "[%s] is also the fullUrl of entry %d", entry.FullURL, first)
+			} else {
+				fullURLs[entry.FullURL] = i
+			}
+		}
+		resourceType := ""
+		if len(entry.Resource) > 0 {
+			var resource struct {
+				ResourceType string `json:"resourceType"`
+			}
+			if err := json.Unmarshal(entry.Resource, &resource); err != nil || resource.ResourceType == "" {
+				add(i, path+".resource", "missing resourceType")
+			}
+			resourceType = resource.ResourceType
+		}
+		if !requests {
+			continue
+		}
+		if entry.Request == nil {
+			add(i, path+".request", "missing")
+			continue
+		}
+		method := entry.Request.Method
+		switch {
+		case method == "":
+			add(i, path+".request.method", "missing")
+		case !bundleMethods[method]:
+			add(i, path+".request.method", "[%s] is not one of GET, HEAD, POST, PUT, DELETE or PATCH", method)
+		}
+		if entry.Request.URL == "" {
+			add(i, path+".request.url", "missing")
+			continue
+		}
+		if (method == http.MethodPost || method == http.MethodPut) && resourceType == "" {
+			add(i, path+".resource", "missing for %s", method)
+		}
+		target, _, _ := strings.Cut(entry.Request.URL, "?")
+		if strings.HasPrefix(target, "$") {
+			// A system level operation, e.g. $process-message
+			continue
+		}
+		urlType, _, _ := strings.Cut(target, "/")
+		switch {
+		case !resourceTypeName.MatchString(urlType):
+			add(i, path+".request.url", "[%s] does not start with a resource type", entry.Request.URL)
+		case (method == http.MethodPost || method == http.MethodPut) && resourceType != "" && urlType != resourceType:
+			add(i, path+".request.url", "[%s] does not match the resource type %s", entry.Request.URL, resourceType)
+		}
+	}
+	for i, entry := range parsed.Entry {
+		if len(entry.Resource) == 0 {
+			continue
+		}
+		var resource interface{}
+		if err := json.Unmarshal(entry.Resource, &resource); err != nil {
+			continue
+		}
+		path := fmt.Sprintf("Bundle.entry[%d].resource", i)
+		for _, reference := range collectReferences(resource, path) {
+			if message := referenceProblem(reference.value, fullURLs); message != "" {
+				add(i, reference.path, "[%s] %s", reference.value, message)
+			}
+		}
+	}
+	return problems, nil
+}
+
+// validFullURL reports whether fullURL is an absolute URL or a urn:uuid: or urn:oid:
+func validFullURL(fullURL string) bool {
+	if strings.HasPrefix(fullURL, "urn:") {
+		return uuidURN.MatchString(fullURL) || oidURN.MatchString(fullURL)
+	}
+	u, err := url.Parse(fullURL)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// referenceProblem returns what is wrong with reference, empty when it is well-formed.
+// fullURLs are the fullUrls of the entries of the bundle
+func referenceProblem(reference string, fullURLs map[string]int) string {
+	switch {
+	case strings.HasPrefix(reference, "#"):
+		if len(reference) == 1 {
+			return "is an empty contained reference"
+		}
+		return ""
+	case strings.HasPrefix(reference, "urn:"):
+		if _, ok := fullURLs[reference]; !ok {
+			return "is not the fullUrl of an entry"
+		}
+		return ""
+	case strings.HasPrefix(reference, "http://"), strings.HasPrefix(reference, "https://"):
+		if !validFullURL(reference) {
+			return "is not a valid absolute URL"
+		}
+		return ""
+	}
+	if resourceType, query, ok := strings.Cut(reference, "?"); ok {
+		// Conditional reference, resolved by the server in a transaction
+		if !resourceTypeName.MatchString(resourceType) || query == "" {
+			return "is not a valid conditional reference"
+		}
+		return ""
+	}
+	relative, _, _ := strings.Cut(reference, "/_history/")
+	resourceType, _, err := ParseReference(relative)
+	if err != nil || !resourceTypeName.MatchString(resourceType) {
+		return "is not a Type/id reference"
+	}
+	return ""
+}
+
+// bundleReference is a reference found in a resource and the path of its element
+type bundleReference struct {
+	path  string
+	value string
+}
+
+// collectReferences returns the reference values of all Reference elements in the JSON
+// value v, which is at path, in a stable order
+func collectReferences(v interface{}, path string) []bundleReference {
+	var references []bundleReference
+	switch value := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if reference, ok := value[key].(string); ok && key == "reference" {
+				references = append(references, bundleReference{path: path + ".reference", value: reference})
+				continue
+			}
+			references = append(references, collectReferences(value[key], path+"."+key)...)
+		}
+	case []interface{}:
+		for i, element := range value {
+			references = append(references, collectReferences(element, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	return references
+}
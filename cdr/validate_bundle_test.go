@@ -0,0 +1,81 @@
+package cdr_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/philips-software/go-hsdp-api/cdr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateBundleLocally(t *testing.T) {
+	valid := []byte(`{
+  "resourceType": "Bundle",
+  "type": "transaction",
+  "entry": [
+    {
+      "fullUrl": "urn:uuid:61ebe359-bfdc-4613-8bf2-c5e300945f0a",
+      "resource": {"resourceType": "Patient", "managingOrganization": {"reference": "Organization/123"}},
+      "request": {"method": "POST", "url": "Patient"}
+    },
+    {
+      "resource": {
+        "resourceType": "Observation",
+        "subject": {"reference": "urn:uuid:61ebe359-bfdc-4613-8bf2-c5e300945f0a"},
+        "performer": [{"reference": "Practitioner?identifier=https://example.org|42"}, {"reference": "#p1"}]
+      },
+      "request": {"method": "PUT", "url": "Observation/abc"}
+    },
+    {"request": {"method": "DELETE", "url": "Observation?code=1234"}}
+  ]
+}`)
+	problems, err := cdr.ValidateBundleLocally(valid)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Empty(t, problems)
+
+	invalid := []byte(`{
+  "resourceType": "Bundle",
+  "type": "transaction",
+  "entry": [
+    {
+      "fullUrl": "urn:uuid:not-a-uuid",
+      "resource": {"resourceType": "Patient", "managingOrganization": {"reference": "Organization"}},
+      "request": {"method": "post", "url": "Patient"}
+    },
+    {
+      "fullUrl": "https://example.org/fhir/Observation/1",
+      "resource": {"resourceType": "Observation", "subject": {"reference": "urn:uuid:2f4e5a8c-1b3d-4e6f-8a9b-0c1d2e3f4a5b"}},
+      "request": {"method": "PUT", "url": "Patient/1"}
+    },
+    {"fullUrl": "https://example.org/fhir/Observation/1", "request": {"method": "GET"}},
+    {"resource": {"resourceType": "Patient"}}
+  ]
+}`)
+	problems, err = cdr.ValidateBundleLocally(invalid)
+	if !assert.Nil(t, err) {
+		return
+	}
+	paths := make([]string, 0, len(problems))
+	for _, problem := range problems {
+		paths = append(paths, problem.Path)
+	}
+	assert.Equal(t, []string{
+		"Bundle.entry[0].fullUrl",
+		"Bundle.entry[0].request.method",
+		"Bundle.entry[1].request.url",
+		"Bundle.entry[2].fullUrl",
+		"Bundle.entry[2].request.url",
+		"Bundle.entry[3].request",
+		"Bundle.entry[0].resource.managingOrganization.reference",
+		"Bundle.entry[1].resource.subject.reference",
+	}, paths)
+	assert.Equal(t, 2, problems[3].Entry)
+	assert.Contains(t, problems[3].String(), "is also the fullUrl of entry 1")
+
+	_, err = cdr.ValidateBundleLocally([]byte(`{"resourceType": "Patient"}`))
+	assert.True(t, errors.Is(err, cdr.ErrNotABundle))
+	_, err = cdr.ValidateBundleLocally([]byte(`{`))
+	assert.NotNil(t, err)
+}
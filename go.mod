@@ -14,6 +14,8 @@ require (
 	github.com/philips-software/go-nih-signer v1.5.0
 	github.com/stretchr/testify v1.9.0
 	golang.org/x/oauth2 v0.23.0
+	google.golang.org/protobuf v1.33.0
+	nhooyr.io/websocket v1.8.11
 )
 
 require (
@@ -34,7 +36,5 @@ require (
 	golang.org/x/net v0.23.0 // indirect
 	golang.org/x/sys v0.18.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
-	google.golang.org/protobuf v1.33.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
-	nhooyr.io/websocket v1.8.11 // indirect
 )
@@ -2,9 +2,11 @@ package internal
 
 import (
 	"bytes"
+	"compress/gzip"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 )
 
 // CheckResponse checks the API response for errors, and returns them if present.
@@ -18,6 +20,12 @@ func CheckResponse(r *http.Response) error {
 	if err != nil {
 		data = []byte(err.Error())
 	}
+	if err == nil && strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		if decompressed, err := gunzip(data); err == nil {
+			data = decompressed
+			r.Header.Del("Content-Encoding")
+		}
+	}
 	if data == nil {
 		data = []byte("empty")
 	}
@@ -28,3 +36,14 @@ func CheckResponse(r *http.Response) error {
 	}
 	return fmt.Errorf("%s %s: StatusCode %d, Body: %s", r.Request.Method, requestURI, r.StatusCode, string(data))
 }
+
+func gunzip(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	return io.ReadAll(reader)
+}
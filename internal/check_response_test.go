@@ -0,0 +1,39 @@
+package internal_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/philips-software/go-hsdp-api/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckResponseGzip(t *testing.T) {
+	outcome := `{"resourceType":"OperationOutcome","issue":[{"severity":"error","code":"invalid"}]}`
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, _ = zw.Write([]byte(outcome))
+	_ = zw.Close()
+
+	resp := &http.Response{
+		StatusCode: http.StatusBadRequest,
+		Header:     http.Header{"Content-Encoding": []string{"gzip"}},
+		Body:       io.NopCloser(&compressed),
+		Request: &http.Request{
+			Method: http.MethodPost,
+			URL:    &url.URL{Path: "/store/fhir/Patient"},
+		},
+	}
+	err := internal.CheckResponse(resp)
+	if !assert.NotNil(t, err) {
+		return
+	}
+	assert.Contains(t, err.Error(), outcome)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, outcome, string(body))
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+}
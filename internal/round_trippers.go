@@ -1,12 +1,17 @@
 package internal
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httputil"
 	"os"
 	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -70,12 +75,19 @@ func (rt *HeaderRoundTripper) RoundTrip(req *http.Request) (resp *http.Response,
 	return rt.next.RoundTrip(req)
 }
 
+// LoggingRoundTripper dumps requests and responses to w. It is safe for concurrent
+// use: each dump is written in one piece and tagged with an id so the request and
+// response of concurrent round trips can be correlated
 type LoggingRoundTripper struct {
 	next   http.RoundTripper
 	w      io.Writer
+	lock   sync.Mutex
 	id     int64
 	prefix string
 	debug  bool
+	// IndentJSON pretty-prints JSON bodies in the dumps. The bytes sent and
+	// received are not affected
+	IndentJSON bool
 }
 
 func NewLoggingRoundTripper(next http.RoundTripper, w io.Writer) *LoggingRoundTripper {
@@ -91,9 +103,7 @@ func NewLoggingRoundTripper(next http.RoundTripper, w io.Writer) *LoggingRoundTr
 }
 
 func (rt *LoggingRoundTripper) RoundTrip(req *http.Request) (resp *http.Response, err error) {
-	// We should use a mutex here
-	localID := rt.id
-	rt.id++
+	localID := atomic.AddInt64(&rt.id, 1) - 1
 
 	id := fmt.Sprintf("%s-%05d", rt.prefix, localID)
 	if rt.w != nil {
@@ -106,12 +116,13 @@ func (rt *LoggingRoundTripper) RoundTrip(req *http.Request) (resp *http.Response
 				filtered = f.Regex.ReplaceAllString(filtered, f.Replace)
 			}
 		}
+		filtered = rt.format(filtered)
 		if err != nil {
 			out = fmt.Sprintf("[go-hsdp-api %s %s] --- request dump error: %v\n", id, now, err)
 		} else {
 			out = fmt.Sprintf("[go-hsdp-api %s %s] --- request start ---\n%s\n[go-hsdp-api %s %s] --- request end ---\n", id, now, filtered, id, now)
 		}
-		_, _ = io.WriteString(rt.w, out)
+		rt.write(out)
 	}
 
 	resp, err = rt.next.RoundTrip(req)
@@ -129,13 +140,38 @@ func (rt *LoggingRoundTripper) RoundTrip(req *http.Request) (resp *http.Response
 				filtered = f.Regex.ReplaceAllString(filtered, f.Replace)
 			}
 		}
+		filtered = rt.format(filtered)
 		if err != nil {
 			out = fmt.Sprintf("[go-hsdp-api %s %s] --- response dump error: %v\n", id, now, err)
 		} else {
 			out = fmt.Sprintf("[go-hsdp-api %s %s] --- response start ---\n%s\n[go-hsdp-api %s %s] --- response end ---\n", id, now, filtered, id, now)
 		}
-		_, _ = io.WriteString(rt.w, out)
+		rt.write(out)
 	}
 
 	return resp, err
 }
+
+func (rt *LoggingRoundTripper) write(out string) {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+	_, _ = io.WriteString(rt.w, out)
+}
+
+// format indents the body of a filtered dump when IndentJSON is set and the body is JSON.
+// Filtering happens first as the filters expect compact JSON
+func (rt *LoggingRoundTripper) format(dump string) string {
+	if !rt.IndentJSON {
+		return dump
+	}
+	separator := "\r\n\r\n"
+	index := strings.Index(dump, separator)
+	if index < 0 {
+		return dump
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, []byte(dump[index+len(separator):]), "", "  "); err != nil {
+		return dump
+	}
+	return dump[:index+len(separator)] + indented.String()
+}
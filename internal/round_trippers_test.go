@@ -0,0 +1,75 @@
+package internal_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/philips-software/go-hsdp-api/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoggingRoundTripperConcurrent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"ok": true}`)
+	}))
+	defer server.Close()
+
+	var debugLog bytes.Buffer // Not safe for concurrent use by itself
+	client := &http.Client{
+		Transport: internal.NewLoggingRoundTripper(http.DefaultTransport, &debugLog),
+	}
+	count := 20
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get(server.URL)
+			if assert.Nil(t, err) {
+				_ = resp.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+
+	dumps := regexp.MustCompile(`(?s)\[go-hsdp-api (\S+) \S+\] --- (request|response) start ---\n.*?\n\[go-hsdp-api (\S+) \S+\] --- (request|response) end ---\n`).FindAllStringSubmatch(debugLog.String(), -1)
+	assert.Len(t, dumps, 2*count)
+	perID := make(map[string]int)
+	for _, dump := range dumps {
+		assert.Equal(t, dump[1], dump[3])
+		assert.Equal(t, dump[2], dump[4])
+		perID[dump[1]]++
+	}
+	assert.Len(t, perID, count)
+}
+
+func TestLoggingRoundTripperIndentJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"access_token":"secret","expires_in":1799}`)
+	}))
+	defer server.Close()
+
+	var debugLog bytes.Buffer
+	logger := internal.NewLoggingRoundTripper(http.DefaultTransport, &debugLog)
+	logger.IndentJSON = true
+	client := &http.Client{Transport: logger}
+	resp, err := client.Get(server.URL)
+	if !assert.Nil(t, err) {
+		return
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	assert.Equal(t, `{"access_token":"secret","expires_in":1799}`, string(body))
+	dump := debugLog.String()
+	assert.Contains(t, dump, "{\n  \"access_token\": \"[sensitive]\",\n  \"expires_in\": 1799\n}")
+	assert.NotContains(t, dump, "secret")
+}
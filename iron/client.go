@@ -3,12 +3,18 @@ package iron
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/philips-software/go-hsdp-api/iam"
 	"github.com/philips-software/go-hsdp-api/internal"
 
 	"github.com/google/go-querystring/query"
@@ -17,16 +23,33 @@ import (
 const (
 	userAgent   = "go-hsdp-api/iron/" + internal.LibraryVersion
 	IronBaseURL = "https://worker-aws-us-east-1.iron.io/"
+
+	defaultTimeout = 30 * time.Second
+
+	// defaultMaxAttempts is the default Config.MaxAttempts
+	defaultMaxAttempts = 3
+	// Backoff between attempts of a rate limited request without a Retry-After header.
+	// It doubles after every attempt up to maxRetryBackoff, which also caps Retry-After
+	minRetryBackoff = time.Second
+	maxRetryBackoff = time.Minute
 )
 
 // OptionFunc is the function signature function for options
 type OptionFunc func(*http.Request) error
 
-// Config contains the configuration of a client
+// Config contains the configuration of a client. DebugLog receives dumps of requests
+// and responses. Dumps of concurrent requests are written one at a time so DebugLog
+// does not need to be safe for concurrent use. Timeout limits each HTTP request and
+// defaults to 30 seconds; long running calls like QueueAndWait are bounded by their
+// context instead. UserAgent identifies the application, e.g. myapp/1.2.0, and is sent in
+// front of the User-Agent of this library. MaxAttempts is the number of times a request
+// is sent when Iron answers 429 Too Many Requests, or 503 Service Unavailable for idempotent
+// requests. It defaults to 3, use 1 to disable retries
 type Config struct {
 	BaseURL     string        `cloud:"-" json:"base_url,omitempty"`
 	Debug       bool          `cloud:"-" json:"-"`
 	DebugLog    io.Writer     `cloud:"-" json:"-"`
+	Timeout     time.Duration `cloud:"-" json:"-"`
 	ClusterInfo []ClusterInfo `cloud:"cluster_info" json:"cluster_info"`
 	Email       string        `cloud:"email" json:"email"`
 	Password    string        `cloud:"password" json:"password"`
@@ -34,6 +57,8 @@ type Config struct {
 	ProjectID   string        `cloud:"project_id" json:"project_id"`
 	Token       string        `cloud:"token" json:"token"`
 	UserID      string        `cloud:"user_id" json:"user_id"`
+	UserAgent   string        `cloud:"-" json:"-"`
+	MaxAttempts int           `cloud:"-" json:"-"`
 }
 
 // ClusterInfo contains details on an Iron cluster
@@ -50,8 +75,18 @@ type Client struct {
 
 	config *Config
 
+	iamClient *iam.Client
+
+	tokenLock sync.RWMutex
+	token     string
+
 	baseIRONURL *url.URL
 
+	closed atomic.Bool
+
+	// derived is set for clients of WithProject, which share the connections of another client
+	derived bool
+
 	// User agent used when communicating with the HSDP IAM API.
 	UserAgent string
 
@@ -59,22 +94,41 @@ type Client struct {
 	Codes     *CodesServices
 	Clusters  *ClustersServices
 	Schedules *SchedulesServices
+	Projects  *ProjectsServices
 }
 
 // NewClient returns a new HSDP Iron API client. If a nil httpClient is
 // provided, http.DefaultClient will be used. A configured IAM client must be provided
 // as well
 func NewClient(config *Config) (*Client, error) {
-	return newClient(config)
+	return newClient(nil, config)
+}
+
+// NewClientWithIAM returns a new HSDP Iron API client which authenticates using
+// bearer tokens of a configured IAM client instead of the static Config.Token.
+// A token is obtained from the IAM client for each request so it is refreshed as needed
+func NewClientWithIAM(iamClient *iam.Client, config *Config) (*Client, error) {
+	if iamClient == nil {
+		return nil, ErrMissingIAMClient
+	}
+	return newClient(iamClient, config)
 }
 
-func newClient(config *Config) (*Client, error) {
+func newClient(iamClient *iam.Client, config *Config) (*Client, error) {
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
 	httpClient := &http.Client{
 		Transport: &http.Transport{
 			Proxy: http.ProxyFromEnvironment,
 		},
+		Timeout: timeout,
+	}
+	c := &Client{config: config, iamClient: iamClient, token: config.Token, UserAgent: userAgent, client: httpClient}
+	if config.UserAgent != "" {
+		c.UserAgent = config.UserAgent + " " + userAgent
 	}
-	c := &Client{config: config, UserAgent: userAgent, client: httpClient}
 	useURL := IronBaseURL
 	if config.BaseURL != "" {
 		useURL = config.BaseURL
@@ -86,13 +140,59 @@ func newClient(config *Config) (*Client, error) {
 		httpClient.Transport = internal.NewLoggingRoundTripper(httpClient.Transport, config.DebugLog)
 	}
 
-	c.Tasks = &TasksServices{client: c, projectID: config.ProjectID}
-	c.Codes = &CodesServices{client: c, projectID: config.ProjectID, token: config.Token}
-	c.Clusters = &ClustersServices{client: c, projectID: config.ProjectID}
-	c.Schedules = &SchedulesServices{client: c, projectID: config.ProjectID}
+	c.setServices(config.ProjectID)
 	return c, nil
 }
 
+// setServices creates the services of c which address the project with projectID
+func (c *Client) setServices(projectID string) {
+	c.Tasks = &TasksServices{client: c, projectID: projectID}
+	c.Codes = &CodesServices{client: c, projectID: projectID}
+	c.Clusters = &ClustersServices{client: c, projectID: projectID}
+	c.Schedules = &SchedulesServices{client: c, projectID: projectID}
+	c.Projects = &ProjectsServices{client: c, projectID: projectID}
+}
+
+// WithProject returns a client for the project with projectID which uses the connections,
+// credentials and settings of c, so one authenticated client can address several projects.
+// Creating it is cheap. The token must grant access to the project: an Iron user token, e.g.
+// of an Iron cloud configuration, can access every project of the user but a project token
+// only its own project, and a bearer token of NewClientWithIAM only the projects IAM permits.
+// Requests for other projects fail with 401 Unauthorized. SetToken and Close only affect the
+// client they are called on, Close of the returned client leaves the shared connections open
+func (c *Client) WithProject(projectID string) *Client {
+	config := *c.config
+	config.ProjectID = projectID
+	c.tokenLock.RLock()
+	token := c.token
+	c.tokenLock.RUnlock()
+	p := &Client{
+		client:      c.client,
+		config:      &config,
+		iamClient:   c.iamClient,
+		token:       token,
+		baseIRONURL: c.baseIRONURL,
+		UserAgent:   c.UserAgent,
+		derived:     true,
+	}
+	p.closed.Store(c.closed.Load())
+	p.setServices(projectID)
+	return p
+}
+
+// Close closes the idle connections of the client. The client must not be used after
+// Close, requests then fail with ErrClientClosed. The Config.DebugLog writer is owned by
+// the caller and is left open. Calling Close more than once is a no-op. A client of
+// WithProject shares the connections of the client it was derived from, its Close only
+// marks it closed
+func (c *Client) Close() error {
+	if c.closed.Swap(true) || c.derived {
+		return nil
+	}
+	c.client.CloseIdleConnections()
+	return nil
+}
+
 func (c ClusterInfo) Encrypt(payload []byte) (string, error) {
 	if c.Pubkey == "" {
 		return "", ErrNoPublicKey
@@ -100,8 +200,14 @@ func (c ClusterInfo) Encrypt(payload []byte) (string, error) {
 	return EncryptPayload([]byte(c.Pubkey), payload)
 }
 
-// Close releases allocated resources of clients
-func (c *Client) Close() {
+// knownCluster reports whether clusterID is one of the configured clusters
+func (c *Client) knownCluster(clusterID string) bool {
+	for _, info := range c.config.ClusterInfo {
+		if info.ClusterID == clusterID {
+			return true
+		}
+	}
+	return false
 }
 
 // SetBaseIronURL sets the base URL for API requests to a custom endpoint. urlStr
@@ -143,6 +249,10 @@ func (c *Client) newRequest(method, path string, opt interface{}, options []Opti
 		Header:     make(http.Header),
 		Host:       u.Host,
 	}
+	req.Header.Set("Accept", "application/json")
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
 
 	for _, fn := range options {
 		if fn == nil {
@@ -154,7 +264,9 @@ func (c *Client) newRequest(method, path string, opt interface{}, options []Opti
 		}
 	}
 
-	req.Header.Set("Authorization", "OAuth "+c.config.Token)
+	if err := c.setAuthorization(req); err != nil {
+		return nil, err
+	}
 	if (method == "POST" || method == "PUT") && opt != nil {
 		bodyBytes, err := json.Marshal(opt)
 		if err != nil {
@@ -165,22 +277,75 @@ func (c *Client) newRequest(method, path string, opt interface{}, options []Opti
 		u.RawQuery = ""
 		req.Body = io.NopCloser(bodyReader)
 		req.ContentLength = int64(bodyReader.Len())
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(bodyBytes)), nil
+		}
 		req.Header.Set("Content-Type", "application/json")
 	}
-	req.Header.Set("Accept", "application/json")
+	return req, nil
+}
 
-	if c.UserAgent != "" {
-		req.Header.Set("User-Agent", c.UserAgent)
+// setAuthorization sets the Authorization header using either the IAM client
+// bearer token or the static Iron project token
+func (c *Client) setAuthorization(req *http.Request) error {
+	if c.iamClient != nil {
+		token, err := c.iamClient.Token()
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
 	}
-	return req, nil
+	c.tokenLock.RLock()
+	defer c.tokenLock.RUnlock()
+	req.Header.Set("Authorization", "OAuth "+c.token)
+	return nil
 }
 
-// Response is a HSDP IAM API response. This wraps the standard http.Response
-// returned from HSDP IAM and provides convenient access to things like errors
+// SetToken replaces the Iron project token used for subsequent requests. Requests
+// already in flight keep using the token they were created with. The Iron API offers
+// no token rotation itself so rotate the token externally and pass the new value here.
+// SetToken has no effect on clients created with NewClientWithIAM
+func (c *Client) SetToken(token string) {
+	c.tokenLock.Lock()
+	defer c.tokenLock.Unlock()
+	c.token = token
+}
+
+// Response is a HSDP Iron API response. This wraps the standard http.Response
+// returned from HSDP Iron and provides convenient access to things like errors.
+// Every service method returns it, also on errors, so callers can inspect the
+// status code and headers
 type Response struct {
 	*http.Response
 }
 
+// RateLimit holds the values of the X-RateLimit-* response headers
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// RateLimit returns the rate limit reported by Iron. The bool is false when the
+// response carries no X-RateLimit-Limit header
+func (r *Response) RateLimit() (RateLimit, bool) {
+	var rateLimit RateLimit
+	if r == nil || r.Response == nil {
+		return rateLimit, false
+	}
+	limit, err := strconv.Atoi(r.Header.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return rateLimit, false
+	}
+	rateLimit.Limit = limit
+	rateLimit.Remaining, _ = strconv.Atoi(r.Header.Get("X-RateLimit-Remaining"))
+	if reset, err := strconv.ParseInt(r.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		rateLimit.Reset = time.Unix(reset, 0)
+	}
+	return rateLimit, true
+}
+
 // newResponse creates a new Response for the provided http.Response.
 func newResponse(r *http.Response) *Response {
 	response := &Response{Response: r}
@@ -188,7 +353,10 @@ func newResponse(r *http.Response) *Response {
 }
 
 func (c *Client) do(req *http.Request, v interface{}) (*Response, error) {
-	resp, err := c.client.Do(req)
+	if c.closed.Load() {
+		return nil, ErrClientClosed
+	}
+	resp, err := c.send(req)
 	if err != nil {
 		return nil, err
 	}
@@ -209,6 +377,91 @@ func (c *Client) do(req *http.Request, v interface{}) (*Response, error) {
 	return response, err
 }
 
+// send sends req up to Config.MaxAttempts times while Iron rate limits it. The wait between
+// attempts is the Retry-After of the response or else doubles from minRetryBackoff. Requests
+// with a body which cannot be replayed are sent once
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	attempts := c.config.MaxAttempts
+	if attempts <= 0 {
+		attempts = defaultMaxAttempts
+	}
+	backoff := minRetryBackoff
+	for attempt := 1; ; attempt++ {
+		resp, err := c.client.Do(req)
+		if err != nil || attempt >= attempts || !retryable(req, resp.StatusCode) || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+		wait := retryAfter(resp, backoff)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+		if backoff *= 2; backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// retryable reports whether req can be sent again after a response with status. A 429
+// means Iron did not process the request at all, a 503 may come after it did so only
+// idempotent requests are retried
+func retryable(req *http.Request, status int) bool {
+	switch status {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusServiceUnavailable:
+		switch req.Method {
+		case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+			return true
+		}
+	}
+	return false
+}
+
+// retryAfter returns the wait of the Retry-After header of resp, in seconds or as a date,
+// capped at maxRetryBackoff. fallback is returned when there is no valid header
+func retryAfter(resp *http.Response, fallback time.Duration) time.Duration {
+	value := resp.Header.Get("Retry-After")
+	wait := fallback
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		wait = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		wait = time.Until(at)
+		if wait < 0 {
+			wait = 0
+		}
+	}
+	if wait > maxRetryBackoff {
+		wait = maxRetryBackoff
+	}
+	return wait
+}
+
+// WithContext runs the request with the provided context
+func WithContext(ctx context.Context) OptionFunc {
+	return func(req *http.Request) error {
+		*req = *req.WithContext(ctx)
+		return nil
+	}
+}
+
+// WithHeader sets the request header key to value, e.g. to propagate tracing headers
+// or a ticket reference for HSDP support. It overrides the default headers of the client
+func WithHeader(key, value string) OptionFunc {
+	return func(req *http.Request) error {
+		req.Header.Set(key, value)
+		return nil
+	}
+}
+
 func (c *Client) Path(components ...string) string {
 	return "/2/" + strings.Join(components, "/")
 }
@@ -1,10 +1,20 @@
 package iron_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/philips-software/go-hsdp-api/iam"
 	"github.com/philips-software/go-hsdp-api/iron"
 
 	"github.com/stretchr/testify/assert"
@@ -75,3 +85,413 @@ func TestClusterInfo_Encrypt(t *testing.T) {
 	}
 	assert.Equal(t, 224, len(encrypted))
 }
+
+func TestClient_WithContext(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	muxIRON.HandleFunc(client.Path("projects", projectID, "tasks"), func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, _, err := client.Tasks.GetTasks(iron.WithContext(ctx))
+	if !assert.NotNil(t, err) {
+		return
+	}
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestNewClientWithIAM(t *testing.T) {
+	muxIAM := http.NewServeMux()
+	serverIAM := httptest.NewServer(muxIAM)
+	defer serverIAM.Close()
+	muxIRON = http.NewServeMux()
+	serverIRON = httptest.NewServer(muxIRON)
+	defer serverIRON.Close()
+
+	loginToken := "44d20214-7879-4e35-923d-f9d4e01c9746"
+	refreshedToken := "55d20214-7879-4e35-923d-f9d4e01c9746"
+
+	muxIAM.HandleFunc("/authorize/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		assert.Nil(t, err)
+		returnToken := loginToken
+		if r.Form.Get("grant_type") == "refresh_token" {
+			returnToken = refreshedToken
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+    "scope": "mail",
+    "access_token": "`+returnToken+`",
+    "refresh_token": "31f1a449-ef8e-4bfc-a227-4f2353fde547",
+    "expires_in": 1799,
+    "token_type": "Bearer"
+}`)
+	})
+	var seen []string
+	muxIRON.HandleFunc("/2/projects/"+projectID+"/tasks", func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"tasks": []}`)
+	})
+
+	_, err := iron.NewClientWithIAM(nil, &iron.Config{})
+	assert.True(t, errors.Is(err, iron.ErrMissingIAMClient))
+
+	iamClient, err := iam.NewClient(nil, &iam.Config{
+		OAuth2ClientID: "TestClient",
+		OAuth2Secret:   "Secret",
+		IAMURL:         serverIAM.URL,
+		IDMURL:         serverIAM.URL,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	err = iamClient.Login("username", "password")
+	if !assert.Nil(t, err) {
+		return
+	}
+	iamIronClient, err := iron.NewClientWithIAM(iamClient, &iron.Config{
+		BaseURL:   serverIRON.URL,
+		ProjectID: projectID,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, _, err = iamIronClient.Tasks.GetTasks()
+	assert.Nil(t, err)
+	iamClient.ExpireToken()
+	_, _, err = iamIronClient.Tasks.GetTasks()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Bearer " + loginToken, "Bearer " + refreshedToken}, seen)
+}
+
+func TestClient_SetToken(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	newToken := "Zq9eZakYwqoui5znoH4x"
+	var seen []string
+	muxIRON.HandleFunc(client.Path("projects", projectID, "tasks"), func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"tasks": []}`)
+	})
+
+	_, _, err := client.Tasks.GetTasks()
+	assert.Nil(t, err)
+	client.SetToken(newToken)
+	_, _, err = client.Tasks.GetTasks()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"OAuth " + token, "OAuth " + newToken}, seen)
+}
+
+func TestClient_ConcurrentDebugLog(t *testing.T) {
+	muxIRON = http.NewServeMux()
+	serverIRON = httptest.NewServer(muxIRON)
+	defer serverIRON.Close()
+
+	var debugLog bytes.Buffer
+	debugClient, err := iron.NewClient(&iron.Config{
+		BaseURL:   serverIRON.URL,
+		ProjectID: projectID,
+		Token:     token,
+		DebugLog:  &debugLog,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	muxIRON.HandleFunc(debugClient.Path("projects", projectID, "tasks"), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"tasks":[{"id":"bFp7OMpXdVsvRHp4sVtqb3gV"}],"msg":"Queued up"}`)
+	})
+
+	count := 10
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := debugClient.Tasks.QueueTask(iron.Task{CodeName: "foo"})
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+
+	output := debugLog.String()
+	assert.Equal(t, count, strings.Count(output, "--- request start ---"))
+	assert.Equal(t, count, strings.Count(output, "--- response end ---"))
+	assert.NotContains(t, output, token)
+}
+
+func TestResponse_RateLimit(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	rateLimited := true
+	muxIRON.HandleFunc(client.Path("projects", projectID, "tasks"), func(w http.ResponseWriter, r *http.Request) {
+		if rateLimited {
+			w.Header().Set("X-RateLimit-Limit", "100")
+			w.Header().Set("X-RateLimit-Remaining", "42")
+			w.Header().Set("X-RateLimit-Reset", "1600000000")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"tasks": []}`)
+	})
+
+	_, resp, err := client.Tasks.GetTasks()
+	if !assert.Nil(t, err) {
+		return
+	}
+	rateLimit, ok := resp.RateLimit()
+	assert.True(t, ok)
+	assert.Equal(t, 100, rateLimit.Limit)
+	assert.Equal(t, 42, rateLimit.Remaining)
+	assert.Equal(t, time.Unix(1600000000, 0), rateLimit.Reset)
+
+	rateLimited = false
+	_, resp, err = client.Tasks.GetTasks()
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, ok = resp.RateLimit()
+	assert.False(t, ok)
+
+	var nilResponse *iron.Response
+	_, ok = nilResponse.RateLimit()
+	assert.False(t, ok)
+}
+
+func TestClient_Timeout(t *testing.T) {
+	muxIRON = http.NewServeMux()
+	serverIRON = httptest.NewServer(muxIRON)
+	defer serverIRON.Close()
+
+	timeoutClient, err := iron.NewClient(&iron.Config{
+		BaseURL:   serverIRON.URL,
+		ProjectID: projectID,
+		Token:     token,
+		Timeout:   50 * time.Millisecond,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	taskID := "bFp7OMpXdVsvRHp4sVtqb3gV"
+	muxIRON.HandleFunc(timeoutClient.Path("projects", projectID, "tasks", taskID), func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"id":"`+taskID+`","status":"running"}`)
+	})
+
+	start := time.Now()
+	_, _, err = timeoutClient.Tasks.GetTask(taskID)
+	assert.NotNil(t, err)
+	assert.Less(t, time.Since(start), 400*time.Millisecond)
+}
+
+func TestClient_Close(t *testing.T) {
+	muxIRON = http.NewServeMux()
+	serverIRON = httptest.NewServer(muxIRON)
+	defer serverIRON.Close()
+
+	closingClient, err := iron.NewClient(&iron.Config{
+		BaseURL:   serverIRON.URL,
+		ProjectID: projectID,
+		Token:     token,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	taskID := "bFp7OMpXdVsvRHp4sVtqb3gV"
+	muxIRON.HandleFunc(closingClient.Path("projects", projectID, "tasks", taskID), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"id":"`+taskID+`","status":"running"}`)
+	})
+	_, _, err = closingClient.Tasks.GetTask(taskID)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Nil(t, closingClient.Close())
+	assert.Nil(t, closingClient.Close())
+	_, _, err = closingClient.Tasks.GetTask(taskID)
+	assert.ErrorIs(t, err, iron.ErrClientClosed)
+}
+
+func TestClient_UserAgentAndHeaders(t *testing.T) {
+	muxIRON = http.NewServeMux()
+	serverIRON = httptest.NewServer(muxIRON)
+	defer serverIRON.Close()
+
+	ironClient, err := iron.NewClient(&iron.Config{
+		BaseURL:   serverIRON.URL,
+		ProjectID: projectID,
+		Token:     token,
+		UserAgent: "myapp/1.2.0",
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	muxIRON.HandleFunc(ironClient.Path("projects", projectID, "tasks"), func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasPrefix(r.Header.Get("User-Agent"), "myapp/1.2.0 go-hsdp-api/iron/"))
+		assert.Equal(t, "SR-1234", r.Header.Get("X-Ticket"))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"tasks": []}`)
+	})
+
+	_, _, err = ironClient.Tasks.GetTasks(iron.WithHeader("X-Ticket", "SR-1234"))
+	assert.Nil(t, err)
+
+	codeID := "K6hyfuQzEmB9tDnKKHbKljjr"
+	muxIRON.HandleFunc(ironClient.Path("projects", projectID, "codes"), func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasPrefix(r.Header.Get("User-Agent"), "myapp/1.2.0 go-hsdp-api/iron/"))
+		assert.Equal(t, "application/json", r.Header.Get("Accept"))
+		assert.Equal(t, "SR-1234", r.Header.Get("X-Ticket"))
+		assert.Equal(t, "OAuth "+token, r.Header.Get("Authorization"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data"))
+		assert.Contains(t, r.FormValue("data"), "loafoe/siderite")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"id":"`+codeID+`"}`)
+	})
+	muxIRON.HandleFunc(ironClient.Path("projects", projectID, "codes", codeID), func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasPrefix(r.Header.Get("User-Agent"), "myapp/1.2.0 go-hsdp-api/iron/"))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"id": "`+codeID+`", "name": "siderite", "image": "loafoe/siderite:0.99.20"}`)
+	})
+	code, _, err := ironClient.Codes.CreateOrUpdateCode(iron.Code{
+		Name:  "siderite",
+		Image: "loafoe/siderite:0.99.20",
+	}, iron.WithHeader("X-Ticket", "SR-1234"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, codeID, code.ID)
+	}
+}
+
+func TestClient_WithProject(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	otherProjectID := "5e20da41d748ad000ace7655"
+	for _, id := range []string{projectID, otherProjectID} {
+		id := id
+		muxIRON.HandleFunc(client.Path("projects", id, "tasks"), func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "OAuth "+token, r.Header.Get("Authorization"))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, _ = io.WriteString(w, `{"tasks": [{"id": "task-`+id+`", "project_id": "`+id+`"}]}`)
+		})
+	}
+
+	other := client.WithProject(otherProjectID)
+	tasks, _, err := other.Tasks.GetTasks()
+	if assert.Nil(t, err) && assert.Len(t, *tasks, 1) {
+		assert.Equal(t, otherProjectID, (*tasks)[0].ProjectID)
+	}
+	tasks, _, err = client.Tasks.GetTasks()
+	if assert.Nil(t, err) && assert.Len(t, *tasks, 1) {
+		assert.Equal(t, projectID, (*tasks)[0].ProjectID)
+	}
+
+	_ = other.Close()
+	_, _, err = other.Tasks.GetTasks()
+	assert.True(t, errors.Is(err, iron.ErrClientClosed))
+	_, _, err = client.Tasks.GetTasks()
+	assert.Nil(t, err)
+}
+
+func TestClient_WithProjectCloseKeepsConnections(t *testing.T) {
+	var connections int32
+	mux := http.NewServeMux()
+	server := httptest.NewUnstartedServer(mux)
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	ironClient, err := iron.NewClient(&iron.Config{
+		BaseURL:   server.URL,
+		ProjectID: projectID,
+		Token:     token,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	mux.HandleFunc(ironClient.Path("projects", projectID, "tasks"), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"tasks": []}`)
+	})
+
+	_, _, err = ironClient.Tasks.GetTasks()
+	assert.Nil(t, err)
+	_ = ironClient.WithProject("5e20da41d748ad000ace7655").Close()
+	_, _, err = ironClient.Tasks.GetTasks()
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&connections))
+}
+
+func TestClient_RetryRateLimited(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	requests := 0
+	status := http.StatusTooManyRequests
+	muxIRON.HandleFunc(client.Path("projects", projectID, "tasks"), func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := io.ReadAll(r.Body)
+		assert.Contains(t, string(body), "loafoe/siderite")
+		w.Header().Set("Content-Type", "application/json")
+		if requests < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(status)
+			_, _ = io.WriteString(w, `{"msg":"Too Many Requests"}`)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"tasks":[{"id":"bFp7OMpXdVsvRHp4sVtqb3gV"}],"msg":"Queued up"}`)
+	})
+
+	task, resp, err := client.Tasks.QueueTask(iron.Task{CodeName: "loafoe/siderite"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "bFp7OMpXdVsvRHp4sVtqb3gV", task.ID)
+	assert.Equal(t, 3, requests)
+
+	// A POST may have been processed before a 503 so it is not retried
+	requests, status = 0, http.StatusServiceUnavailable
+	_, resp, _ = client.Tasks.QueueTask(iron.Task{CodeName: "loafoe/siderite"})
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, 1, requests)
+
+	single, err := iron.NewClient(&iron.Config{
+		BaseURL:     serverIRON.URL,
+		ProjectID:   projectID,
+		Token:       token,
+		MaxAttempts: 1,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	requests, status = 0, http.StatusTooManyRequests
+	_, resp, _ = single.Tasks.QueueTask(iron.Task{CodeName: "loafoe/siderite"})
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, 1, requests)
+}
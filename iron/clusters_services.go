@@ -55,13 +55,13 @@ type ClusterStats struct {
 // GetClusters gets the list of available clusters
 // In some cases a token might not have the proper scope
 // to retrieve a list of clusters in which case the list will be empty
-func (c *ClustersServices) GetClusters() (*[]Cluster, *Response, error) {
+func (c *ClustersServices) GetClusters(options ...OptionFunc) (*[]Cluster, *Response, error) {
 	page := 0
 	perPage := 100
 	req, err := c.client.newRequest("GET", c.client.Path("clusters"), pageOptions{
 		PerPage: &perPage,
 		Page:    &page,
-	}, nil)
+	}, options)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -73,8 +73,8 @@ func (c *ClustersServices) GetClusters() (*[]Cluster, *Response, error) {
 }
 
 // GetCluster gets cluster details
-func (c *ClustersServices) GetCluster(clusterID string) (*Cluster, *Response, error) {
-	req, err := c.client.newRequest("GET", c.client.Path("clusters", clusterID), nil, nil)
+func (c *ClustersServices) GetCluster(clusterID string, options ...OptionFunc) (*Cluster, *Response, error) {
+	req, err := c.client.newRequest("GET", c.client.Path("clusters", clusterID), nil, options)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -86,8 +86,8 @@ func (c *ClustersServices) GetCluster(clusterID string) (*Cluster, *Response, er
 }
 
 // GetClusterStats gets cluster statistics
-func (c *ClustersServices) GetClusterStats(clusterID string) (*ClusterStats, *Response, error) {
-	req, err := c.client.newRequest("GET", c.client.Path("clusters", clusterID, "stats"), nil, nil)
+func (c *ClustersServices) GetClusterStats(clusterID string, options ...OptionFunc) (*ClusterStats, *Response, error) {
+	req, err := c.client.newRequest("GET", c.client.Path("clusters", clusterID, "stats"), nil, options)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -8,26 +8,44 @@ import (
 	"io"
 	"mime/multipart"
 	"net/http"
+	"regexp"
 	"time"
 )
 
 type CodesServices struct {
 	client    *Client
-	token     string
 	projectID string
 }
 
-// Code describes a Iron code package
+// Code describes a Iron code package. Config is made available to the worker
+// as a file referenced by the CONFIG_FILE environment variable, EnvVars are set
+// in the environment of every task that runs the code. MaxConcurrency limits the
+// number of tasks of the code which run in parallel, zero means no limit
 type Code struct {
-	ID              string     `json:"id,omitempty"`
-	CreatedAt       *time.Time `json:"created_at,omitempty"`
-	ProjectID       string     `json:"project_id,omitempty"`
-	Name            string     `json:"name"`
-	Image           string     `json:"image"`
-	LatestChecksum  string     `json:"latest_checksum,omitempty"`
-	Rev             int        `json:"rev,omitempty"`
-	LatestHistoryID string     `json:"latest_history_id,omitempty"`
-	LatestChange    *time.Time `json:"latest_change,omitempty"`
+	ID              string            `json:"id,omitempty"`
+	CreatedAt       *time.Time        `json:"created_at,omitempty"`
+	ProjectID       string            `json:"project_id,omitempty"`
+	Name            string            `json:"name"`
+	Image           string            `json:"image"`
+	Stack           string            `json:"stack,omitempty"`
+	LatestChecksum  string            `json:"latest_checksum,omitempty"`
+	Rev             int               `json:"rev,omitempty"`
+	LatestHistoryID string            `json:"latest_history_id,omitempty"`
+	LatestChange    *time.Time        `json:"latest_change,omitempty"`
+	Config          string            `json:"config,omitempty"`
+	EnvVars         map[string]string `json:"env_vars,omitempty"`
+	MaxConcurrency  int               `json:"max_concurrency,omitempty"`
+}
+
+// CodeRevision describes an uploaded revision of a Iron code package
+type CodeRevision struct {
+	ID        string     `json:"id"`
+	CodeID    string     `json:"code_id"`
+	ProjectID string     `json:"project_id,omitempty"`
+	Rev       int        `json:"rev"`
+	Name      string     `json:"name,omitempty"`
+	Image     string     `json:"image,omitempty"`
+	BuildTime *time.Time `json:"build_time,omitempty"`
 }
 
 // DockerCredentials describes a set of docker credentials
@@ -45,8 +63,32 @@ func (d DockerCredentials) Valid() bool {
 	return true
 }
 
-// CreateOrUpdateCode creates or updates code packages on Iron which can be used to run tasks
-func (c *CodesServices) CreateOrUpdateCode(code Code) (*Code, *Response, error) {
+// imageReference matches a docker image reference, e.g. registry.example.com:5000/team/app:1.2
+// or app@sha256:<digest>. It is a simplified form of the grammar of the docker distribution
+var imageReference = regexp.MustCompile(`^[a-z0-9]+(?:[._-][a-z0-9]+)*(?::[0-9]+)?(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*(?::[\w][\w.-]{0,127})?(?:@sha256:[a-f0-9]{64})?$`)
+
+// Validate checks the code before it is uploaded. Iron runs codes from docker images so
+// the code needs a name and a well-formed image reference. The image itself is only
+// pulled when a task runs
+func (c Code) Validate() error {
+	if c.Name == "" {
+		return ErrMissingCodeName
+	}
+	if c.Image == "" {
+		return ErrMissingImage
+	}
+	if !imageReference.MatchString(c.Image) {
+		return fmt.Errorf("%w: [%s]", ErrInvalidImage, c.Image)
+	}
+	return nil
+}
+
+// CreateOrUpdateCode creates or updates code packages on Iron which can be used to run tasks.
+// The code is validated first, see Code.Validate
+func (c *CodesServices) CreateOrUpdateCode(code Code, options ...OptionFunc) (*Code, *Response, error) {
+	if err := code.Validate(); err != nil {
+		return nil, nil, err
+	}
 	var b bytes.Buffer
 	var err error
 	var fw io.Writer
@@ -62,12 +104,17 @@ func (c *CodesServices) CreateOrUpdateCode(code Code) (*Code, *Response, error)
 	}
 	_ = w.Close()
 
-	req, err := http.NewRequest("POST", c.client.baseIRONURL.String()+"/2/projects/"+c.projectID+"/codes", &b)
+	req, err := c.client.newRequest("POST", c.client.Path("projects", c.projectID, "codes"), nil, options)
 	if err != nil {
 		return nil, nil, err
 	}
+	body := b.Bytes()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
 	req.Header.Set("Content-Type", w.FormDataContentType())
-	req.Header.Set("Authorization", "OAuth "+c.token)
 
 	var createResponse struct {
 		Message string `json:"msg"`
@@ -80,10 +127,10 @@ func (c *CodesServices) CreateOrUpdateCode(code Code) (*Code, *Response, error)
 	if createResponse.ID == "" {
 		return nil, resp, fmt.Errorf("empty code value: '%s'", createResponse.Message)
 	}
-	return c.GetCode(createResponse.ID)
+	return c.GetCode(createResponse.ID, options...)
 }
 
-func (c *CodesServices) GetCodes() (*[]Code, *Response, error) {
+func (c *CodesServices) GetCodes(options ...OptionFunc) (*[]Code, *Response, error) {
 	getPath := c.client.Path("projects", c.projectID, "codes")
 
 	page := 0
@@ -96,7 +143,7 @@ func (c *CodesServices) GetCodes() (*[]Code, *Response, error) {
 			Page:    &page,
 			PerPage: &perPage,
 		},
-		nil)
+		options)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -107,12 +154,12 @@ func (c *CodesServices) GetCodes() (*[]Code, *Response, error) {
 	return &codes.Codes, resp, err
 }
 
-func (c *CodesServices) GetCode(codeID string) (*Code, *Response, error) {
+func (c *CodesServices) GetCode(codeID string, options ...OptionFunc) (*Code, *Response, error) {
 	req, err := c.client.newRequest(
 		"GET",
 		c.client.Path("projects", c.projectID, "codes", codeID),
 		nil,
-		nil)
+		options)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -121,13 +168,106 @@ func (c *CodesServices) GetCode(codeID string) (*Code, *Response, error) {
 	return &code, resp, err
 }
 
+// GetCodeRevisions lists the revisions of a code. Every CreateOrUpdateCode of the code adds one
+func (c *CodesServices) GetCodeRevisions(codeID string, options ...OptionFunc) ([]CodeRevision, *Response, error) {
+	page := 0
+	perPage := 100
+
+	req, err := c.client.newRequest(
+		"GET",
+		c.client.Path("projects", c.projectID, "codes", codeID, "revisions"),
+		pageOptions{
+			Page:    &page,
+			PerPage: &perPage,
+		},
+		options)
+	if err != nil {
+		return nil, nil, err
+	}
+	var revisions struct {
+		Revisions []CodeRevision `json:"revisions"`
+	}
+	resp, err := c.client.do(req, &revisions)
+	return revisions.Revisions, resp, err
+}
+
+// RollbackCode makes the image of revision rev the active image of the code. Iron has no
+// way to re-activate a revision so the code is updated, creating a new revision with the
+// image of rev. Tasks can instead be pinned to a revision using WithCodeRevision
+func (c *CodesServices) RollbackCode(codeID string, rev int, options ...OptionFunc) (*Code, *Response, error) {
+	revisions, resp, err := c.GetCodeRevisions(codeID, options...)
+	if err != nil {
+		return nil, resp, err
+	}
+	var revision *CodeRevision
+	for i := range revisions {
+		if revisions[i].Rev == rev {
+			revision = &revisions[i]
+			break
+		}
+	}
+	if revision == nil || revision.Image == "" {
+		return nil, resp, fmt.Errorf("revision %d of code %s: %w", rev, codeID, ErrNotFound)
+	}
+	code, resp, err := c.GetCode(codeID, options...)
+	if err != nil {
+		return nil, resp, err
+	}
+	return c.CreateOrUpdateCode(Code{
+		Name:           code.Name,
+		Image:          revision.Image,
+		Stack:          code.Stack,
+		Config:         code.Config,
+		EnvVars:        code.EnvVars,
+		MaxConcurrency: code.MaxConcurrency,
+	}, options...)
+}
+
+// SetCodeMaxConcurrency limits the number of tasks of the code which run in parallel,
+// e.g. to protect a downstream system during an incident. Zero removes the limit.
+// Like RollbackCode this updates the code, creating a new revision with the same image.
+// The limit of the project as a whole is set by HSDP, see ProjectsServices.MaxConcurrency
+func (c *CodesServices) SetCodeMaxConcurrency(codeID string, maxConcurrency int, options ...OptionFunc) (*Code, *Response, error) {
+	if maxConcurrency < 0 {
+		return nil, nil, ErrInvalidConcurrency
+	}
+	code, resp, err := c.GetCode(codeID, options...)
+	if err != nil {
+		return nil, resp, err
+	}
+	return c.CreateOrUpdateCode(Code{
+		Name:           code.Name,
+		Image:          code.Image,
+		Stack:          code.Stack,
+		Config:         code.Config,
+		EnvVars:        code.EnvVars,
+		MaxConcurrency: maxConcurrency,
+	}, options...)
+}
+
+// GetStacks lists the runtime stacks supported by Iron. Use it to validate
+// Code.Stack before uploading code instead of failing when a task runs
+func (c *CodesServices) GetStacks(options ...OptionFunc) ([]string, *Response, error) {
+	req, err := c.client.newRequest(
+		"GET",
+		c.client.Path("stacks"),
+		nil,
+		options)
+	if err != nil {
+		return nil, nil, err
+	}
+	var stacks []string
+	resp, err := c.client.do(req, &stacks)
+	return stacks, resp, err
+}
+
 // DeleteCode deletes a code from Iron
-func (c *CodesServices) DeleteCode(codeID string) (bool, *Response, error) {
+func (c *CodesServices) DeleteCode(codeID string, options ...OptionFunc) (bool, *Response, error) {
 	req, err := c.client.newRequest(
 		"DELETE",
 		c.client.Path("projects", c.projectID, "codes", codeID),
 		nil,
-		nil)
+		options)
 	if err != nil {
 		return false, nil, err
 	}
@@ -142,7 +282,7 @@ func (c *CodesServices) DeleteCode(codeID string) (bool, *Response, error) {
 }
 
 // DockerLogin stores private Docker registry credentials so Iron can fetch images when needed
-func (c *CodesServices) DockerLogin(creds DockerCredentials) (bool, *Response, error) {
+func (c *CodesServices) DockerLogin(creds DockerCredentials, options ...OptionFunc) (bool, *Response, error) {
 	if !creds.Valid() {
 		return false, nil, ErrInvalidDockerCredentials
 	}
@@ -159,7 +299,7 @@ func (c *CodesServices) DockerLogin(creds DockerCredentials) (bool, *Response, e
 		"POST",
 		c.client.Path("projects", c.projectID, "credentials"),
 		&authRequest,
-		nil)
+		options)
 	if err != nil {
 		return false, nil, err
 	}
@@ -1,8 +1,11 @@
 package iron_test
 
 import (
+	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/philips-software/go-hsdp-api/iron"
@@ -220,3 +223,199 @@ func TestCodesServices_DockerLogin(t *testing.T) {
 		return
 	}
 }
+
+func TestCodesServices_GetStacks(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	muxIRON.HandleFunc(client.Path("stacks"), func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, "GET", r.Method) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `["ruby-2.1","python-3.5","node-0.10","go-1.4"]`)
+	})
+
+	stacks, resp, err := client.Codes.GetStacks()
+	if !assert.Nil(t, err) {
+		return
+	}
+	if !assert.NotNil(t, resp) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"ruby-2.1", "python-3.5", "node-0.10", "go-1.4"}, stacks)
+}
+
+func TestCodesServices_CreateOrUpdateCodeEnvVars(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	codeID := "K6hyfuQzEmB9tDnKKHbKljjr"
+	muxIRON.HandleFunc(client.Path("projects", projectID, "codes"), func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, "POST", r.Method) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var code iron.Code
+		err := json.Unmarshal([]byte(r.FormValue("data")), &code)
+		if !assert.Nil(t, err) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		assert.Equal(t, `{"env":"test"}`, code.Config)
+		assert.Equal(t, map[string]string{"DATABASE_URL": "postgres://db.test/app"}, code.EnvVars)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"id":"`+codeID+`"}`)
+	})
+	muxIRON.HandleFunc(client.Path("projects", projectID, "codes", codeID), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "id": "`+codeID+`",
+  "name": "testandy",
+  "image": "loafoe/siderite:0.99.20",
+  "env_vars": {"DATABASE_URL": "postgres://db.test/app"}
+}`)
+	})
+
+	code, _, err := client.Codes.CreateOrUpdateCode(iron.Code{
+		Name:    "testandy",
+		Image:   "loafoe/siderite:0.99.20",
+		Config:  `{"env":"test"}`,
+		EnvVars: map[string]string{"DATABASE_URL": "postgres://db.test/app"},
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	if !assert.NotNil(t, code) {
+		return
+	}
+	assert.Equal(t, "postgres://db.test/app", code.EnvVars["DATABASE_URL"])
+}
+
+func TestCodesServices_RollbackCode(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	codeID := "K6hyfuQzEmB9tDnKKHbKljjr"
+	muxIRON.HandleFunc(client.Path("projects", projectID, "codes", codeID, "revisions"), func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, "GET", r.Method) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "revisions": [
+    {"id": "5ef3a3c96f3bb20009ba9952", "code_id": "`+codeID+`", "rev": 2, "name": "testandy", "image": "loafoe/siderite:0.99.20"},
+    {"id": "5ef3a3c96f3bb20009ba9951", "code_id": "`+codeID+`", "rev": 1, "name": "testandy", "image": "loafoe/siderite:0.99.19"}
+  ]
+}`)
+	})
+	var uploaded iron.Code
+	muxIRON.HandleFunc(client.Path("projects", projectID, "codes"), func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, "POST", r.Method) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if !assert.Nil(t, json.Unmarshal([]byte(r.FormValue("data")), &uploaded)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"id":"`+codeID+`"}`)
+	})
+	muxIRON.HandleFunc(client.Path("projects", projectID, "codes", codeID), func(w http.ResponseWriter, r *http.Request) {
+		image := "loafoe/siderite:0.99.20"
+		if uploaded.Image != "" {
+			image = uploaded.Image
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"id": "`+codeID+`", "name": "testandy", "image": "`+image+`", "rev": 2}`)
+	})
+
+	revisions, _, err := client.Codes.GetCodeRevisions(codeID)
+	if !assert.Nil(t, err) {
+		return
+	}
+	if !assert.Len(t, revisions, 2) {
+		return
+	}
+	assert.Equal(t, 1, revisions[1].Rev)
+
+	code, _, err := client.Codes.RollbackCode(codeID, 1)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "testandy", uploaded.Name)
+	assert.Equal(t, "loafoe/siderite:0.99.19", uploaded.Image)
+	assert.Equal(t, "loafoe/siderite:0.99.19", code.Image)
+
+	_, _, err = client.Codes.RollbackCode(codeID, 5)
+	assert.True(t, errors.Is(err, iron.ErrNotFound))
+}
+
+func TestCodesServices_SetCodeMaxConcurrency(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	codeID := "K6hyfuQzEmB9tDnKKHbKljjr"
+	var uploaded iron.Code
+	muxIRON.HandleFunc(client.Path("projects", projectID, "codes"), func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, "POST", r.Method) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if !assert.Nil(t, json.Unmarshal([]byte(r.FormValue("data")), &uploaded)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"id":"`+codeID+`"}`)
+	})
+	muxIRON.HandleFunc(client.Path("projects", projectID, "codes", codeID), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"id": "`+codeID+`", "name": "testandy", "image": "loafoe/siderite:0.99.20", "max_concurrency": 10}`)
+	})
+
+	_, _, err := client.Codes.SetCodeMaxConcurrency(codeID, 2)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "testandy", uploaded.Name)
+	assert.Equal(t, "loafoe/siderite:0.99.20", uploaded.Image)
+	assert.Equal(t, 2, uploaded.MaxConcurrency)
+
+	_, _, err = client.Codes.SetCodeMaxConcurrency(codeID, -1)
+	assert.True(t, errors.Is(err, iron.ErrInvalidConcurrency))
+}
+
+func TestCode_Validate(t *testing.T) {
+	for _, image := range []string{
+		"loafoe/siderite:0.99.20",
+		"siderite",
+		"docker.na1.hsdp.io/team/siderite:latest",
+		"registry.example.com:5000/team/my_app-worker:1.2",
+		"siderite@sha256:" + strings.Repeat("a", 64),
+	} {
+		assert.Nil(t, iron.Code{Name: "foo", Image: image}.Validate(), image)
+	}
+	for _, image := range []string{"Loafoe/Siderite", "loafoe/siderite:", "loafoe siderite", "loafoe//siderite"} {
+		assert.True(t, errors.Is(iron.Code{Name: "foo", Image: image}.Validate(), iron.ErrInvalidImage), image)
+	}
+	assert.True(t, errors.Is(iron.Code{Image: "siderite"}.Validate(), iron.ErrMissingCodeName))
+
+	teardown := setup(t)
+	defer teardown()
+
+	_, _, err := client.Codes.CreateOrUpdateCode(iron.Code{Name: "foo"})
+	assert.True(t, errors.Is(err, iron.ErrMissingImage))
+}
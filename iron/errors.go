@@ -8,4 +8,18 @@ var (
 	ErrNotFound                 = errors.New("not found")
 	ErrInvalidDockerCredentials = errors.New("invalid docker credentials. all fields required")
 	ErrNoPublicKey              = errors.New("no public key present")
+	ErrMissingLabel             = errors.New("missing task label")
+	ErrMissingIAMClient         = errors.New("missing IAM client")
+	ErrUnknownCluster           = errors.New("cluster is not available to the project")
+	ErrInvalidPriority          = errors.New("task priority must be between 0 and 2")
+	ErrInvalidDelay             = errors.New("task delay cannot be negative")
+	ErrInvalidTimeout           = errors.New("task timeout must be at least one second")
+	ErrUnexpectedStatus         = errors.New("unexpected response status")
+	ErrClientClosed             = errors.New("client is closed")
+	ErrInvalidRevision          = errors.New("code revision must be at least 1")
+	ErrMissingCodeName          = errors.New("missing code name")
+	ErrInvalidConcurrency       = errors.New("max concurrency cannot be negative")
+	ErrPayloadEncrypted         = errors.New("task payload is encrypted")
+	ErrMissingImage             = errors.New("missing code image")
+	ErrInvalidImage             = errors.New("invalid code image reference")
 )
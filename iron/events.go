@@ -0,0 +1,160 @@
+package iron
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Task event types
+const (
+	TaskEventQueued   = "queued"
+	TaskEventStarted  = "started"
+	TaskEventFinished = "finished"
+)
+
+// TaskEvent is a dispatch event of a task: it was queued, started on a cluster or finished.
+// Task is the state of the task when the event was observed, use its Status, Msg and
+// Cluster to tell why a finished task failed or where it ran
+type TaskEvent struct {
+	Time time.Time
+	Type string
+	Task Task
+}
+
+// taskEventsPageSize is the number of tasks fetched per page by TaskEvents
+const taskEventsPageSize = 100
+
+// TaskEvents returns the dispatch events between from and to, oldest first, e.g. to find out
+// whether a scheduled task was queued and why it failed. Iron offers no event log of its
+// clusters and scheduler, so the events are derived from the tasks of the project which were
+// created between from and to. Scaling and other cluster internal events are not available
+func (t *TasksServices) TaskEvents(ctx context.Context, from, to time.Time, options ...OptionFunc) ([]TaskEvent, error) {
+	tasks, _, err := t.tasksCreatedBetween(ctx, from, to, options...)
+	if err != nil {
+		return nil, err
+	}
+	return taskEvents(tasks, from, to), nil
+}
+
+// tasksCreatedBetween returns the tasks created between from and to. All pages are fetched.
+// The response is the one of the last page
+func (t *TasksServices) tasksCreatedBetween(ctx context.Context, from, to time.Time, options ...OptionFunc) ([]Task, *Response, error) {
+	options = append(append([]OptionFunc{}, options...), WithContext(ctx))
+	fromTime, toTime := from.Unix(), to.Unix()
+	perPage := taskEventsPageSize
+	tasks := make([]Task, 0)
+	for page := 0; ; page++ {
+		page := page
+		list, resp, err := t.ListTasks(&TaskListOptions{
+			Page:     &page,
+			PerPage:  &perPage,
+			FromTime: &fromTime,
+			ToTime:   &toTime,
+		}, options...)
+		if err != nil {
+			return nil, resp, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, resp, fmt.Errorf("%w: %d", ErrUnexpectedStatus, resp.StatusCode)
+		}
+		tasks = append(tasks, *list...)
+		if len(*list) < perPage {
+			return tasks, resp, nil
+		}
+	}
+}
+
+// taskEvents returns the events of tasks which happened between from and to, oldest first
+func taskEvents(tasks []Task, from, to time.Time) []TaskEvent {
+	events := make([]TaskEvent, 0, len(tasks))
+	add := func(at *time.Time, eventType string, task Task) {
+		if at == nil || at.Before(from) || at.After(to) {
+			return
+		}
+		events = append(events, TaskEvent{Time: *at, Type: eventType, Task: task})
+	}
+	for _, task := range tasks {
+		add(task.CreatedAt, TaskEventQueued, task)
+		add(task.StartTime, TaskEventStarted, task)
+		if task.IsFinished() || task.IsError() {
+			add(task.EndTime, TaskEventFinished, task)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+	return events
+}
+
+// TailTaskEvents polls every interval for the dispatch events which happened after since and
+// calls fn for each new event, oldest first, until ctx is done. Unfinished tasks are tracked so
+// their start and finish are reported even when they happen long after they were queued.
+// The error is ctx.Err() unless polling failed. See TaskEvents for the events available
+func (t *TasksServices) TailTaskEvents(ctx context.Context, since time.Time, interval time.Duration, fn func(TaskEvent), options ...OptionFunc) error {
+	if interval < minPollInterval {
+		interval = minPollInterval
+	}
+	seen := make(map[string]time.Time)       // event key to the creation time of its task
+	unfinished := make(map[string]time.Time) // task ID to its creation time
+	last := since
+	for {
+		now := time.Now()
+		// Overlap with the previous poll in case the clock of Iron differs from ours
+		from := last.Add(-interval)
+		if from.Before(since) {
+			from = since
+		}
+		for _, created := range unfinished {
+			if created.Before(from) {
+				from = created
+			}
+		}
+		tasks, resp, err := t.tasksCreatedBetween(ctx, from, now, options...)
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil && resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable):
+			// Try again at the next poll
+		case err != nil:
+			return err
+		default:
+			for _, event := range taskEvents(tasks, since, now) {
+				key := event.Task.ID + "/" + event.Type
+				if _, ok := seen[key]; ok {
+					continue
+				}
+				seen[key] = createdAt(event.Task, event.Time)
+				fn(event)
+			}
+			for _, task := range tasks {
+				if task.IsFinished() || task.IsError() {
+					delete(unfinished, task.ID)
+					continue
+				}
+				unfinished[task.ID] = createdAt(task, now)
+			}
+			for key, created := range seen {
+				if created.Before(from) {
+					delete(seen, key)
+				}
+			}
+			last = now
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// createdAt returns the creation time of task or fallback when it is unknown
+func createdAt(task Task, fallback time.Time) time.Time {
+	if task.CreatedAt == nil {
+		return fallback
+	}
+	return *task.CreatedAt
+}
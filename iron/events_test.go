@@ -0,0 +1,93 @@
+package iron_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/philips-software/go-hsdp-api/iron"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTasksServices_TaskEvents(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	from := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	muxIRON.HandleFunc(client.Path("projects", projectID, "tasks"), func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, strconv.FormatInt(from.Unix(), 10), r.URL.Query().Get("from_time"))
+		assert.Equal(t, strconv.FormatInt(to.Unix(), 10), r.URL.Query().Get("to_time"))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "tasks": [
+    {
+      "id": "task1",
+      "status": "error",
+      "msg": "exit status 1",
+      "schedule_id": "schedule1",
+      "cluster": "cluster1",
+      "created_at": "2022-03-01T10:05:00Z",
+      "start_time": "2022-03-01T10:06:00Z",
+      "end_time": "2022-03-01T10:07:00Z"
+    },
+    {
+      "id": "task2",
+      "status": "queued",
+      "created_at": "2022-03-01T10:01:00Z"
+    }
+  ]
+}`)
+	})
+
+	events, err := client.Tasks.TaskEvents(context.Background(), from, to)
+	if !assert.Nil(t, err) {
+		return
+	}
+	if !assert.Len(t, events, 4) {
+		return
+	}
+	assert.Equal(t, "task2", events[0].Task.ID)
+	assert.Equal(t, iron.TaskEventQueued, events[0].Type)
+	assert.Equal(t, iron.TaskEventStarted, events[2].Type)
+	assert.Equal(t, iron.TaskEventFinished, events[3].Type)
+	assert.Equal(t, "exit status 1", events[3].Task.Msg)
+}
+
+func TestTasksServices_TailTaskEvents(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	since := time.Now().Add(-time.Minute)
+	created := since.Add(10 * time.Second).UTC().Format(time.RFC3339)
+	var polls int32
+	muxIRON.HandleFunc(client.Path("projects", projectID, "tasks"), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if atomic.AddInt32(&polls, 1) == 1 {
+			_, _ = io.WriteString(w, fmt.Sprintf(`{"tasks": [{"id": "task1", "status": "queued", "created_at": %q}]}`, created))
+			return
+		}
+		end := time.Now().UTC().Format(time.RFC3339)
+		_, _ = io.WriteString(w, fmt.Sprintf(`{"tasks": [{"id": "task1", "status": "complete", "created_at": %q, "start_time": %q, "end_time": %q}]}`, created, created, end))
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var types []string
+	err := client.Tasks.TailTaskEvents(ctx, since, time.Second, func(event iron.TaskEvent) {
+		types = append(types, event.Type)
+		if event.Type == iron.TaskEventFinished {
+			cancel()
+		}
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []string{iron.TaskEventQueued, iron.TaskEventStarted, iron.TaskEventFinished}, types)
+}
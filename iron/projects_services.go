@@ -0,0 +1,58 @@
+package iron
+
+import (
+	"context"
+	"time"
+)
+
+// ProjectsServices implements API calls to get
+// details on the Iron project the client is configured for
+type ProjectsServices struct {
+	client    *Client
+	projectID string
+}
+
+// ProjectStats describes the quotas and current usage of an Iron project
+type ProjectStats struct {
+	ID              string     `json:"id"`
+	Name            string     `json:"name"`
+	UserID          string     `json:"user_id"`
+	Type            string     `json:"type,omitempty"`
+	CreatedAt       *time.Time `json:"created_at,omitempty"`
+	UpdatedAt       *time.Time `json:"updated_at,omitempty"`
+	TaskCount       int        `json:"task_count"`
+	HourlyTaskCount int        `json:"hourly_task_count"`
+	HourlyTimeLimit int        `json:"hourly_time_limit"`
+	TotalDuration   int64      `json:"total_duration"`
+	SchedulesCount  int        `json:"schedules_count"`
+	MaxSchedules    int        `json:"max_schedules"`
+	MaxConcurrency  int        `json:"max_concurrency"`
+}
+
+// Stats gets the quotas and current usage of the project
+func (p *ProjectsServices) Stats(ctx context.Context, options ...OptionFunc) (*ProjectStats, *Response, error) {
+	req, err := p.client.newRequest(
+		"GET",
+		p.client.Path("projects", p.projectID),
+		nil,
+		append([]OptionFunc{WithContext(ctx)}, options...))
+	if err != nil {
+		return nil, nil, err
+	}
+	var project struct {
+		Project ProjectStats `json:"project"`
+	}
+	resp, err := p.client.do(req, &project)
+	return &project.Project, resp, err
+}
+
+// MaxConcurrency returns the maximum number of tasks of the project which run in parallel.
+// The limit is managed by HSDP and cannot be changed through the API, use
+// CodesServices.SetCodeMaxConcurrency to limit the tasks of a single code instead
+func (p *ProjectsServices) MaxConcurrency(ctx context.Context, options ...OptionFunc) (int, *Response, error) {
+	stats, resp, err := p.Stats(ctx, options...)
+	if err != nil {
+		return 0, resp, err
+	}
+	return stats.MaxConcurrency, resp, nil
+}
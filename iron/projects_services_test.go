@@ -0,0 +1,72 @@
+package iron_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProjectsServices_Stats(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	muxIRON.HandleFunc(client.Path("projects", projectID), func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, "GET", r.Method) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "project": {
+    "id": "`+projectID+`",
+    "name": "hsdp-project",
+    "user_id": "FH959DA78Ygd6MejhhuQbNpq",
+    "type": "free",
+    "task_count": 1024,
+    "hourly_task_count": 12,
+    "hourly_time_limit": 3600,
+    "total_duration": 3600125,
+    "schedules_count": 3,
+    "max_schedules": 100,
+    "max_concurrency": 10
+  }
+}`)
+	})
+
+	stats, resp, err := client.Projects.Stats(context.Background())
+	if !assert.NotNil(t, resp) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	if !assert.Nil(t, err) {
+		return
+	}
+	if !assert.NotNil(t, stats) {
+		return
+	}
+	assert.Equal(t, projectID, stats.ID)
+	assert.Equal(t, 12, stats.HourlyTaskCount)
+	assert.Equal(t, 100, stats.MaxSchedules)
+	assert.Equal(t, 10, stats.MaxConcurrency)
+
+	maxConcurrency, _, err := client.Projects.MaxConcurrency(context.Background())
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, 10, maxConcurrency)
+}
+
+func TestProjectsServices_StatsCancelled(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := client.Projects.Stats(ctx)
+	assert.NotNil(t, err)
+}
@@ -1,6 +1,9 @@
 package iron
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 type SchedulesServices struct {
 	client    *Client
@@ -31,7 +34,7 @@ type pageOptions struct {
 }
 
 // CreateSchedules creates one or more schedules
-func (s *SchedulesServices) CreateSchedules(schedules []Schedule) (*[]Schedule, *Response, error) {
+func (s *SchedulesServices) CreateSchedules(schedules []Schedule, options ...OptionFunc) (*[]Schedule, *Response, error) {
 	var createSchedules struct {
 		Schedules []Schedule `json:"schedules"`
 	}
@@ -42,7 +45,7 @@ func (s *SchedulesServices) CreateSchedules(schedules []Schedule) (*[]Schedule,
 		"POST",
 		path,
 		&createSchedules,
-		nil)
+		options)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -54,8 +57,8 @@ func (s *SchedulesServices) CreateSchedules(schedules []Schedule) (*[]Schedule,
 }
 
 // CreateSchedule creates a schedule
-func (s *SchedulesServices) CreateSchedule(schedule Schedule) (*Schedule, *Response, error) {
-	schedules, resp, err := s.CreateSchedules([]Schedule{schedule})
+func (s *SchedulesServices) CreateSchedule(schedule Schedule, options ...OptionFunc) (*Schedule, *Response, error) {
+	schedules, resp, err := s.CreateSchedules([]Schedule{schedule}, options...)
 	if err != nil {
 		return nil, resp, err
 	}
@@ -65,8 +68,37 @@ func (s *SchedulesServices) CreateSchedule(schedule Schedule) (*Schedule, *Respo
 	return &(*schedules)[0], resp, err
 }
 
+// Tokens of payload templates, see CreateScheduleFromTemplate. Iron does not template
+// payloads so they are substituted client-side, once, when the schedule is created
+// and every run of the schedule receives the same payload. Values which change per
+// run, like the run timestamp, must be determined by the worker itself
+const (
+	PayloadTokenCreatedAt = "{{created_at}}"
+	PayloadTokenStartAt   = "{{start_at}}"
+	PayloadTokenCodeName  = "{{code_name}}"
+	PayloadTokenProjectID = "{{project_id}}"
+)
+
+// CreateScheduleFromTemplate creates schedule with its Payload set to template after
+// substituting the PayloadToken constants. Times are formatted as RFC3339 in UTC,
+// {{start_at}} is the creation time when schedule has no StartAt
+func (s *SchedulesServices) CreateScheduleFromTemplate(schedule Schedule, template string, options ...OptionFunc) (*Schedule, *Response, error) {
+	now := time.Now().UTC()
+	startAt := now
+	if schedule.StartAt != nil {
+		startAt = schedule.StartAt.UTC()
+	}
+	schedule.Payload = strings.NewReplacer(
+		PayloadTokenCreatedAt, now.Format(time.RFC3339),
+		PayloadTokenStartAt, startAt.Format(time.RFC3339),
+		PayloadTokenCodeName, schedule.CodeName,
+		PayloadTokenProjectID, s.projectID,
+	).Replace(template)
+	return s.CreateSchedule(schedule, options...)
+}
+
 // GetSchedules gets the schedules of the project
-func (s *SchedulesServices) GetSchedules() (*[]Schedule, *Response, error) {
+func (s *SchedulesServices) GetSchedules(options ...OptionFunc) (*[]Schedule, *Response, error) {
 	var schedules struct {
 		Schedules []Schedule `json:"schedules"`
 	}
@@ -81,7 +113,7 @@ func (s *SchedulesServices) GetSchedules() (*[]Schedule, *Response, error) {
 			PerPage: &perPage,
 			Page:    &page,
 		},
-		nil)
+		options)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -90,8 +122,8 @@ func (s *SchedulesServices) GetSchedules() (*[]Schedule, *Response, error) {
 }
 
 // GetSchedulesWithCode gets schedules which use code
-func (s *SchedulesServices) GetSchedulesWithCode(codeName string) (*[]Schedule, *Response, error) {
-	schedules, resp, err := s.GetSchedules()
+func (s *SchedulesServices) GetSchedulesWithCode(codeName string, options ...OptionFunc) (*[]Schedule, *Response, error) {
+	schedules, resp, err := s.GetSchedules(options...)
 	if err != nil {
 		return nil, resp, err
 	}
@@ -105,7 +137,7 @@ func (s *SchedulesServices) GetSchedulesWithCode(codeName string) (*[]Schedule,
 }
 
 // GetSchedule gets info on a schedule
-func (s *SchedulesServices) GetSchedule(scheduleID string) (*Schedule, *Response, error) {
+func (s *SchedulesServices) GetSchedule(scheduleID string, options ...OptionFunc) (*Schedule, *Response, error) {
 	path := s.client.Path("projects", s.projectID, "schedules", scheduleID)
 
 	page := 0
@@ -117,7 +149,7 @@ func (s *SchedulesServices) GetSchedule(scheduleID string) (*Schedule, *Response
 			PerPage: &perPage,
 			Page:    &page,
 		},
-		nil)
+		options)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -127,13 +159,13 @@ func (s *SchedulesServices) GetSchedule(scheduleID string) (*Schedule, *Response
 }
 
 // CancelSchedule cancels a schedule
-func (s *SchedulesServices) CancelSchedule(scheduleID string) (bool, *Response, error) {
+func (s *SchedulesServices) CancelSchedule(scheduleID string, options ...OptionFunc) (bool, *Response, error) {
 	path := s.client.Path("projects", s.projectID, "schedules", scheduleID, "cancel")
 	req, err := s.client.newRequest(
 		"POST",
 		path,
 		nil,
-		nil)
+		options)
 	if err != nil {
 		return false, nil, err
 	}
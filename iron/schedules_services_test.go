@@ -1,9 +1,11 @@
 package iron_test
 
 import (
+	"encoding/json"
 	"io"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/philips-software/go-hsdp-api/iron"
 
@@ -70,6 +72,38 @@ func TestSchedulesServices_CreateSchedule(t *testing.T) {
 	assert.Equal(t, scheduleID, schedule.ID)
 }
 
+func TestSchedulesServices_CreateScheduleFromTemplate(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	scheduleID := "bFp7OMpXdVsvRHp4sVtqb3gV"
+	var payload string
+	muxIRON.HandleFunc(client.Path("projects", projectID, "schedules"), func(w http.ResponseWriter, r *http.Request) {
+		var createSchedules struct {
+			Schedules []iron.Schedule `json:"schedules"`
+		}
+		if !assert.Nil(t, json.NewDecoder(r.Body).Decode(&createSchedules)) || !assert.Len(t, createSchedules.Schedules, 1) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		payload = createSchedules.Schedules[0].Payload
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"schedules":[{"id":"`+scheduleID+`"}]}`)
+	})
+
+	startAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	schedule, _, err := client.Schedules.CreateScheduleFromTemplate(iron.Schedule{
+		CodeName: "foo",
+		StartAt:  &startAt,
+	}, `{"code":"{{code_name}}","project":"{{project_id}}","start":"{{start_at}}","unknown":"{{run_at}}"}`)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, scheduleID, schedule.ID)
+	assert.Equal(t, `{"code":"foo","project":"`+projectID+`","start":"2024-03-01T12:00:00Z","unknown":"{{run_at}}"}`, payload)
+}
+
 func TestSchedulesServices_GetSchedule(t *testing.T) {
 	teardown := setup(t)
 	defer teardown()
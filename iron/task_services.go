@@ -1,9 +1,34 @@
 package iron
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
 	"time"
 )
 
+// Task statuses as reported by IronWorker
+const (
+	TaskStatusQueued    = "queued"
+	TaskStatusRunning   = "running"
+	TaskStatusComplete  = "complete"
+	TaskStatusError     = "error"
+	TaskStatusCancelled = "cancelled"
+	TaskStatusKilled    = "killed"
+	TaskStatusTimeout   = "timeout"
+)
+
+// Poll intervals of QueueAndWait. The interval doubles after every poll up to maxPollInterval
+const (
+	minPollInterval = time.Second
+	maxPollInterval = 30 * time.Second
+)
+
 type TasksServices struct {
 	client    *Client
 	projectID string
@@ -29,10 +54,149 @@ type Task struct {
 	Cluster       string     `json:"cluster,omitempty"`
 	Duration      int        `json:"duration,omitempty"`
 	LogSize       int        `json:"log_size,omitempty"`
+	Label         string     `json:"label,omitempty"`
+	Priority      *int       `json:"priority,omitempty"`
+	Delay         int        `json:"delay,omitempty"`
+}
+
+// Task priorities. Tasks with a higher priority are taken from the queue first
+const (
+	PriorityLow    = 0
+	PriorityMedium = 1
+	PriorityHigh   = 2
+)
+
+// TaskOption sets a queue parameter of a Task, see Task.With
+type TaskOption func(*Task) error
+
+// WithPriority sets the priority of the task, one of PriorityLow, PriorityMedium or PriorityHigh
+func WithPriority(priority int) TaskOption {
+	return func(t *Task) error {
+		if priority < PriorityLow || priority > PriorityHigh {
+			return fmt.Errorf("%w: [%d]", ErrInvalidPriority, priority)
+		}
+		t.Priority = &priority
+		return nil
+	}
+}
+
+// WithDelay delays the start of the task by delay, in whole seconds
+func WithDelay(delay time.Duration) TaskOption {
+	return func(t *Task) error {
+		if delay < 0 {
+			return fmt.Errorf("%w: [%s]", ErrInvalidDelay, delay)
+		}
+		t.Delay = int(delay / time.Second)
+		return nil
+	}
+}
+
+// WithTimeout sets the maximum run time of the task, in whole seconds
+func WithTimeout(timeout time.Duration) TaskOption {
+	return func(t *Task) error {
+		if timeout < time.Second {
+			return fmt.Errorf("%w: [%s]", ErrInvalidTimeout, timeout)
+		}
+		t.Timeout = int(timeout / time.Second)
+		return nil
+	}
+}
+
+// WithCodeRevision runs the task with revision rev of its code instead of the latest,
+// see CodesServices.GetCodeRevisions
+func WithCodeRevision(rev int) TaskOption {
+	return func(t *Task) error {
+		if rev < 1 {
+			return fmt.Errorf("%w: [%d]", ErrInvalidRevision, rev)
+		}
+		t.CodeRev = strconv.Itoa(rev)
+		return nil
+	}
+}
+
+// With returns a copy of the task with options applied, e.g.
+//
+//	task, err := iron.Task{CodeName: "etl"}.With(iron.WithPriority(iron.PriorityHigh))
+func (t Task) With(options ...TaskOption) (Task, error) {
+	for _, option := range options {
+		if err := option(&t); err != nil {
+			return t, err
+		}
+	}
+	return t, nil
+}
+
+// IsError reports whether the task failed. The Status tells the kind of failure:
+// TaskStatusError for a crash of the task, TaskStatusTimeout when it exceeded its
+// Timeout and TaskStatusKilled when it was killed. Cancelled tasks are not failures
+func (t Task) IsError() bool {
+	switch t.Status {
+	case TaskStatusError, TaskStatusTimeout, TaskStatusKilled:
+		return true
+	}
+	return false
+}
+
+// ErrorReason returns the reason IronWorker gave for the failure of the task
+// or an empty string if the task did not fail
+func (t Task) ErrorReason() string {
+	if !t.IsError() {
+		return ""
+	}
+	if t.Msg == "" {
+		return t.Status
+	}
+	return t.Msg
+}
+
+// IsFinished reports whether the task reached a final status and will not run anymore
+func (t Task) IsFinished() bool {
+	switch t.Status {
+	case TaskStatusComplete, TaskStatusCancelled:
+		return true
+	}
+	return t.IsError()
+}
+
+// minEncryptedPayloadSize is the size of the smallest payload EncryptPayload produces,
+// the session key encrypted with a 1024 bit RSA key followed by the GCM nonce and tag
+const minEncryptedPayloadSize = 128 + 12 + 16
+
+// PayloadEncrypted reports whether the payload looks like it was encrypted with
+// EncryptPayload, i.e. it is base64 of at least the size of an encrypted session key.
+// Use DecryptPayload with the private key of the cluster to read such a payload
+func (t Task) PayloadEncrypted() bool {
+	data, err := base64.StdEncoding.DecodeString(t.Payload)
+	return err == nil && len(data) >= minEncryptedPayloadSize
+}
+
+// DecodePayload unmarshals the JSON payload the task was queued with into v. An
+// encrypted payload can not be decoded and fails with ErrPayloadEncrypted
+func (t Task) DecodePayload(v interface{}) error {
+	if t.PayloadEncrypted() {
+		return ErrPayloadEncrypted
+	}
+	return json.Unmarshal([]byte(t.Payload), v)
+}
+
+// TaskListOptions filters the tasks returned by ListTasks
+type TaskListOptions struct {
+	Page      *int    `url:"page,omitempty"`
+	PerPage   *int    `url:"per_page,omitempty"`
+	CodeName  *string `url:"code_name,omitempty"`
+	Queued    *bool   `url:"queued,int,omitempty"`
+	Running   *bool   `url:"running,int,omitempty"`
+	Complete  *bool   `url:"complete,int,omitempty"`
+	Error     *bool   `url:"error,int,omitempty"`
+	Cancelled *bool   `url:"cancelled,int,omitempty"`
+	Killed    *bool   `url:"killed,int,omitempty"`
+	Timeout   *bool   `url:"timeout,int,omitempty"`
+	FromTime  *int64  `url:"from_time,omitempty"`
+	ToTime    *int64  `url:"to_time,omitempty"`
 }
 
 // GetTasks gets the tasks of the project
-func (t *TasksServices) GetTasks() (*[]Task, *Response, error) {
+func (t *TasksServices) GetTasks(options ...OptionFunc) (*[]Task, *Response, error) {
 	page := 0
 	perPage := 100
 	req, err := t.client.newRequest(
@@ -42,7 +206,24 @@ func (t *TasksServices) GetTasks() (*[]Task, *Response, error) {
 			PerPage: &perPage,
 			Page:    &page,
 		},
-		nil)
+		options)
+	if err != nil {
+		return nil, nil, err
+	}
+	var tasks struct {
+		Tasks []Task `json:"tasks"`
+	}
+	resp, err := t.client.do(req, &tasks)
+	return &tasks.Tasks, resp, err
+}
+
+// ListTasks gets a single page of tasks of the project matching opt
+func (t *TasksServices) ListTasks(opt *TaskListOptions, options ...OptionFunc) (*[]Task, *Response, error) {
+	req, err := t.client.newRequest(
+		"GET",
+		t.client.Path("projects", t.projectID, "tasks"),
+		opt,
+		options)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -54,12 +235,12 @@ func (t *TasksServices) GetTasks() (*[]Task, *Response, error) {
 }
 
 // GetTask gets info on a single task
-func (t *TasksServices) GetTask(taskID string) (*Task, *Response, error) {
+func (t *TasksServices) GetTask(taskID string, options ...OptionFunc) (*Task, *Response, error) {
 	req, err := t.client.newRequest(
 		"GET",
 		t.client.Path("projects", t.projectID, "tasks", taskID),
 		nil,
-		nil)
+		options)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -68,10 +249,32 @@ func (t *TasksServices) GetTask(taskID string) (*Task, *Response, error) {
 	return &task, resp, err
 }
 
+// GetTaskLog gets the log output of a task. The log is available once the task finished
+func (t *TasksServices) GetTaskLog(taskID string, options ...OptionFunc) (string, *Response, error) {
+	req, err := t.client.newRequest(
+		"GET",
+		t.client.Path("projects", t.projectID, "tasks", taskID, "log"),
+		nil,
+		options)
+	if err != nil {
+		return "", nil, err
+	}
+	req.Header.Set("Accept", "text/plain")
+	var log bytes.Buffer
+	resp, err := t.client.do(req, &log)
+	if err != nil {
+		return "", resp, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", resp, fmt.Errorf("%w: %d", ErrUnexpectedStatus, resp.StatusCode)
+	}
+	return log.String(), resp, nil
+}
+
 // QueueTask queues a single task for execution
-func (t *TasksServices) QueueTask(task Task) (*Task, *Response, error) {
+func (t *TasksServices) QueueTask(task Task, options ...OptionFunc) (*Task, *Response, error) {
 	taskList := []Task{task}
-	tasks, resp, err := t.QueueTasks(taskList)
+	tasks, resp, err := t.QueueTasks(taskList, options...)
 	if err != nil {
 		return nil, resp, err
 	}
@@ -81,8 +284,116 @@ func (t *TasksServices) QueueTask(task Task) (*Task, *Response, error) {
 	return &(*tasks)[0], resp, err
 }
 
+// QueueTaskOnce queues task unless a task of the same code with the same Label
+// already exists, in which case the existing task is returned. The Label acts as
+// a client supplied idempotency key so retrying after a network failure does not
+// create duplicate tasks. All tasks of the code are inspected so the cost grows
+// with the task history of the code.
+//
+// The check and the queueing are separate calls: producers racing with the same
+// Label between the check and the queueing can still create duplicates
+func (t *TasksServices) QueueTaskOnce(task Task, options ...OptionFunc) (*Task, *Response, error) {
+	if task.Label == "" {
+		return nil, nil, ErrMissingLabel
+	}
+	perPage := 100
+	for page := 0; ; page++ {
+		currentPage := page
+		tasks, resp, err := t.ListTasks(&TaskListOptions{
+			Page:     &currentPage,
+			PerPage:  &perPage,
+			CodeName: &task.CodeName,
+		}, options...)
+		if err != nil {
+			return nil, resp, err
+		}
+		for _, existing := range *tasks {
+			if existing.Label == task.Label {
+				found := existing
+				return &found, resp, nil
+			}
+		}
+		if len(*tasks) < perPage {
+			break
+		}
+	}
+	return t.QueueTask(task, options...)
+}
+
+// QueueTaskOnCluster queues task pinned to the cluster with clusterID. The cluster must
+// be one of the configured ClusterInfo entries or be accessible to the project,
+// otherwise ErrUnknownCluster is returned and the task is not queued
+func (t *TasksServices) QueueTaskOnCluster(task Task, clusterID string, options ...OptionFunc) (*Task, *Response, error) {
+	if !t.client.knownCluster(clusterID) {
+		cluster, resp, err := t.client.Clusters.GetCluster(clusterID, options...)
+		if err != nil {
+			return nil, resp, err
+		}
+		if cluster.ID != clusterID {
+			return nil, resp, fmt.Errorf("%w: [%s]", ErrUnknownCluster, clusterID)
+		}
+	}
+	task.Cluster = clusterID
+	return t.QueueTask(task, options...)
+}
+
+// QueueAndWait queues task and polls it until it is finished or ctx is done. The poll
+// interval starts at one second and doubles up to 30 seconds, a Retry-After header
+// of Iron takes precedence. Polls which are still rate limited after Config.MaxAttempts
+// are tried again at the next interval. The finished task is returned together with its
+// log. A failed task is not an error, check Task.IsError
+func (t *TasksServices) QueueAndWait(ctx context.Context, task Task, options ...OptionFunc) (*Task, string, *Response, error) {
+	options = append(append([]OptionFunc{}, options...), WithContext(ctx))
+	queued, resp, err := t.QueueTask(task, options...)
+	if err != nil {
+		return nil, "", resp, err
+	}
+	if queued == nil || queued.ID == "" {
+		return nil, "", resp, fmt.Errorf("%w: task was not queued", ErrUnexpectedStatus)
+	}
+	interval := minPollInterval
+	for {
+		wait := interval
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			wait = time.Duration(seconds) * time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return queued, "", resp, ctx.Err()
+		case <-time.After(wait):
+		}
+		if interval *= 2; interval > maxPollInterval {
+			interval = maxPollInterval
+		}
+		var current *Task
+		current, resp, err = t.GetTask(queued.ID, options...)
+		if resp != nil {
+			// The status goes first, the body of an error is no Task and fails to decode
+			switch resp.StatusCode {
+			case http.StatusOK:
+			case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+				continue // Still rate limited after Config.MaxAttempts, poll again later
+			default:
+				return queued, "", resp, fmt.Errorf("%w: %d", ErrUnexpectedStatus, resp.StatusCode)
+			}
+		}
+		if err != nil {
+			return queued, "", resp, err
+		}
+		queued = current
+		if queued.IsFinished() {
+			break
+		}
+	}
+	log, logResp, err := t.GetTaskLog(queued.ID, options...)
+	if err != nil && logResp != nil && logResp.StatusCode == http.StatusNotFound {
+		return queued, "", resp, nil // Tasks which never ran have no log
+	}
+	return queued, log, logResp, err
+}
+
 // QueueTasks queues one or more tasks for execution
-func (t *TasksServices) QueueTasks(tasks []Task) (*[]Task, *Response, error) {
+func (t *TasksServices) QueueTasks(tasks []Task, options ...OptionFunc) (*[]Task, *Response, error) {
 	var queueRequest struct {
 		Tasks []Task `json:"tasks"`
 	}
@@ -92,7 +403,7 @@ func (t *TasksServices) QueueTasks(tasks []Task) (*[]Task, *Response, error) {
 		"POST",
 		t.client.Path("projects", t.projectID, "tasks"),
 		&queueRequest,
-		nil)
+		options)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -103,13 +414,70 @@ func (t *TasksServices) QueueTasks(tasks []Task) (*[]Task, *Response, error) {
 	return &queueResponse.Tasks, resp, err
 }
 
+// maxTasksPerRequest is the number of tasks QueueBatch queues per request
+const maxTasksPerRequest = 100
+
+// QueueResult is the outcome of queueing a single task of QueueBatch
+type QueueResult struct {
+	// Index is the position of the task in the submitted tasks
+	Index int
+	// ID is the id Iron assigned to the task, empty when Err is set
+	ID  string
+	Err error
+}
+
+// QueueBatch queues tasks using as few requests as possible, up to 100 tasks each.
+// Tasks without a CodeName are not sent. A failed request fails all the tasks it
+// contained without stopping the remaining requests. The results are in the order of
+// tasks and are always returned, together with the joined per-task errors
+func (t *TasksServices) QueueBatch(ctx context.Context, tasks []Task, options ...OptionFunc) ([]QueueResult, error) {
+	options = append(append([]OptionFunc{}, options...), WithContext(ctx))
+	results := make([]QueueResult, len(tasks))
+	var errs []error
+	var chunk []Task
+	var indexes []int
+	flush := func() {
+		if len(chunk) == 0 {
+			return
+		}
+		queued, _, err := t.QueueTasks(chunk, options...)
+		if err == nil && len(*queued) != len(chunk) {
+			err = fmt.Errorf("%w: %d of %d tasks queued", ErrUnexpectedStatus, len(*queued), len(chunk))
+		}
+		for i, index := range indexes {
+			if err != nil {
+				results[index].Err = err
+				errs = append(errs, fmt.Errorf("queue task %d: %w", index, err))
+				continue
+			}
+			results[index].ID = (*queued)[i].ID
+		}
+		chunk, indexes = nil, nil
+	}
+	for i, task := range tasks {
+		results[i].Index = i
+		if task.CodeName == "" {
+			results[i].Err = ErrMissingCodeName
+			errs = append(errs, fmt.Errorf("queue task %d: %w", i, ErrMissingCodeName))
+			continue
+		}
+		chunk = append(chunk, task)
+		indexes = append(indexes, i)
+		if len(chunk) == maxTasksPerRequest {
+			flush()
+		}
+	}
+	flush()
+	return results, errors.Join(errs...)
+}
+
 // CancelTask cancels the given task
-func (t *TasksServices) CancelTask(taskID string) (bool, *Response, error) {
+func (t *TasksServices) CancelTask(taskID string, options ...OptionFunc) (bool, *Response, error) {
 	req, err := t.client.newRequest(
 		"POST",
 		t.client.Path("projects", t.projectID, "tasks", taskID, "cancel"),
 		nil,
-		nil)
+		options)
 	if err != nil {
 		return false, nil, err
 	}
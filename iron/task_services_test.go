@@ -1,9 +1,15 @@
 package iron_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/philips-software/go-hsdp-api/iron"
 
@@ -125,6 +131,22 @@ func TestTasksServices_GetTask(t *testing.T) {
 		return
 	}
 	assert.Equal(t, taskID, task.ID)
+	assert.False(t, task.IsError())
+	assert.Equal(t, "", task.ErrorReason())
+}
+
+func TestTask_ErrorReason(t *testing.T) {
+	timedOut := iron.Task{Status: iron.TaskStatusTimeout, Msg: "Job timed out."}
+	assert.True(t, timedOut.IsError())
+	assert.Equal(t, "Job timed out.", timedOut.ErrorReason())
+
+	crashed := iron.Task{Status: iron.TaskStatusError}
+	assert.True(t, crashed.IsError())
+	assert.Equal(t, iron.TaskStatusError, crashed.ErrorReason())
+
+	completed := iron.Task{Status: iron.TaskStatusComplete, Msg: "Done"}
+	assert.False(t, completed.IsError())
+	assert.Equal(t, "", completed.ErrorReason())
 }
 
 func TestTasksServices_QueueTask(t *testing.T) {
@@ -216,3 +238,344 @@ func TestTasksServices_CancelTask(t *testing.T) {
 		return
 	}
 }
+
+func TestTasksServices_QueueTaskOnce(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	queued := 0
+	muxIRON.HandleFunc(client.Path("projects", projectID, "tasks"), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case "GET":
+			assert.Equal(t, "foo", r.URL.Query().Get("code_name"))
+			w.WriteHeader(http.StatusOK)
+			_, _ = io.WriteString(w, `{"tasks":[{"id":"ozAmEFk7mqs0UQXasmGQv2Js","code_name":"foo","label":"existing-key","status":"running"}]}`)
+		case "POST":
+			queued++
+			w.WriteHeader(http.StatusOK)
+			_, _ = io.WriteString(w, `{"tasks":[{"id":"bFp7OMpXdVsvRHp4sVtqb3gV"}],"msg":"Queued up"}`)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	task, _, err := client.Tasks.QueueTaskOnce(iron.Task{CodeName: "foo", Label: "existing-key"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "ozAmEFk7mqs0UQXasmGQv2Js", task.ID)
+	assert.Equal(t, 0, queued)
+
+	task, _, err = client.Tasks.QueueTaskOnce(iron.Task{CodeName: "foo", Label: "new-key"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "bFp7OMpXdVsvRHp4sVtqb3gV", task.ID)
+	assert.Equal(t, 1, queued)
+
+	_, _, err = client.Tasks.QueueTaskOnce(iron.Task{CodeName: "foo"})
+	assert.Equal(t, iron.ErrMissingLabel, err)
+}
+
+func TestTasksServices_QueueTaskOnCluster(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	clusterID := "9PbpheKmd0bSHIelR7O6ChcH"
+	var queued []string
+	muxIRON.HandleFunc(client.Path("clusters", clusterID), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"cluster":{"id":"`+clusterID+`","name":"eu-west"}}`)
+	})
+	muxIRON.HandleFunc(client.Path("clusters", "unknown"), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = io.WriteString(w, `{"msg":"Cluster not found"}`)
+	})
+	muxIRON.HandleFunc(client.Path("projects", projectID, "tasks"), func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, "POST", r.Method) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var body struct {
+			Tasks []iron.Task `json:"tasks"`
+		}
+		if !assert.Nil(t, json.NewDecoder(r.Body).Decode(&body)) || !assert.Len(t, body.Tasks, 1) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		queued = append(queued, body.Tasks[0].Cluster)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"tasks":[{"id":"bFp7OMpXdVsvRHp4sVtqb3gV","cluster":"`+body.Tasks[0].Cluster+`"}],"msg":"Queued up"}`)
+	})
+
+	task, _, err := client.Tasks.QueueTaskOnCluster(iron.Task{CodeName: "foo"}, clusterID)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, clusterID, task.Cluster)
+
+	_, _, err = client.Tasks.QueueTaskOnCluster(iron.Task{CodeName: "foo"}, "unknown")
+	assert.True(t, errors.Is(err, iron.ErrUnknownCluster))
+	assert.Equal(t, []string{clusterID}, queued)
+}
+
+func TestTask_With(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	muxIRON.HandleFunc(client.Path("projects", projectID, "tasks"), func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, "POST", r.Method) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var queueRequest struct {
+			Tasks []map[string]interface{} `json:"tasks"`
+		}
+		if !assert.Nil(t, json.NewDecoder(r.Body).Decode(&queueRequest)) || !assert.Len(t, queueRequest.Tasks, 1) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		assert.Equal(t, float64(iron.PriorityLow), queueRequest.Tasks[0]["priority"])
+		assert.Equal(t, float64(90), queueRequest.Tasks[0]["delay"])
+		assert.Equal(t, float64(600), queueRequest.Tasks[0]["timeout"])
+		assert.Equal(t, "3", queueRequest.Tasks[0]["code_rev"])
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"tasks":[{"id":"bFp7OMpXdVsvRHp4sVtqb3gV"}],"msg":"Queued up"}`)
+	})
+
+	task, err := iron.Task{CodeName: "loafoe/siderite"}.With(
+		iron.WithPriority(iron.PriorityLow),
+		iron.WithDelay(90*time.Second),
+		iron.WithTimeout(10*time.Minute),
+		iron.WithCodeRevision(3))
+	if !assert.Nil(t, err) {
+		return
+	}
+	tasks, _, err := client.Tasks.QueueTasks([]iron.Task{task})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Len(t, *tasks, 1)
+
+	_, err = iron.Task{}.With(iron.WithPriority(3))
+	assert.True(t, errors.Is(err, iron.ErrInvalidPriority))
+	_, err = iron.Task{}.With(iron.WithPriority(-1))
+	assert.True(t, errors.Is(err, iron.ErrInvalidPriority))
+	_, err = iron.Task{}.With(iron.WithDelay(-time.Second))
+	assert.True(t, errors.Is(err, iron.ErrInvalidDelay))
+	_, err = iron.Task{}.With(iron.WithTimeout(500 * time.Millisecond))
+	assert.True(t, errors.Is(err, iron.ErrInvalidTimeout))
+	_, err = iron.Task{}.With(iron.WithCodeRevision(0))
+	assert.True(t, errors.Is(err, iron.ErrInvalidRevision))
+}
+
+func TestTasksServices_QueueAndWait(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	taskID := "bFp7OMpXdVsvRHp4sVtqb3gV"
+	polls := 0
+	muxIRON.HandleFunc(client.Path("projects", projectID, "tasks"), func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, "POST", r.Method) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"tasks":[{"id":"`+taskID+`"}],"msg":"Queued up"}`)
+	})
+	muxIRON.HandleFunc(client.Path("projects", projectID, "tasks", taskID), func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "0")
+		switch polls {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = io.WriteString(w, `{"msg":"Service Unavailable"}`)
+		case 2:
+			w.WriteHeader(http.StatusOK)
+			_, _ = io.WriteString(w, `{"id":"`+taskID+`","status":"running"}`)
+		default:
+			w.WriteHeader(http.StatusOK)
+			_, _ = io.WriteString(w, `{"id":"`+taskID+`","status":"complete","duration":1234}`)
+		}
+	})
+	muxIRON.HandleFunc(client.Path("projects", projectID, "tasks", taskID, "log"), func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "text/plain", r.Header.Get("Accept"))
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, "hello from siderite\n")
+	})
+
+	task, log, resp, err := client.Tasks.QueueAndWait(context.Background(), iron.Task{
+		CodeName: "loafoe/siderite",
+		Payload:  `{"foo": "bar"}`,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 3, polls)
+	assert.Equal(t, iron.TaskStatusComplete, task.Status)
+	assert.True(t, task.IsFinished())
+	assert.Equal(t, "hello from siderite\n", log)
+}
+
+func TestTasksServices_QueueAndWaitRateLimited(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	limited, err := iron.NewClient(&iron.Config{
+		BaseURL:     serverIRON.URL,
+		ProjectID:   projectID,
+		Token:       token,
+		MaxAttempts: 1,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer limited.Close()
+
+	taskID := "bFp7OMpXdVsvRHp4sVtqb3gV"
+	polls := 0
+	muxIRON.HandleFunc(client.Path("projects", projectID, "tasks"), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"tasks":[{"id":"`+taskID+`"}],"msg":"Queued up"}`)
+	})
+	muxIRON.HandleFunc(client.Path("projects", projectID, "tasks", taskID), func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		w.Header().Set("Retry-After", "0")
+		if polls == 1 {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = io.WriteString(w, "Too Many Requests")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"id":"`+taskID+`","status":"complete"}`)
+	})
+	muxIRON.HandleFunc(client.Path("projects", projectID, "tasks", taskID, "log"), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, "done\n")
+	})
+
+	options := make([]iron.OptionFunc, 0, 1)
+	task, log, _, err := limited.Tasks.QueueAndWait(context.Background(), iron.Task{CodeName: "loafoe/siderite"}, options...)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, 2, polls)
+	assert.Equal(t, iron.TaskStatusComplete, task.Status)
+	assert.Equal(t, "done\n", log)
+	assert.Nil(t, options[:1][0], "the options of the caller are not written to")
+}
+
+func TestTasksServices_QueueAndWaitCancel(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	taskID := "bFp7OMpXdVsvRHp4sVtqb3gV"
+	muxIRON.HandleFunc(client.Path("projects", projectID, "tasks"), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"tasks":[{"id":"`+taskID+`"}],"msg":"Queued up"}`)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	task, _, _, err := client.Tasks.QueueAndWait(ctx, iron.Task{CodeName: "loafoe/siderite"})
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	if assert.NotNil(t, task) {
+		assert.Equal(t, taskID, task.ID)
+	}
+}
+
+func TestTasksServices_QueueBatch(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	requests := 0
+	muxIRON.HandleFunc(client.Path("projects", projectID, "tasks"), func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, "POST", r.Method) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		requests++
+		var queueRequest struct {
+			Tasks []iron.Task `json:"tasks"`
+		}
+		if !assert.Nil(t, json.NewDecoder(r.Body).Decode(&queueRequest)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if requests > 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = io.WriteString(w, `{"msg":"Bad request"}`)
+			return
+		}
+		assert.Len(t, queueRequest.Tasks, 100)
+		ids := make([]string, len(queueRequest.Tasks))
+		for i, task := range queueRequest.Tasks {
+			ids[i] = `{"id":"task-` + task.Payload + `"}`
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"tasks":[`+strings.Join(ids, ",")+`],"msg":"Queued up"}`)
+	})
+
+	tasks := make([]iron.Task, 150)
+	for i := range tasks {
+		tasks[i] = iron.Task{CodeName: "loafoe/siderite", Payload: strconv.Itoa(i)}
+	}
+	tasks[10].CodeName = ""
+
+	results, err := client.Tasks.QueueBatch(context.Background(), tasks)
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, requests)
+	if !assert.Len(t, results, 150) {
+		return
+	}
+	assert.Equal(t, "task-0", results[0].ID)
+	assert.True(t, errors.Is(results[10].Err, iron.ErrMissingCodeName))
+	assert.Equal(t, "task-100", results[100].ID)
+	assert.Nil(t, results[100].Err)
+	assert.Equal(t, 101, results[101].Index)
+	assert.True(t, errors.Is(results[101].Err, iron.ErrUnexpectedStatus))
+	assert.Empty(t, results[149].ID)
+}
+
+func TestTask_DecodePayload(t *testing.T) {
+	task := iron.Task{Payload: `{"foo": "bar"}`}
+	assert.False(t, task.PayloadEncrypted())
+	var payload struct {
+		Foo string `json:"foo"`
+	}
+	if !assert.Nil(t, task.DecodePayload(&payload)) {
+		return
+	}
+	assert.Equal(t, "bar", payload.Foo)
+
+	pubkey := []byte(`-----BEGIN PUBLIC KEY-----
+MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQCdS2oE9+dhexZc3/sEtI+a6ZKt
+6FwBZaAgytdkQ7sX4FwbZAdJ7zFS1m0gDezyFTBJSPVjYOKYr0fu1ao/xkNkKnnz
+J2WkW6qsDNKwJgrHiCO1asnoW5XWtk8Yc4kKkg63REuV20x+QoD6onTCo3T2DfUI
+vZ8QOSJQ7NotGuO2wwIDAQAB
+-----END PUBLIC KEY-----`)
+	encrypted, err := iron.EncryptPayload(pubkey, []byte(`{"foo": "bar"}`))
+	if !assert.Nil(t, err) {
+		return
+	}
+	task = iron.Task{Payload: encrypted}
+	assert.True(t, task.PayloadEncrypted())
+	assert.True(t, errors.Is(task.DecodePayload(&payload), iron.ErrPayloadEncrypted))
+}
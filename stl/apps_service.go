@@ -2,7 +2,11 @@ package stl
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
+
 	"github.com/hasura/go-graphql-client"
 )
 
@@ -15,6 +19,12 @@ type AppResource struct {
 	DeviceID int64  `json:"deviceId"`
 	Name     string `json:"name"`
 	Content  string `json:"content"`
+	// IsLocked is set for resources which are locked against changes from the device
+	IsLocked bool `json:"isLocked"`
+	// RequestID and StatusCode are set by mutations and can be used
+	// to correlate the call with server-side logs
+	RequestID  string `json:"-" graphql:"-"`
+	StatusCode int    `json:"-" graphql:"-"`
 }
 
 type CreateApplicationResourceInput struct {
@@ -42,11 +52,24 @@ type DeleteApplicationResourceInput struct {
 	GroupID      string `json:"groupId"`
 }
 
+// checkContentSize returns an error wrapping ErrContentTooLarge when content exceeds Config.MaxContentSize
+func (a *AppsService) checkContentSize(content string) error {
+	limit := a.client.config.MaxContentSize
+	if limit == 0 {
+		limit = DefaultMaxContentSize
+	}
+	if limit > 0 && len(content) > limit {
+		return fmt.Errorf("%w: %d bytes exceeds the limit of %d bytes", ErrContentTooLarge, len(content), limit)
+	}
+	return nil
+}
+
+// GetAppResourceByID gets an application resource by its numeric ID, e.g. as returned by CreateAppResource
 func (a *AppsService) GetAppResourceByID(ctx context.Context, id int64) (*AppResource, error) {
 	var query struct {
 		App AppResource `graphql:"applicationResource(id: $id)"`
 	}
-	err := a.client.gql.Query(ctx, &query, map[string]interface{}{
+	err := a.client.query(ctx, &query, map[string]interface{}{
 		"id": graphql.Int(id),
 	})
 	if err != nil {
@@ -55,11 +78,13 @@ func (a *AppsService) GetAppResourceByID(ctx context.Context, id int64) (*AppRes
 	return &query.App, nil
 }
 
+// GetAppResourceByDeviceIDAndName gets the application resource called name of a device.
+// Use GetAppResourceByID when only the resource ID is known
 func (a *AppsService) GetAppResourceByDeviceIDAndName(ctx context.Context, deviceID int64, name string) (*AppResource, error) {
 	var query struct {
 		App AppResource `graphql:"applicationResource(id: $id, name: $name)"`
 	}
-	err := a.client.gql.Query(ctx, &query, map[string]interface{}{
+	err := a.client.query(ctx, &query, map[string]interface{}{
 		"id":   graphql.Int(deviceID),
 		"name": graphql.String(name),
 	})
@@ -69,6 +94,10 @@ func (a *AppsService) GetAppResourceByDeviceIDAndName(ctx context.Context, devic
 	return &query.App, nil
 }
 
+// GetAppResourcesBySerial returns the application resources of the device with serial. The
+// applicationResources query of STL has no modification time filter and AppResource no
+// updatedAt field, so incremental reconciliation has to compare the returned resources,
+// e.g. with PlanAppResourceSync
 func (a *AppsService) GetAppResourcesBySerial(ctx context.Context, serial string) (*[]AppResource, error) {
 	var query struct {
 		Resources struct {
@@ -77,7 +106,7 @@ func (a *AppsService) GetAppResourcesBySerial(ctx context.Context, serial string
 			}
 		} `graphql:"applicationResources(serialNumber: $serial, first: 10000)"`
 	}
-	err := a.client.gql.Query(ctx, &query, map[string]interface{}{
+	err := a.client.query(ctx, &query, map[string]interface{}{
 		"serial": graphql.String(serial),
 	})
 	if err != nil {
@@ -90,7 +119,69 @@ func (a *AppsService) GetAppResourcesBySerial(ctx context.Context, serial string
 	return &appResources, nil
 }
 
+// appResourcesConcurrency is the number of queries GetAppResourcesBySerials runs in parallel
+const appResourcesConcurrency = 8
+
+// GetAppResourcesBySerials returns the application resources of every device in serials,
+// keyed by serial. STL has no query for multiple serials so the devices are queried in
+// parallel, appResourcesConcurrency at a time. Failed devices are left out of the map,
+// which is always returned, and their errors are joined
+func (a *AppsService) GetAppResourcesBySerials(ctx context.Context, serials []string) (map[string][]AppResource, error) {
+	resources := make(map[string][]AppResource, len(serials))
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs []error
+	)
+	seen := make(map[string]bool, len(serials))
+	sem := make(chan struct{}, appResourcesConcurrency)
+	for _, serial := range serials {
+		if seen[serial] {
+			continue
+		}
+		seen[serial] = true
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(serial string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			deviceResources, err := a.GetAppResourcesBySerial(ctx, serial)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("get app resources of %s: %w", serial, err))
+				return
+			}
+			resources[serial] = *deviceResources
+		}(serial)
+	}
+	wg.Wait()
+	return resources, errors.Join(errs...)
+}
+
+// GetAppResourcesBySerialWithPrefix returns the application resources of the device
+// whose name starts with prefix. The applicationResources query of STL offers no name
+// filter, so all resources are fetched and filtered client-side
+func (a *AppsService) GetAppResourcesBySerialWithPrefix(ctx context.Context, serial, prefix string) (*[]AppResource, error) {
+	resources, err := a.GetAppResourcesBySerial(ctx, serial)
+	if err != nil {
+		return nil, err
+	}
+	appResources := make([]AppResource, 0)
+	for _, r := range *resources {
+		if strings.HasPrefix(r.Name, prefix) {
+			appResources = append(appResources, r)
+		}
+	}
+	return &appResources, nil
+}
+
 func (a *AppsService) CreateAppResource(ctx context.Context, input CreateApplicationResourceInput) (*AppResource, error) {
+	if err := a.checkContentSize(input.Content); err != nil {
+		return nil, err
+	}
 	var mutation struct {
 		CreateApplicationResource struct {
 			Success             bool
@@ -100,19 +191,30 @@ func (a *AppsService) CreateAppResource(ctx context.Context, input CreateApplica
 			ApplicationResource AppResource
 		} `graphql:"createApplicationResource(input: $input)"`
 	}
-	err := a.client.gql.Mutate(ctx, &mutation, map[string]interface{}{
+	err := a.client.mutate(ctx, &mutation, map[string]interface{}{
 		"input": input,
 	})
 	if err != nil {
 		return nil, err
 	}
 	if !mutation.CreateApplicationResource.Success {
-		return nil, fmt.Errorf("%d: %s", mutation.CreateApplicationResource.StatusCode, mutation.CreateApplicationResource.Message)
+		return nil, statusError(mutation.CreateApplicationResource.StatusCode, mutation.CreateApplicationResource.Message)
 	}
-	return &mutation.CreateApplicationResource.ApplicationResource, nil
+	resource := mutation.CreateApplicationResource.ApplicationResource
+	resource.RequestID = mutation.CreateApplicationResource.RequestID
+	resource.StatusCode = mutation.CreateApplicationResource.StatusCode
+	return &resource, nil
 }
 
+// UpdateAppResource updates an application resource. Only one of DeviceID and
+// SerialNumber of input is required, the other one is looked up
 func (a *AppsService) UpdateAppResource(ctx context.Context, input UpdateApplicationResourceInput) (*AppResource, error) {
+	if err := a.checkContentSize(input.Content); err != nil {
+		return nil, err
+	}
+	if err := a.client.Devices.resolve(ctx, &input.DeviceID, &input.SerialNumber); err != nil {
+		return nil, err
+	}
 	var mutation struct {
 		UpdateApplicationResource struct {
 			Success             bool
@@ -122,19 +224,47 @@ func (a *AppsService) UpdateAppResource(ctx context.Context, input UpdateApplica
 			ApplicationResource AppResource
 		} `graphql:"updateApplicationResource(input: $input)"`
 	}
-	err := a.client.gql.Mutate(ctx, &mutation, map[string]interface{}{
+	err := a.client.mutate(ctx, &mutation, map[string]interface{}{
 		"input": input,
 	})
 	if err != nil {
 		return nil, err
 	}
 	if !mutation.UpdateApplicationResource.Success {
-		return nil, fmt.Errorf("%d: %s", mutation.UpdateApplicationResource.StatusCode, mutation.UpdateApplicationResource.Message)
+		return nil, statusError(mutation.UpdateApplicationResource.StatusCode, mutation.UpdateApplicationResource.Message)
 	}
-	return &mutation.UpdateApplicationResource.ApplicationResource, nil
+	resource := mutation.UpdateApplicationResource.ApplicationResource
+	resource.RequestID = mutation.UpdateApplicationResource.RequestID
+	resource.StatusCode = mutation.UpdateApplicationResource.StatusCode
+	return &resource, nil
 }
 
+// SetAppResourceLock locks or unlocks the application resource with the given ID and returns
+// the updated resource. STL has no separate lock mutation, so the resource is read first and
+// updated with its current name and content to leave everything but the lock unchanged
+func (a *AppsService) SetAppResourceLock(ctx context.Context, id int64, locked bool) (*AppResource, error) {
+	resource, err := a.GetAppResourceByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if resource.ID == 0 {
+		return nil, fmt.Errorf("%w: id=%d", ErrAppResourceNotFound, id)
+	}
+	return a.UpdateAppResource(ctx, UpdateApplicationResourceInput{
+		ID:       resource.ID,
+		DeviceID: resource.DeviceID,
+		Name:     resource.Name,
+		Content:  resource.Content,
+		IsLocked: locked,
+	})
+}
+
+// DeleteAppResource deletes an application resource. Only one of DeviceID and
+// SerialNumber of input is required, the other one is looked up
 func (a *AppsService) DeleteAppResource(ctx context.Context, input DeleteApplicationResourceInput) (bool, error) {
+	if err := a.client.Devices.resolve(ctx, &input.DeviceID, &input.SerialNumber); err != nil {
+		return false, err
+	}
 	var mutation struct {
 		DeleteApplicationResource struct {
 			Success    bool
@@ -143,14 +273,120 @@ func (a *AppsService) DeleteAppResource(ctx context.Context, input DeleteApplica
 			RequestID  string
 		} `graphql:"deleteApplicationResource(input: $input)"`
 	}
-	err := a.client.gql.Mutate(ctx, &mutation, map[string]interface{}{
+	err := a.client.mutate(ctx, &mutation, map[string]interface{}{
 		"input": input,
 	})
 	if err != nil {
 		return false, err
 	}
 	if !mutation.DeleteApplicationResource.Success {
-		return false, fmt.Errorf("%d: %s", mutation.DeleteApplicationResource.StatusCode, mutation.DeleteApplicationResource.Message)
+		return false, statusError(mutation.DeleteApplicationResource.StatusCode, mutation.DeleteApplicationResource.Message)
 	}
 	return true, nil
 }
+
+// DeleteAllAppResources deletes all application resources of a device. A failure to
+// delete a resource does not stop the deletion of the remaining resources. The number of
+// deleted resources is always returned, together with the joined per-resource errors
+func (a *AppsService) DeleteAllAppResources(ctx context.Context, deviceID int64, serial string) (int, error) {
+	resources, err := a.GetAppResourcesBySerial(ctx, serial)
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	var errs []error
+	for _, resource := range *resources {
+		_, err := a.DeleteAppResource(ctx, DeleteApplicationResourceInput{
+			ID:           resource.ID,
+			Name:         resource.Name,
+			SerialNumber: serial,
+			DeviceID:     deviceID,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("delete app resource %d (%s): %w", resource.ID, resource.Name, err))
+			continue
+		}
+		deleted++
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// AppResourceSyncPlan holds the mutations which bring the application resources of a device
+// in line with a desired set, see PlanAppResourceSync. Unchanged lists the names of the
+// resources which already match
+type AppResourceSyncPlan struct {
+	Create    []CreateApplicationResourceInput
+	Update    []UpdateApplicationResourceInput
+	Delete    []DeleteApplicationResourceInput
+	Unchanged []string
+}
+
+// PlanAppResourceSync compares the application resources of the device with serial to desired,
+// matched by Name, and returns the resources to create, update and delete without changing
+// anything. Use it to preview a sync before deleting resources, which can leave a device
+// unusable. The inputs of the plan can be passed to CreateAppResource, UpdateAppResource and
+// DeleteAppResource as they are
+func (a *AppsService) PlanAppResourceSync(ctx context.Context, serial string, desired []CreateApplicationResourceInput) (*AppResourceSyncPlan, error) {
+	current, err := a.GetAppResourcesBySerial(ctx, serial)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]AppResource, len(*current))
+	for _, resource := range *current {
+		existing[resource.Name] = resource
+	}
+	plan := &AppResourceSyncPlan{}
+	wanted := make(map[string]bool, len(desired))
+	for _, input := range desired {
+		if wanted[input.Name] {
+			return nil, fmt.Errorf("%w: duplicate app resource name [%s]", ErrInvalidSyncInput, input.Name)
+		}
+		wanted[input.Name] = true
+		input.SerialNumber = serial
+		resource, ok := existing[input.Name]
+		switch {
+		case !ok:
+			plan.Create = append(plan.Create, input)
+		case resource.Content != input.Content || resource.IsLocked != input.IsLocked:
+			plan.Update = append(plan.Update, UpdateApplicationResourceInput{
+				ID:           resource.ID,
+				DeviceID:     resource.DeviceID,
+				SerialNumber: serial,
+				Name:         input.Name,
+				Content:      input.Content,
+				IsLocked:     input.IsLocked,
+			})
+		default:
+			plan.Unchanged = append(plan.Unchanged, input.Name)
+		}
+	}
+	for _, resource := range *current {
+		if !wanted[resource.Name] {
+			plan.Delete = append(plan.Delete, DeleteApplicationResourceInput{
+				ID:           resource.ID,
+				Name:         resource.Name,
+				SerialNumber: serial,
+				DeviceID:     resource.DeviceID,
+			})
+		}
+	}
+	return plan, nil
+}
+
+// CreateAppResources creates the application resources of inputs. A failure to create
+// a resource does not stop the creation of the remaining resources. The successfully
+// created resources, including their ID, are always returned together with the joined
+// per-resource errors so a partial provisioning can be rolled back using DeleteAppResource
+func (a *AppsService) CreateAppResources(ctx context.Context, inputs []CreateApplicationResourceInput) ([]AppResource, error) {
+	created := make([]AppResource, 0, len(inputs))
+	var errs []error
+	for _, input := range inputs {
+		resource, err := a.CreateAppResource(ctx, input)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("create app resource (%s): %w", input.Name, err))
+			continue
+		}
+		created = append(created, *resource)
+	}
+	return created, errors.Join(errs...)
+}
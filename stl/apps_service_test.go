@@ -2,10 +2,14 @@ package stl_test
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"github.com/philips-software/go-hsdp-api/stl"
 	"github.com/stretchr/testify/assert"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -27,6 +31,7 @@ func TestGetAppResourceByID(t *testing.T) {
       "id": 1,
       "deviceId": 53615,
       "name": "terraform.yml",
+      "isLocked": true,
       "content": "YXBpVmVyc2lvbjogdjEKa2luZDogU2VjcmV0Cm1ldGFkYXRhOgogIG5hbWU6IHNlY3JldC1zYS1zYW1wbGUKICBhbm5vdGF0aW9uczoKICAgIGt1YmVybmV0ZXMuaW8vc2VydmljZS1hY2NvdW50Lm5hbWU6ICJzYS1uYW1lIgp0eXBlOiBrdWJlcm5ldGVzLmlvL3NlcnZpY2UtYWNjb3VudC10b2tlbgpkYXRhOgogICMgWW91IGNhbiBpbmNsdWRlIGFkZGl0aW9uYWwga2V5IHZhbHVlIHBhaXJzIGFzIHlvdSBkbyB3aXRoIE9wYXF1ZSBTZWNyZXRzCiAgZXh0cmE6IFltRnlDZz09Cg=="
     }
   }
@@ -45,6 +50,7 @@ func TestGetAppResourceByID(t *testing.T) {
 	}
 	assert.Equal(t, int64(1), app.ID)
 	assert.Equal(t, "terraform.yml", app.Name)
+	assert.True(t, app.IsLocked)
 }
 
 func TestGetAppResourceByDeviceIDAndName(t *testing.T) {
@@ -147,6 +153,15 @@ func TestGetAppResourcesBySerial(t *testing.T) {
 	assert.Equal(t, "ingress.yml", (*resources)[0].Name)
 	assert.Equal(t, "service.yml", (*resources)[1].Name)
 	assert.Equal(t, "deployment.yml", (*resources)[2].Name)
+
+	resources, err = client.Apps.GetAppResourcesBySerialWithPrefix(ctx, "serial", "s")
+	if !assert.Nil(t, err) {
+		return
+	}
+	if !assert.Equal(t, 1, len(*resources)) {
+		return
+	}
+	assert.Equal(t, "service.yml", (*resources)[0].Name)
 }
 
 func TestCreateAppResource(t *testing.T) {
@@ -195,6 +210,8 @@ func TestCreateAppResource(t *testing.T) {
 		return
 	}
 	assert.Equal(t, "terraform.yml", app.Name)
+	assert.Equal(t, "k3s-f4f57692-1674-417c-b1f7-01437091523f", app.RequestID)
+	assert.Equal(t, 202, app.StatusCode)
 }
 
 func TestUpdateAppResource(t *testing.T) {
@@ -233,6 +250,7 @@ func TestUpdateAppResource(t *testing.T) {
 	ctx := context.Background()
 	app, err := client.Apps.UpdateAppResource(ctx, stl.UpdateApplicationResourceInput{
 		SerialNumber: serial,
+		DeviceID:     53615,
 		Name:         "terraform.yml",
 		Content:      "NOTTHEREALTHING",
 	})
@@ -243,6 +261,7 @@ func TestUpdateAppResource(t *testing.T) {
 		return
 	}
 	assert.Equal(t, "terraform.yml", app.Name)
+	assert.Equal(t, "k3s-8681d245-5490-44aa-964b-4e72e34c828c", app.RequestID)
 }
 
 func TestDeleteAppResource(t *testing.T) {
@@ -275,12 +294,153 @@ func TestDeleteAppResource(t *testing.T) {
 	ctx := context.Background()
 	ok, err := client.Apps.DeleteAppResource(ctx, stl.DeleteApplicationResourceInput{
 		SerialNumber: serial,
+		DeviceID:     53615,
 		ID:           1,
 	})
 	assert.Nil(t, err)
 	assert.True(t, ok)
 }
 
+func TestDeleteAppResourceResolvesDevice(t *testing.T) {
+	teardown, err := setup(t)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer teardown()
+
+	serial := "A444900Z0822111"
+	var deleteInput stl.DeleteApplicationResourceInput
+	muxSTL.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var request struct {
+			Query     string `json:"query"`
+			Variables struct {
+				Input stl.DeleteApplicationResourceInput `json:"input"`
+			} `json:"variables"`
+		}
+		if !assert.Nil(t, json.NewDecoder(r.Body).Decode(&request)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		if !strings.Contains(request.Query, "deleteApplicationResource") {
+			_, _ = io.WriteString(w, `{
+  "data": {
+    "device": {
+      "id": 53615,
+      "serialNumber": "`+serial+`"
+    }
+  }
+}`)
+			return
+		}
+		deleteInput = request.Variables.Input
+		_, _ = io.WriteString(w, `{
+  "data": {
+    "deleteApplicationResource": {
+      "success": true,
+      "statusCode": 202
+    }
+  }
+}`)
+	})
+	ctx := context.Background()
+	ok, err := client.Apps.DeleteAppResource(ctx, stl.DeleteApplicationResourceInput{
+		SerialNumber: serial,
+		ID:           1,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.True(t, ok)
+	assert.Equal(t, int64(53615), deleteInput.DeviceID)
+
+	ok, err = client.Apps.DeleteAppResource(ctx, stl.DeleteApplicationResourceInput{
+		DeviceID: 53615,
+		ID:       1,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.True(t, ok)
+	assert.Equal(t, serial, deleteInput.SerialNumber)
+
+	_, err = client.Apps.DeleteAppResource(ctx, stl.DeleteApplicationResourceInput{ID: 1})
+	assert.ErrorIs(t, err, stl.ErrMissingDevice)
+}
+
+func TestDeleteAllAppResources(t *testing.T) {
+	teardown, err := setup(t)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer teardown()
+
+	var deletedIDs []int64
+	muxSTL.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var body struct {
+			Query     string `json:"query"`
+			Variables struct {
+				Input stl.DeleteApplicationResourceInput `json:"input"`
+			} `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); !assert.Nil(t, err) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		if !strings.HasPrefix(body.Query, "mutation") {
+			_, _ = io.WriteString(w, `{
+  "data": {
+    "applicationResources": {
+      "edges": [
+        {"node": {"id": 874, "deviceId": 53615, "name": "ingress.yml"}},
+        {"node": {"id": 876, "deviceId": 53615, "name": "service.yml"}},
+        {"node": {"id": 877, "deviceId": 53615, "name": "deployment.yml"}}
+      ]
+    }
+  }
+}`)
+			return
+		}
+		input := body.Variables.Input
+		assert.Equal(t, int64(53615), input.DeviceID)
+		assert.Equal(t, "foo", input.SerialNumber)
+		if input.ID == 876 {
+			_, _ = io.WriteString(w, `{
+  "data": {
+    "deleteApplicationResource": {
+      "success": false,
+      "message": "Application resource is locked",
+      "statusCode": 409
+    }
+  }
+}`)
+			return
+		}
+		deletedIDs = append(deletedIDs, input.ID)
+		_, _ = io.WriteString(w, `{
+  "data": {
+    "deleteApplicationResource": {
+      "success": true,
+      "message": "Successfully deleted application resource",
+      "statusCode": 202
+    }
+  }
+}`)
+	})
+	ctx := context.Background()
+	deleted, err := client.Apps.DeleteAllAppResources(ctx, 53615, "foo")
+	assert.Equal(t, 2, deleted)
+	assert.Equal(t, []int64{874, 877}, deletedIDs)
+	if !assert.NotNil(t, err) {
+		return
+	}
+	assert.Contains(t, err.Error(), "876 (service.yml)")
+	assert.Contains(t, err.Error(), "409: Application resource is locked")
+}
+
 func TestAppServiceErrors(t *testing.T) {
 	teardown, err := setup(t)
 	if !assert.Nil(t, err) {
@@ -309,3 +469,349 @@ func TestAppServiceErrors(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Nil(t, a)
 }
+
+func TestAppServiceErrorKinds(t *testing.T) {
+	teardown, err := setup(t)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer teardown()
+
+	status := http.StatusOK
+	response := ""
+	muxSTL.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, response)
+	})
+	ctx := context.Background()
+
+	status = http.StatusUnauthorized
+	_, err = client.Apps.GetAppResourceByID(ctx, 1895)
+	assert.True(t, errors.Is(err, stl.ErrUnauthorized))
+
+	status = http.StatusServiceUnavailable
+	_, err = client.Apps.GetAppResourcesBySerial(ctx, "foo")
+	assert.True(t, errors.Is(err, stl.ErrTransient))
+	assert.False(t, errors.Is(err, stl.ErrUnauthorized))
+
+	status = http.StatusOK
+	response = `{"errors": [{"message": "application resource not found", "extensions": {"code": "NOT_FOUND"}}]}`
+	_, err = client.Apps.GetAppResourceByID(ctx, 1895)
+	assert.True(t, errors.Is(err, stl.ErrNotFound))
+
+	response = `{
+  "data": {
+    "createApplicationResource": {
+      "success": false,
+      "message": "name is invalid",
+      "statusCode": 400,
+      "requestId": "k3s-8681d245-5490-44aa-964b-4e72e34c828c"
+    }
+  }
+}`
+	_, err = client.Apps.CreateAppResource(ctx, stl.CreateApplicationResourceInput{SerialNumber: "foo", Name: "$"})
+	if assert.NotNil(t, err) {
+		assert.True(t, errors.Is(err, stl.ErrValidation))
+		assert.Equal(t, "400: name is invalid", err.Error())
+	}
+
+	assert.True(t, errors.Is(stl.ErrContentTooLarge, stl.ErrValidation))
+	assert.True(t, errors.Is(stl.ErrAppResourceNotFound, stl.ErrNotFound))
+	assert.True(t, errors.Is(stl.ErrUnreachable, stl.ErrTransient))
+}
+
+func TestCreateAppResources(t *testing.T) {
+	teardown, err := setup(t)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer teardown()
+
+	nextID := int64(900)
+	muxSTL.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var body struct {
+			Variables struct {
+				Input stl.CreateApplicationResourceInput `json:"input"`
+			} `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); !assert.Nil(t, err) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		input := body.Variables.Input
+		if input.Name == "service.yml" {
+			_, _ = io.WriteString(w, `{
+  "data": {
+    "createApplicationResource": {
+      "success": false,
+      "message": "Invalid content",
+      "statusCode": 400
+    }
+  }
+}`)
+			return
+		}
+		nextID++
+		_, _ = io.WriteString(w, `{
+  "data": {
+    "createApplicationResource": {
+      "success": true,
+      "statusCode": 201,
+      "requestId": "req-`+strconv.FormatInt(nextID, 10)+`",
+      "applicationResource": {"id": `+strconv.FormatInt(nextID, 10)+`, "deviceId": 53615, "name": "`+input.Name+`"}
+    }
+  }
+}`)
+	})
+
+	created, err := client.Apps.CreateAppResources(context.Background(), []stl.CreateApplicationResourceInput{
+		{SerialNumber: "foo", Name: "ingress.yml", Content: "a"},
+		{SerialNumber: "foo", Name: "service.yml", Content: "b"},
+		{SerialNumber: "foo", Name: "deployment.yml", Content: "c"},
+	})
+	if !assert.NotNil(t, err) {
+		return
+	}
+	assert.Contains(t, err.Error(), "service.yml")
+	if !assert.Len(t, created, 2) {
+		return
+	}
+	assert.Equal(t, int64(901), created[0].ID)
+	assert.Equal(t, "ingress.yml", created[0].Name)
+	assert.Equal(t, int64(902), created[1].ID)
+	assert.Equal(t, "deployment.yml", created[1].Name)
+}
+
+func TestAppResourceContentSize(t *testing.T) {
+	teardown, err := setup(t)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer teardown()
+
+	requests := 0
+	muxSTL.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	ctx := context.Background()
+	_, err = client.Apps.CreateAppResource(ctx, stl.CreateApplicationResourceInput{
+		SerialNumber: "foo",
+		Name:         "terraform.yml",
+		Content:      strings.Repeat("a", stl.DefaultMaxContentSize+1),
+	})
+	assert.ErrorIs(t, err, stl.ErrContentTooLarge)
+	assert.Contains(t, err.Error(), strconv.Itoa(stl.DefaultMaxContentSize+1)+" bytes")
+
+	limited, err := stl.NewClient(consoleClient, &stl.Config{
+		STLAPIURL:      serverSTL.URL,
+		MaxContentSize: 8,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, err = limited.Apps.UpdateAppResource(ctx, stl.UpdateApplicationResourceInput{
+		SerialNumber: "foo",
+		DeviceID:     53615,
+		Name:         "terraform.yml",
+		Content:      "NOTTHEREALTHING",
+	})
+	assert.ErrorIs(t, err, stl.ErrContentTooLarge)
+	assert.Equal(t, 0, requests)
+}
+
+func TestGetAppResourcesBySerials(t *testing.T) {
+	teardown, err := setup(t)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer teardown()
+
+	muxSTL.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Variables struct {
+				Serial string `json:"serial"`
+			} `json:"variables"`
+		}
+		if !assert.Nil(t, json.NewDecoder(r.Body).Decode(&request)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		serial := request.Variables.Serial
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if serial == "unknown" {
+			_, _ = io.WriteString(w, `{"errors": [{"message": "device not found"}]}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{
+  "data": {
+    "applicationResources": {
+      "edges": [{"node": {"id": 874, "deviceId": 53615, "name": "`+serial+`.yml", "content": ""}}]
+    }
+  }
+}`)
+	})
+
+	serials := []string{"unknown"}
+	for i := 0; i < 20; i++ {
+		serials = append(serials, "A4449"+strconv.Itoa(i))
+	}
+	resources, err := client.Apps.GetAppResourcesBySerials(context.Background(), append(serials, serials[1]))
+	assert.NotNil(t, err)
+	assert.Len(t, resources, 20)
+	for _, serial := range serials[1:] {
+		if assert.Len(t, resources[serial], 1) {
+			assert.Equal(t, serial+".yml", resources[serial][0].Name)
+		}
+	}
+	_, ok := resources["unknown"]
+	assert.False(t, ok)
+}
+
+func TestSetAppResourceLock(t *testing.T) {
+	teardown, err := setup(t)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer teardown()
+
+	var input map[string]interface{}
+	muxSTL.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var body struct {
+			Query     string
+			Variables map[string]interface{}
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusOK)
+		switch {
+		case strings.Contains(body.Query, "updateApplicationResource"):
+			input, _ = body.Variables["input"].(map[string]interface{})
+			_, _ = io.WriteString(w, `{
+  "data": {
+    "updateApplicationResource": {
+      "success": true,
+      "message": "Successfully applied application resource",
+      "statusCode": 202,
+      "requestId": "k3s-8681d245-5490-44aa-964b-4e72e34c828c",
+      "applicationResource": {
+        "id": 1895,
+        "deviceId": 53615,
+        "name": "terraform.yml",
+        "content": "Y29udGVudA==",
+        "isLocked": true
+      }
+    }
+  }
+}`)
+		case strings.Contains(body.Query, "device("):
+			_, _ = io.WriteString(w, `{
+  "data": {
+    "device": {
+      "id": 53615,
+      "serialNumber": "foo"
+    }
+  }
+}`)
+		case body.Variables["id"] == float64(1895):
+			_, _ = io.WriteString(w, `{
+  "data": {
+    "applicationResource": {
+      "id": 1895,
+      "deviceId": 53615,
+      "name": "terraform.yml",
+      "content": "Y29udGVudA==",
+      "isLocked": false
+    }
+  }
+}`)
+		default:
+			_, _ = io.WriteString(w, `{
+  "data": {
+    "applicationResource": null
+  }
+}`)
+		}
+	})
+	ctx := context.Background()
+	app, err := client.Apps.SetAppResourceLock(ctx, 1895, true)
+	if !assert.Nil(t, err) {
+		return
+	}
+	if !assert.NotNil(t, app) {
+		return
+	}
+	assert.True(t, app.IsLocked)
+	assert.Equal(t, true, input["isLocked"])
+	assert.Equal(t, "Y29udGVudA==", input["content"])
+	assert.Equal(t, "terraform.yml", input["name"])
+	assert.Equal(t, "foo", input["serialNumber"])
+
+	_, err = client.Apps.SetAppResourceLock(ctx, 1, false)
+	assert.ErrorIs(t, err, stl.ErrAppResourceNotFound)
+}
+
+func TestPlanAppResourceSync(t *testing.T) {
+	teardown, err := setup(t)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer teardown()
+
+	mutations := 0
+	muxSTL.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "mutation") {
+			mutations++
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+  "data": {
+    "applicationResources": {
+      "edges": [
+        {"node": {"id": 1, "deviceId": 53615, "name": "keep.yml", "content": "a2VlcA=="}},
+        {"node": {"id": 2, "deviceId": 53615, "name": "change.yml", "content": "b2xk"}},
+        {"node": {"id": 3, "deviceId": 53615, "name": "remove.yml", "content": "Z29uZQ=="}}
+      ]
+    }
+  }
+}`)
+	})
+	ctx := context.Background()
+	plan, err := client.Apps.PlanAppResourceSync(ctx, "foo", []stl.CreateApplicationResourceInput{
+		{Name: "keep.yml", Content: "a2VlcA=="},
+		{Name: "change.yml", Content: "bmV3"},
+		{Name: "add.yml", Content: "YWRk"},
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, 0, mutations)
+	assert.Equal(t, []string{"keep.yml"}, plan.Unchanged)
+	if assert.Len(t, plan.Create, 1) {
+		assert.Equal(t, "add.yml", plan.Create[0].Name)
+		assert.Equal(t, "foo", plan.Create[0].SerialNumber)
+	}
+	if assert.Len(t, plan.Update, 1) {
+		assert.Equal(t, int64(2), plan.Update[0].ID)
+		assert.Equal(t, "bmV3", plan.Update[0].Content)
+	}
+	if assert.Len(t, plan.Delete, 1) {
+		assert.Equal(t, int64(3), plan.Delete[0].ID)
+		assert.Equal(t, int64(53615), plan.Delete[0].DeviceID)
+	}
+
+	_, err = client.Apps.PlanAppResourceSync(ctx, "foo", []stl.CreateApplicationResourceInput{
+		{Name: "keep.yml"}, {Name: "keep.yml"},
+	})
+	assert.ErrorIs(t, err, stl.ErrInvalidSyncInput)
+}
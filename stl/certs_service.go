@@ -2,7 +2,11 @@ package stl
 
 import (
 	"context"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
+	"time"
+
 	"github.com/hasura/go-graphql-client"
 )
 
@@ -18,6 +22,20 @@ type CustomCert struct {
 	Cert     string `json:"cert"`
 }
 
+// NotAfter returns the expiry of the first certificate in the PEM encoded Cert so
+// certificates can be rotated before they expire
+func (c CustomCert) NotAfter() (time.Time, error) {
+	block, _ := pem.Decode([]byte(c.Cert))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return time.Time{}, fmt.Errorf("%w: no PEM certificate", ErrInvalidCertificate)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %v", ErrInvalidCertificate, err)
+	}
+	return cert.NotAfter, nil
+}
+
 type CreateAppCustomCertInput struct {
 	CustomCert
 	SerialNumber string `json:"serialNumber"`
@@ -38,7 +56,7 @@ func (a *CertsService) GetCustomCertByID(ctx context.Context, id int64) (*Custom
 	var query struct {
 		CustomCert CustomCert `graphql:"appCustomCert(id: $id)"`
 	}
-	err := a.client.gql.Query(ctx, &query, map[string]interface{}{
+	err := a.client.query(ctx, &query, map[string]interface{}{
 		"id": graphql.Int(id),
 	})
 	if err != nil {
@@ -55,7 +73,7 @@ func (a *CertsService) GetCustomCertsBySerial(ctx context.Context, serial string
 			}
 		} `graphql:"appCustomCerts(serialNumber: $serial, first: 10000)"`
 	}
-	err := a.client.gql.Query(ctx, &query, map[string]interface{}{
+	err := a.client.query(ctx, &query, map[string]interface{}{
 		"serial": graphql.String(serial),
 	})
 	if err != nil {
@@ -77,14 +95,14 @@ func (a *CertsService) CreateCustomCert(ctx context.Context, input CreateAppCust
 			AppCustomCert CustomCert
 		} `graphql:"createAppCustomCert(input: $input)"`
 	}
-	err := a.client.gql.Mutate(ctx, &mutation, map[string]interface{}{
+	err := a.client.mutate(ctx, &mutation, map[string]interface{}{
 		"input": input,
 	})
 	if err != nil {
 		return nil, err
 	}
 	if !mutation.CreateAppCustomCert.Success {
-		return nil, fmt.Errorf("%d: %s", mutation.CreateAppCustomCert.StatusCode, mutation.CreateAppCustomCert.Message)
+		return nil, statusError(mutation.CreateAppCustomCert.StatusCode, mutation.CreateAppCustomCert.Message)
 	}
 	return &mutation.CreateAppCustomCert.AppCustomCert, nil
 }
@@ -98,14 +116,14 @@ func (a *CertsService) UpdateCustomCert(ctx context.Context, input UpdateAppCust
 			AppCustomCert CustomCert
 		} `graphql:"updateAppCustomCert(input: $input)"`
 	}
-	err := a.client.gql.Mutate(ctx, &mutation, map[string]interface{}{
+	err := a.client.mutate(ctx, &mutation, map[string]interface{}{
 		"input": input,
 	})
 	if err != nil {
 		return nil, err
 	}
 	if !mutation.UpdateApplicationResource.Success {
-		return nil, fmt.Errorf("%d: %s", mutation.UpdateApplicationResource.StatusCode, mutation.UpdateApplicationResource.Message)
+		return nil, statusError(mutation.UpdateApplicationResource.StatusCode, mutation.UpdateApplicationResource.Message)
 	}
 	return &mutation.UpdateApplicationResource.AppCustomCert, nil
 }
@@ -118,14 +136,55 @@ func (a *CertsService) DeleteCustomCert(ctx context.Context, input DeleteAppCust
 			StatusCode int
 		} `graphql:"deleteAppCustomCert(input: $input)"`
 	}
-	err := a.client.gql.Mutate(ctx, &mutation, map[string]interface{}{
+	err := a.client.mutate(ctx, &mutation, map[string]interface{}{
 		"input": input,
 	})
 	if err != nil {
 		return false, err
 	}
 	if !mutation.DeleteAppCustomCert.Success {
-		return false, fmt.Errorf("%d: %s", mutation.DeleteAppCustomCert.StatusCode, mutation.DeleteAppCustomCert.Message)
+		return false, statusError(mutation.DeleteAppCustomCert.StatusCode, mutation.DeleteAppCustomCert.Message)
 	}
 	return true, nil
 }
+
+// RotateCustomCert replaces the key and certificate of the custom certificate called
+// name of the device with serial. The new certificate must be a valid PEM certificate
+func (a *CertsService) RotateCustomCert(ctx context.Context, serial, name, key, cert string) (*CustomCert, error) {
+	if _, err := (CustomCert{Cert: cert}).NotAfter(); err != nil {
+		return nil, err
+	}
+	existing, err := a.getCustomCertByName(ctx, serial, name)
+	if err != nil {
+		return nil, err
+	}
+	return a.UpdateCustomCert(ctx, UpdateAppCustomCertInput{
+		ID:   existing.ID,
+		Name: name,
+		Key:  key,
+		Cert: cert,
+	})
+}
+
+// RevokeCustomCert deletes the custom certificate called name from the device with serial
+func (a *CertsService) RevokeCustomCert(ctx context.Context, serial, name string) (bool, error) {
+	existing, err := a.getCustomCertByName(ctx, serial, name)
+	if err != nil {
+		return false, err
+	}
+	return a.DeleteCustomCert(ctx, DeleteAppCustomCertInput{ID: existing.ID})
+}
+
+func (a *CertsService) getCustomCertByName(ctx context.Context, serial, name string) (*CustomCert, error) {
+	certs, err := a.GetCustomCertsBySerial(ctx, serial)
+	if err != nil {
+		return nil, err
+	}
+	for _, cert := range *certs {
+		if cert.Name == name {
+			found := cert
+			return &found, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: [%s]", ErrCertificateNotFound, name)
+}
@@ -3,12 +3,18 @@ package stl
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/hasura/go-graphql-client"
 	autoconf "github.com/philips-software/go-hsdp-api/config"
 	"github.com/philips-software/go-hsdp-api/console"
+	"github.com/philips-software/go-hsdp-api/iam"
 	"github.com/philips-software/go-hsdp-api/internal"
 	"golang.org/x/oauth2"
 )
@@ -24,19 +30,41 @@ type OptionFunc func(*http.Request) error
 type Config struct {
 	Region      string
 	Environment string
-	STLAPIURL   string
+	// STLAPIURL is the GraphQL endpoint. It is looked up using Region and Environment when empty
+	STLAPIURL string
+	// GraphQLPath replaces the path of STLAPIURL, e.g. /api/stl/user/v1/graphql,
+	// for regions which serve the GraphQL endpoint elsewhere
+	GraphQLPath string
 	DebugLog    io.Writer
+	// Timeout limits the duration of queries and mutations. Subscriptions are not affected
+	Timeout time.Duration
+	// MaxContentSize is the maximum size in bytes of the Content of an app resource, checked
+	// before it is created or updated. It defaults to DefaultMaxContentSize, a negative
+	// value disables the check
+	MaxContentSize int
+	// Logger, when set, receives a structured record of every query and mutation
+	Logger OperationLogger
 }
 
+// DefaultMaxContentSize is the default Config.MaxContentSize, the 1 MiB object size limit of Kubernetes
+const DefaultMaxContentSize = 1024 * 1024
+
 // A Client manages communication with HSDP Edge API
 type Client struct {
 	// HTTP consoleClient used to communicate with IAM API
 	consoleClient *console.Client
 
+	iamClient *iam.Client
+
+	tokenSource oauth2.TokenSource
+
 	gql *graphql.Client
 
 	config *Config
 
+	// endpoint is the GraphQL endpoint derived from config
+	endpoint string
+
 	// User agent used when communicating with the HSDP Edge API.
 	UserAgent string
 
@@ -44,18 +72,42 @@ type Client struct {
 	Apps    *AppsService
 	Config  *ConfigService
 	Certs   *CertsService
+	Groups  *GroupsService
 }
 
 // NewClient returns a new HSDP Edge API consoleClient. Configured console and IAM clients
 // must be provided as the underlying API requires tokens from respective services
 func NewClient(consoleClient *console.Client, config *Config) (*Client, error) {
-	return newClient(consoleClient, config)
+	c := &Client{consoleClient: consoleClient, tokenSource: consoleClient, config: config, UserAgent: userAgent}
+	return newClient(c, oauth2.NewClient(context.Background(), consoleClient))
+}
+
+// NewClientWithIAM returns a new HSDP Edge API client which uses a configured IAM client
+// for authentication. A bearer token is obtained from the IAM client before each request
+// so long-lived clients keep working after the initial token expires
+func NewClientWithIAM(iamClient *iam.Client, config *Config) (*Client, error) {
+	if iamClient == nil {
+		return nil, ErrMissingIAMClient
+	}
+	tokenSource := &iamTokenSource{client: iamClient}
+	c := &Client{iamClient: iamClient, tokenSource: tokenSource, config: config, UserAgent: userAgent}
+	httpClient := &http.Client{
+		Transport: &oauth2.Transport{
+			Source: tokenSource,
+		},
+	}
+	return newClient(c, httpClient)
 }
 
-func newClient(consoleClient *console.Client, config *Config) (*Client, error) {
+func newClient(c *Client, httpClient *http.Client) (*Client, error) {
+	config := c.config
 	doAutoconf(config)
-	c := &Client{consoleClient: consoleClient, config: config, UserAgent: userAgent}
-	httpClient := oauth2.NewClient(context.Background(), consoleClient)
+	endpoint, err := graphQLEndpoint(config)
+	if err != nil {
+		return nil, err
+	}
+	c.endpoint = endpoint
+	httpClient.Timeout = config.Timeout
 
 	if config.DebugLog != nil {
 		httpClient.Transport = internal.NewLoggingRoundTripper(httpClient.Transport, config.DebugLog)
@@ -64,19 +116,70 @@ func newClient(consoleClient *console.Client, config *Config) (*Client, error) {
 	header.Set("User-Agent", userAgent)
 	httpClient.Transport = internal.NewHeaderRoundTripper(httpClient.Transport, header)
 
-	c.gql = graphql.NewClient(config.STLAPIURL, httpClient)
+	c.gql = graphql.NewClient(c.endpoint, httpClient)
 	c.Devices = &DevicesService{client: c}
 	c.Apps = &AppsService{client: c}
 	c.Config = &ConfigService{client: c}
 	c.Certs = &CertsService{client: c}
+	c.Groups = &GroupsService{client: c}
 
 	return c, nil
 }
 
+// validateURL checks that apiURL is an absolute http(s) URL
+func validateURL(apiURL string) error {
+	if apiURL == "" {
+		return ErrSTLAPIURLCannotBeEmpty
+	}
+	u, err := url.Parse(apiURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: [%s]", ErrInvalidSTLAPIURL, apiURL)
+	}
+	return nil
+}
+
+// graphQLEndpoint returns the GraphQL endpoint of config. The path of STLAPIURL
+// is replaced by GraphQLPath when that is set
+func graphQLEndpoint(config *Config) (string, error) {
+	if err := validateURL(config.STLAPIURL); err != nil {
+		return "", err
+	}
+	if config.GraphQLPath == "" {
+		return config.STLAPIURL, nil
+	}
+	path, err := url.Parse(config.GraphQLPath)
+	if err != nil || !strings.HasPrefix(path.Path, "/") || path.Host != "" || path.RawQuery != "" {
+		return "", fmt.Errorf("%w: [%s]", ErrInvalidGraphQLPath, config.GraphQLPath)
+	}
+	u, _ := url.Parse(config.STLAPIURL)
+	u.Path = path.Path
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+// iamTokenSource adapts an IAM client to oauth2.TokenSource. The IAM client
+// takes care of refreshing the token when it is about to expire
+type iamTokenSource struct {
+	client *iam.Client
+}
+
+func (s *iamTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.client.Token()
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		Expiry:      time.Unix(s.client.Expires(), 0),
+	}, nil
+}
+
 func doAutoconf(config *Config) {
 	if config.Region != "" {
 		c, err := autoconf.New(
-			autoconf.WithRegion(config.Region))
+			autoconf.WithRegion(config.Region),
+			autoconf.WithEnv(config.Environment))
 		if err == nil {
 			stlService := c.Service("stl")
 			if config.STLAPIURL == "" {
@@ -88,7 +191,30 @@ func doAutoconf(config *Config) {
 
 // Query is a generic GraphQL query
 func (c *Client) Query(ctx context.Context, q interface{}, variables map[string]interface{}) error {
-	return c.gql.Query(ctx, q, variables)
+	return c.query(ctx, q, variables)
+}
+
+// Ping verifies that the GraphQL endpoint is reachable and accepts the token of the
+// client using a cheap __typename query. Rejected tokens are reported as an error
+// wrapping ErrUnauthorized, failures to reach the endpoint as one wrapping ErrUnreachable
+func (c *Client) Ping(ctx context.Context) error {
+	var query struct {
+		Typename string `graphql:"__typename"`
+	}
+	err := c.query(ctx, &query, nil)
+	if err == nil {
+		return nil
+	}
+	var networkErr graphql.NetworkError
+	switch {
+	case errors.Is(err, ErrUnauthorized):
+		return fmt.Errorf("%w: %v", ErrUnauthorized, err)
+	case errors.Is(err, ErrUnreachable):
+		return fmt.Errorf("%w: %v", ErrUnreachable, err)
+	case errors.As(err, &networkErr):
+		return fmt.Errorf("%w: %v", ErrUnreachable, err)
+	}
+	return err
 }
 
 // Close releases allocated resources of clients
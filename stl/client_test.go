@@ -2,14 +2,18 @@ package stl_test
 
 import (
 	"context"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/hasura/go-graphql-client"
 	"github.com/philips-software/go-hsdp-api/console"
+	"github.com/philips-software/go-hsdp-api/iam"
 	"github.com/philips-software/go-hsdp-api/stl"
 	"github.com/stretchr/testify/assert"
 )
@@ -133,3 +137,241 @@ func TestDebug(t *testing.T) {
 		t.Errorf("Expected something to be written to DebugLog")
 	}
 }
+
+func TestNewClientWithIAM(t *testing.T) {
+	muxIAM := http.NewServeMux()
+	serverIAM := httptest.NewServer(muxIAM)
+	defer serverIAM.Close()
+	muxSTL = http.NewServeMux()
+	serverSTL = httptest.NewServer(muxSTL)
+	defer serverSTL.Close()
+
+	loginToken := "44d20214-7879-4e35-923d-f9d4e01c9746"
+	refreshedToken := "55d20214-7879-4e35-923d-f9d4e01c9746"
+
+	muxIAM.HandleFunc("/authorize/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		assert.Nil(t, err)
+		returnToken := loginToken
+		if r.Form.Get("grant_type") == "refresh_token" {
+			returnToken = refreshedToken
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{
+    "scope": "mail",
+    "access_token": "`+returnToken+`",
+    "refresh_token": "31f1a449-ef8e-4bfc-a227-4f2353fde547",
+    "expires_in": 1799,
+    "token_type": "Bearer"
+}`)
+	})
+	_, err := stl.NewClientWithIAM(nil, &stl.Config{
+		STLAPIURL: serverSTL.URL,
+	})
+	assert.True(t, errors.Is(err, stl.ErrMissingIAMClient))
+
+	var seen []string
+	muxSTL.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"data": {"device": {"id": 1, "serialNumber": "foo"}}}`)
+	})
+
+	iamClient, err := iam.NewClient(nil, &iam.Config{
+		OAuth2ClientID: "TestClient",
+		OAuth2Secret:   "Secret",
+		IAMURL:         serverIAM.URL,
+		IDMURL:         serverIAM.URL,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	err = iamClient.Login("username", "password")
+	if !assert.Nil(t, err) {
+		return
+	}
+	iamSTLClient, err := stl.NewClientWithIAM(iamClient, &stl.Config{
+		STLAPIURL: serverSTL.URL,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	ctx := context.Background()
+	_, err = iamSTLClient.Devices.GetDeviceBySerial(ctx, "foo")
+	assert.Nil(t, err)
+	iamClient.ExpireToken()
+	_, err = iamSTLClient.Devices.GetDeviceBySerial(ctx, "foo")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Bearer " + loginToken, "Bearer " + refreshedToken}, seen)
+}
+
+func TestNewClientConfig(t *testing.T) {
+	teardown, err := setup(t)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer teardown()
+
+	_, err = stl.NewClient(consoleClient, &stl.Config{})
+	assert.True(t, errors.Is(err, stl.ErrSTLAPIURLCannotBeEmpty))
+	for _, invalid := range []string{"stl.example.com/graphql", "ftp://stl.example.com", "https://"} {
+		_, err = stl.NewClient(consoleClient, &stl.Config{STLAPIURL: invalid})
+		assert.True(t, errors.Is(err, stl.ErrInvalidSTLAPIURL), invalid)
+	}
+
+	muxSTL.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"data": {"device": {"id": 1, "serialNumber": "foo"}}}`)
+	})
+	timeoutClient, err := stl.NewClient(consoleClient, &stl.Config{
+		STLAPIURL: serverSTL.URL,
+		Timeout:   50 * time.Millisecond,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, err = timeoutClient.Devices.GetDeviceBySerial(context.Background(), "foo")
+	assert.NotNil(t, err)
+}
+
+func TestGraphQLPath(t *testing.T) {
+	teardown, err := setup(t)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer teardown()
+
+	for _, invalid := range []string{"graphql", "https://stl.example.com/graphql", "/graphql?region=eu"} {
+		_, err = stl.NewClient(consoleClient, &stl.Config{STLAPIURL: serverSTL.URL, GraphQLPath: invalid})
+		assert.True(t, errors.Is(err, stl.ErrInvalidGraphQLPath), invalid)
+	}
+
+	muxSTL.HandleFunc("/api/stl/staging/v1/graphql", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"data": {"device": {"id": 1, "serialNumber": "foo"}}}`)
+	})
+	stagingClient, err := stl.NewClient(consoleClient, &stl.Config{
+		STLAPIURL:   serverSTL.URL + "/api/stl/user/v1/graphql",
+		GraphQLPath: "/api/stl/staging/v1/graphql",
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	device, err := stagingClient.Devices.GetDeviceBySerial(context.Background(), "foo")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "foo", device.SerialNumber)
+
+	_, err = stl.NewClient(consoleClient, &stl.Config{Region: "us-east", Environment: "prod"})
+	assert.Nil(t, err)
+}
+
+func TestPing(t *testing.T) {
+	teardown, err := setup(t)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer teardown()
+
+	status := http.StatusOK
+	muxSTL.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, `{"data": {"__typename": "Query"}}`)
+	})
+	ctx := context.Background()
+	assert.Nil(t, client.Ping(ctx))
+
+	status = http.StatusUnauthorized
+	assert.True(t, errors.Is(client.Ping(ctx), stl.ErrUnauthorized))
+
+	status = http.StatusBadGateway
+	assert.True(t, errors.Is(client.Ping(ctx), stl.ErrUnreachable))
+
+	serverSTL.Close()
+	assert.True(t, errors.Is(client.Ping(ctx), stl.ErrUnreachable))
+}
+
+type recordingLogger struct {
+	entries []stl.OperationLog
+}
+
+func (l *recordingLogger) LogOperation(entry stl.OperationLog) {
+	l.entries = append(l.entries, entry)
+}
+
+func TestOperationLogger(t *testing.T) {
+	teardown, err := setup(t)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer teardown()
+
+	muxSTL.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if strings.Contains(string(body), "__typename") {
+			_, _ = io.WriteString(w, `{"data": {"__typename": "Query"}}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{
+  "data": {
+    "updateAppLogging": {
+      "success": false,
+      "message": "device not found",
+      "statusCode": 404
+    }
+  }
+}`)
+	})
+
+	logger := &recordingLogger{}
+	loggingClient, err := stl.NewClient(consoleClient, &stl.Config{
+		STLAPIURL: serverSTL.URL,
+		Logger:    logger,
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, err = loggingClient.Config.UpdateAppLogging(context.Background(), stl.UpdateAppLoggingInput{
+		SerialNumber: "A444900Z0822111",
+		AppLogging: stl.AppLogging{
+			HSDPLogging:   true,
+			HSDPSharedKey: "shared",
+			HSDPSecretKey: "secret",
+		},
+	})
+	assert.NotNil(t, err)
+	if !assert.Len(t, logger.entries, 1) {
+		return
+	}
+	entry := logger.entries[0]
+	assert.Equal(t, "updateAppLogging", entry.Name)
+	assert.True(t, entry.Mutation)
+	assert.False(t, entry.Success)
+	assert.Equal(t, 404, entry.StatusCode)
+	assert.Nil(t, entry.Err)
+	if !assert.IsType(t, map[string]interface{}{}, entry.Variables["input"]) {
+		return
+	}
+	input := entry.Variables["input"].(map[string]interface{})
+	assert.Equal(t, "A444900Z0822111", input["serialNumber"])
+	assert.Equal(t, "[REDACTED]", input["hsdpSharedKey"])
+	assert.Equal(t, "[REDACTED]", input["hsdpSecretKey"])
+	assert.Equal(t, true, input["hsdpLogging"])
+
+	err = loggingClient.Ping(context.Background())
+	assert.Nil(t, err)
+	if assert.Len(t, logger.entries, 2) {
+		assert.Equal(t, "__typename", logger.entries[1].Name)
+		assert.False(t, logger.entries[1].Mutation)
+		assert.True(t, logger.entries[1].Success)
+	}
+}
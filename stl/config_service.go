@@ -57,7 +57,7 @@ func (c *ConfigService) GetFirewallExceptionsBySerial(ctx context.Context, seria
 	var query struct {
 		AppFirewallException AppFirewallException `graphql:"appFirewallException(serialNumber: $serialNumber)"`
 	}
-	err := c.client.gql.Query(ctx, &query, map[string]interface{}{
+	err := c.client.query(ctx, &query, map[string]interface{}{
 		"serialNumber": graphql.String(serial),
 	})
 	if err != nil {
@@ -75,14 +75,14 @@ func (c *ConfigService) UpdateAppFirewallExceptions(ctx context.Context, input U
 			AppFirewallException AppFirewallException
 		} `graphql:"updateAppFirewallException(input: $input)"`
 	}
-	err := c.client.gql.Mutate(ctx, &mutation, map[string]interface{}{
+	err := c.client.mutate(ctx, &mutation, map[string]interface{}{
 		"input": input,
 	})
 	if err != nil {
 		return nil, err
 	}
 	if !mutation.UpdateAppFirewallException.Success {
-		return nil, fmt.Errorf("%d: %s", mutation.UpdateAppFirewallException.StatusCode, mutation.UpdateAppFirewallException.Message)
+		return nil, statusError(mutation.UpdateAppFirewallException.StatusCode, mutation.UpdateAppFirewallException.Message)
 	}
 	return &mutation.UpdateAppFirewallException.AppFirewallException, nil
 }
@@ -91,7 +91,7 @@ func (c *ConfigService) GetAppLoggingBySerial(ctx context.Context, serial string
 	var query struct {
 		AppLogging AppLogging `graphql:"appLogging(serialNumber: $serialNumber)"`
 	}
-	err := c.client.gql.Query(ctx, &query, map[string]interface{}{
+	err := c.client.query(ctx, &query, map[string]interface{}{
 		"serialNumber": graphql.String(serial),
 	})
 	if err != nil {
@@ -109,14 +109,14 @@ func (c *ConfigService) UpdateAppLogging(ctx context.Context, input UpdateAppLog
 			AppLogging AppLogging
 		} `graphql:"updateAppLogging(input: $input)"`
 	}
-	err := c.client.gql.Mutate(ctx, &mutation, map[string]interface{}{
+	err := c.client.mutate(ctx, &mutation, map[string]interface{}{
 		"input": input,
 	})
 	if err != nil {
 		return nil, err
 	}
 	if !mutation.UpdateAppLogging.Success {
-		return nil, fmt.Errorf("%d: %s", mutation.UpdateAppLogging.StatusCode, mutation.UpdateAppLogging.Message)
+		return nil, statusError(mutation.UpdateAppLogging.StatusCode, mutation.UpdateAppLogging.Message)
 	}
 	return &mutation.UpdateAppLogging.AppLogging, nil
 }
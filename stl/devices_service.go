@@ -3,6 +3,8 @@ package stl
 import (
 	"context"
 	"fmt"
+	"strings"
+
 	"github.com/hasura/go-graphql-client"
 )
 
@@ -19,10 +21,61 @@ type Device struct {
 	}
 }
 
+// StateValue returns State as a DeviceState, DeviceStateUnknown for states this
+// package does not know
+func (d Device) StateValue() DeviceState {
+	return ParseDeviceState(d.State)
+}
+
+// DeviceState is the state of a STL device. Compare with the DeviceState constants
+// instead of string literals, see Device.StateValue and ParseDeviceState
+type DeviceState string
+
+// Known device states
+const (
+	DeviceStateUnknown      DeviceState = ""
+	DeviceStatePending      DeviceState = "pending"
+	DeviceStateAuthorized   DeviceState = "authorized"
+	DeviceStateUnauthorized DeviceState = "unauthorized"
+)
+
+// ParseDeviceState returns the DeviceState of state, ignoring case and surrounding
+// whitespace. DeviceStateUnknown is returned for states this package does not know
+func ParseDeviceState(state string) DeviceState {
+	s := DeviceState(strings.ToLower(strings.TrimSpace(state)))
+	if !s.Valid() {
+		return DeviceStateUnknown
+	}
+	return s
+}
+
+// Valid reports whether s is one of the known device states
+func (s DeviceState) Valid() bool {
+	switch s {
+	case DeviceStatePending, DeviceStateAuthorized, DeviceStateUnauthorized:
+		return true
+	}
+	return false
+}
+
 type DevicesService struct {
 	client *Client
 }
 
+// devicesPageSize is the number of devices fetched per page by the List functions
+const devicesPageSize = 100
+
+// devicesConnection is a page of the devices connection
+type devicesConnection struct {
+	Edges []struct {
+		Node Device
+	}
+	PageInfo struct {
+		HasNextPage bool
+		EndCursor   string
+	}
+}
+
 type SyncDeviceConfigsInput struct {
 	SerialNumber string `json:"serialNumber"`
 }
@@ -35,14 +88,14 @@ func (d *DevicesService) SyncDeviceConfig(ctx context.Context, serial string) er
 			Message    string
 		} `graphql:"syncDeviceConfigs(input: $input)"`
 	}
-	err := d.client.gql.Mutate(ctx, &mutation, map[string]interface{}{
+	err := d.client.mutate(ctx, &mutation, map[string]interface{}{
 		"input": SyncDeviceConfigsInput{SerialNumber: serial},
 	})
 	if err != nil {
 		return err
 	}
 	if !mutation.SyncDeviceConfigs.Success {
-		return fmt.Errorf("%d: %s", mutation.SyncDeviceConfigs.StatusCode, mutation.SyncDeviceConfigs.Message)
+		return statusError(mutation.SyncDeviceConfigs.StatusCode, mutation.SyncDeviceConfigs.Message)
 	}
 	return nil
 }
@@ -52,7 +105,7 @@ func (d *DevicesService) GetDeviceBySerial(ctx context.Context, serial string) (
 	var query struct {
 		Device Device `graphql:"device(serialNumber: $serial)"`
 	}
-	err := d.client.gql.Query(ctx, &query, map[string]interface{}{
+	err := d.client.query(ctx, &query, map[string]interface{}{
 		"serial": graphql.String(serial),
 	})
 	if err != nil {
@@ -66,7 +119,7 @@ func (d *DevicesService) GetDeviceByID(ctx context.Context, id int64) (*Device,
 	var query struct {
 		Device Device `graphql:"device(id: $id)"`
 	}
-	err := d.client.gql.Query(ctx, &query, map[string]interface{}{
+	err := d.client.query(ctx, &query, map[string]interface{}{
 		"id": graphql.Int(id),
 	})
 	if err != nil {
@@ -74,3 +127,80 @@ func (d *DevicesService) GetDeviceByID(ctx context.Context, id int64) (*Device,
 	}
 	return &query.Device, nil
 }
+
+// ListByGroup returns all devices of the group with groupID. All pages are fetched
+func (d *DevicesService) ListByGroup(ctx context.Context, groupID string) ([]Device, error) {
+	return d.listDevices(func(after *graphql.String) (*devicesConnection, error) {
+		var query struct {
+			Devices devicesConnection `graphql:"devices(groupId: $groupId, first: $first, after: $after)"`
+		}
+		err := d.client.query(ctx, &query, map[string]interface{}{
+			"groupId": graphql.String(groupID),
+			"first":   graphql.Int(devicesPageSize),
+			"after":   after,
+		})
+		return &query.Devices, err
+	})
+}
+
+// ListByRegion returns all devices in region, e.g. "na1". All pages are fetched
+func (d *DevicesService) ListByRegion(ctx context.Context, region string) ([]Device, error) {
+	return d.listDevices(func(after *graphql.String) (*devicesConnection, error) {
+		var query struct {
+			Devices devicesConnection `graphql:"devices(region: $region, first: $first, after: $after)"`
+		}
+		err := d.client.query(ctx, &query, map[string]interface{}{
+			"region": graphql.String(region),
+			"first":  graphql.Int(devicesPageSize),
+			"after":  after,
+		})
+		return &query.Devices, err
+	})
+}
+
+// listDevices collects the devices of all pages returned by queryPage, starting
+// with the first page for a nil cursor
+func (d *DevicesService) listDevices(queryPage func(after *graphql.String) (*devicesConnection, error)) ([]Device, error) {
+	devices := make([]Device, 0)
+	var after *graphql.String
+	for {
+		page, err := queryPage(after)
+		if err != nil {
+			return nil, err
+		}
+		for _, edge := range page.Edges {
+			devices = append(devices, edge.Node)
+		}
+		if !page.PageInfo.HasNextPage || page.PageInfo.EndCursor == "" {
+			return devices, nil
+		}
+		cursor := graphql.String(page.PageInfo.EndCursor)
+		after = &cursor
+	}
+}
+
+// resolve fills in the missing one of deviceID and serial by looking up the device,
+// so mutation inputs which need both can be built from either
+func (d *DevicesService) resolve(ctx context.Context, deviceID *int64, serial *string) error {
+	var device *Device
+	var err error
+	switch {
+	case *deviceID != 0 && *serial != "":
+		return nil
+	case *serial != "":
+		device, err = d.GetDeviceBySerial(ctx, *serial)
+	case *deviceID != 0:
+		device, err = d.GetDeviceByID(ctx, *deviceID)
+	default:
+		return ErrMissingDevice
+	}
+	if err != nil {
+		return err
+	}
+	if device.ID == 0 || device.SerialNumber == "" {
+		return fmt.Errorf("%w: id=%d serial=[%s]", ErrDeviceNotFound, *deviceID, *serial)
+	}
+	*deviceID = device.ID
+	*serial = device.SerialNumber
+	return nil
+}
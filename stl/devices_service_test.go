@@ -2,10 +2,13 @@ package stl_test
 
 import (
 	"context"
+	"encoding/json"
 	"github.com/stretchr/testify/assert"
 	"io"
 	"net/http"
 	"testing"
+
+	"github.com/philips-software/go-hsdp-api/stl"
 )
 
 func TestGetDevices(t *testing.T) {
@@ -53,6 +56,9 @@ func TestGetDevices(t *testing.T) {
 	assert.Equal(t, int64(53615), device.ID)
 	assert.Equal(t, "192.168.2.2", device.PrimaryInterface.Address)
 	assert.Equal(t, "Andy SME100-1", device.Name)
+	assert.Equal(t, "authorized", device.State)
+	assert.Equal(t, stl.DeviceStateAuthorized, device.StateValue())
+	assert.True(t, device.StateValue().Valid())
 
 	device, err = client.Devices.GetDeviceByID(ctx, 53615)
 	if !assert.Nil(t, err) {
@@ -117,3 +123,81 @@ func TestDeviceFailures(t *testing.T) {
 	err = client.Devices.SyncDeviceConfig(ctx, serial)
 	assert.NotNil(t, err)
 }
+
+func TestListDevices(t *testing.T) {
+	teardown, err := setup(t)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer teardown()
+
+	var queries []string
+	muxSTL.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var request struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		if !assert.Nil(t, json.NewDecoder(r.Body).Decode(&request)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		queries = append(queries, request.Query)
+		w.WriteHeader(http.StatusOK)
+		if request.Variables["after"] == nil {
+			_, _ = io.WriteString(w, `{
+  "data": {
+    "devices": {
+      "edges": [
+        {"node": {"id": 1, "serialNumber": "A1", "region": "na1"}},
+        {"node": {"id": 2, "serialNumber": "A2", "region": "na1"}}
+      ],
+      "pageInfo": {"hasNextPage": true, "endCursor": "Mg=="}
+    }
+  }
+}`)
+			return
+		}
+		assert.Equal(t, "Mg==", request.Variables["after"])
+		_, _ = io.WriteString(w, `{
+  "data": {
+    "devices": {
+      "edges": [
+        {"node": {"id": 3, "serialNumber": "A3", "region": "na1"}}
+      ],
+      "pageInfo": {"hasNextPage": false, "endCursor": "Mw=="}
+    }
+  }
+}`)
+	})
+	ctx := context.Background()
+	devices, err := client.Devices.ListByRegion(ctx, "na1")
+	if !assert.Nil(t, err) {
+		return
+	}
+	if !assert.Len(t, devices, 3) {
+		return
+	}
+	assert.Equal(t, "A3", devices[2].SerialNumber)
+	if assert.Len(t, queries, 2) {
+		assert.Contains(t, queries[0], "devices(region: $region")
+	}
+
+	queries = nil
+	devices, err = client.Devices.ListByGroup(ctx, "group1")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Len(t, devices, 3)
+	if assert.Len(t, queries, 2) {
+		assert.Contains(t, queries[0], "devices(groupId: $groupId")
+	}
+}
+
+func TestParseDeviceState(t *testing.T) {
+	assert.Equal(t, stl.DeviceStateAuthorized, stl.ParseDeviceState(" Authorized "))
+	assert.Equal(t, stl.DeviceStatePending, stl.ParseDeviceState("pending"))
+	assert.Equal(t, stl.DeviceStateUnknown, stl.ParseDeviceState("decommissioned"))
+	assert.False(t, stl.DeviceState("decommissioned").Valid())
+	assert.Equal(t, stl.DeviceStateUnknown, stl.Device{State: "decommissioned"}.StateValue())
+}
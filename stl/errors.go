@@ -0,0 +1,141 @@
+package stl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hasura/go-graphql-client"
+	"golang.org/x/oauth2"
+)
+
+// Kinds of errors. Errors of queries and mutations are classified by the status code of
+// the response or of the mutation result and by the code of the GraphQL error extensions,
+// use errors.Is to branch on them, e.g. to retry ErrTransient errors
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrNotFound     = errors.New("not found")
+	ErrValidation   = errors.New("validation failed")
+	ErrTransient    = errors.New("transient failure")
+)
+
+var (
+	ErrSTLAPIURLCannotBeEmpty = errors.New("STL API URL cannot be empty")
+	ErrInvalidSTLAPIURL       = errors.New("invalid STL API URL")
+	ErrInvalidGraphQLPath     = errors.New("invalid GraphQL path")
+	ErrMissingIAMClient       = errors.New("missing IAM client")
+	ErrInvalidCertificate     = withKind(errors.New("invalid certificate"), ErrValidation)
+	ErrCertificateNotFound    = withKind(errors.New("certificate not found"), ErrNotFound)
+	ErrMissingDevice          = withKind(errors.New("device ID or serial number required"), ErrValidation)
+	ErrDeviceNotFound         = withKind(errors.New("device not found"), ErrNotFound)
+	ErrGroupNotFound          = withKind(errors.New("device group not found"), ErrNotFound)
+	ErrContentTooLarge        = withKind(errors.New("app resource content too large"), ErrValidation)
+	ErrAppResourceNotFound    = withKind(errors.New("app resource not found"), ErrNotFound)
+	ErrInvalidSyncInput       = withKind(errors.New("invalid app resource sync input"), ErrValidation)
+	ErrUnreachable            = withKind(errors.New("STL API unreachable"), ErrTransient)
+)
+
+// kindError is err classified as kind. The message is the one of err
+type kindError struct {
+	err  error
+	kind error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() []error {
+	return []error{e.err, e.kind}
+}
+
+// withKind returns err classified as kind, or err itself when kind is nil
+func withKind(err, kind error) error {
+	if kind == nil {
+		return err
+	}
+	return &kindError{err: err, kind: kind}
+}
+
+// statusKind returns the kind of error of a HTTP or mutation status code, nil when
+// the status code does not tell
+func statusKind(statusCode int) error {
+	switch {
+	case statusCode == http.StatusUnauthorized, statusCode == http.StatusForbidden:
+		return ErrUnauthorized
+	case statusCode == http.StatusNotFound:
+		return ErrNotFound
+	case statusCode == http.StatusBadRequest, statusCode == http.StatusUnprocessableEntity:
+		return ErrValidation
+	case statusCode == http.StatusRequestTimeout, statusCode == http.StatusTooManyRequests,
+		statusCode >= 500 && statusCode != http.StatusNotImplemented:
+		return ErrTransient
+	}
+	return nil
+}
+
+// extensionKind returns the kind of error of the code of GraphQL error extensions, nil
+// when the code is unknown
+func extensionKind(extensions map[string]interface{}) error {
+	if statusCode, ok := extensions["statusCode"].(float64); ok {
+		if kind := statusKind(int(statusCode)); kind != nil {
+			return kind
+		}
+	}
+	code, _ := extensions["code"].(string)
+	switch strings.ToUpper(code) {
+	case "UNAUTHENTICATED", "UNAUTHORIZED", "FORBIDDEN", "ACCESS_DENIED":
+		return ErrUnauthorized
+	case "NOT_FOUND":
+		return ErrNotFound
+	case "BAD_USER_INPUT", "BAD_REQUEST", "VALIDATION_FAILED", "VALIDATION_ERROR",
+		"GRAPHQL_VALIDATION_FAILED", "GRAPHQL_PARSE_FAILED":
+		return ErrValidation
+	case "TIMEOUT", "SERVICE_UNAVAILABLE", "TOO_MANY_REQUESTS", "RATE_LIMITED":
+		return ErrTransient
+	}
+	return nil
+}
+
+// classify returns err of a query or mutation classified as one of the kinds of errors.
+// Errors which cannot be classified, e.g. of a cancelled context, are returned as is
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, kind := range []error{ErrUnauthorized, ErrNotFound, ErrValidation, ErrTransient} {
+		if errors.Is(err, kind) {
+			return err
+		}
+	}
+	var networkErr graphql.NetworkError
+	var retrieveErr *oauth2.RetrieveError
+	var graphqlErrs graphql.Errors
+	var urlErr *url.Error
+	if errors.As(err, &graphqlErrs) {
+		for _, graphqlErr := range graphqlErrs {
+			if kind := extensionKind(graphqlErr.Extensions); kind != nil {
+				return withKind(err, kind)
+			}
+		}
+	}
+	switch {
+	case errors.As(err, &retrieveErr):
+		return withKind(err, ErrUnauthorized)
+	case errors.As(err, &networkErr):
+		return withKind(err, statusKind(networkErr.StatusCode()))
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return err
+	case errors.As(err, &urlErr):
+		return withKind(err, ErrUnreachable)
+	}
+	return err
+}
+
+// statusError returns the error of a mutation which reported no success
+func statusError(statusCode int, message string) error {
+	return withKind(fmt.Errorf("%d: %s", statusCode, message), statusKind(statusCode))
+}
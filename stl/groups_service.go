@@ -0,0 +1,95 @@
+package stl
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hasura/go-graphql-client"
+)
+
+// Group represents a STL device group. Its ID is the GroupID of app resource inputs
+type Group struct {
+	ID          string
+	Name        string
+	Description string
+}
+
+type GroupsService struct {
+	client *Client
+}
+
+// groupsPageSize is the number of groups fetched per page by List
+const groupsPageSize = 100
+
+// List returns all device groups. All pages are fetched
+func (g *GroupsService) List(ctx context.Context) ([]Group, error) {
+	groups := make([]Group, 0)
+	var after *graphql.String
+	for {
+		var query struct {
+			Groups struct {
+				Edges []struct {
+					Node Group
+				}
+				PageInfo struct {
+					HasNextPage bool
+					EndCursor   string
+				}
+			} `graphql:"groups(first: $first, after: $after)"`
+		}
+		err := g.client.query(ctx, &query, map[string]interface{}{
+			"first": graphql.Int(groupsPageSize),
+			"after": after,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, edge := range query.Groups.Edges {
+			groups = append(groups, edge.Node)
+		}
+		if !query.Groups.PageInfo.HasNextPage || query.Groups.PageInfo.EndCursor == "" {
+			return groups, nil
+		}
+		cursor := graphql.String(query.Groups.PageInfo.EndCursor)
+		after = &cursor
+	}
+}
+
+// Get retrieves the device group with the given id. An error wrapping ErrGroupNotFound
+// is returned when there is no such group, so Get can be used to validate a group id
+// before it is passed in an app resource input
+func (g *GroupsService) Get(ctx context.Context, id string) (*Group, error) {
+	var query struct {
+		Group Group `graphql:"group(id: $id)"`
+	}
+	err := g.client.query(ctx, &query, map[string]interface{}{
+		"id": graphql.String(id),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if query.Group.ID == "" {
+		return nil, fmt.Errorf("%w: [%s]", ErrGroupNotFound, id)
+	}
+	return &query.Group, nil
+}
+
+// Devices returns the devices which are a member of the group with the given id, see
+// DevicesService.ListByGroup
+func (g *GroupsService) Devices(ctx context.Context, id string) ([]Device, error) {
+	return g.client.Devices.ListByGroup(ctx, id)
+}
+
+// Contains reports whether the device with serial is a member of the group with the given id
+func (g *GroupsService) Contains(ctx context.Context, id, serial string) (bool, error) {
+	devices, err := g.Devices(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	for _, device := range devices {
+		if device.SerialNumber == serial {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,95 @@
+package stl_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/philips-software/go-hsdp-api/stl"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupsService(t *testing.T) {
+	teardown, err := setup(t)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer teardown()
+
+	muxSTL.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var request struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		if !assert.Nil(t, json.NewDecoder(r.Body).Decode(&request)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		switch {
+		case strings.Contains(request.Query, "groups(first: $first, after: $after)"):
+			if request.Variables["after"] == nil {
+				_, _ = io.WriteString(w, `{
+  "data": {
+    "groups": {
+      "edges": [{"node": {"id": "group1", "name": "Ward A"}}],
+      "pageInfo": {"hasNextPage": true, "endCursor": "MQ=="}
+    }
+  }
+}`)
+				return
+			}
+			_, _ = io.WriteString(w, `{
+  "data": {
+    "groups": {
+      "edges": [{"node": {"id": "group2", "name": "Ward B"}}],
+      "pageInfo": {"hasNextPage": false, "endCursor": "Mg=="}
+    }
+  }
+}`)
+		case strings.Contains(request.Query, "group(id: $id)"):
+			if request.Variables["id"] != "group1" {
+				_, _ = io.WriteString(w, `{"data": {"group": null}}`)
+				return
+			}
+			_, _ = io.WriteString(w, `{"data": {"group": {"id": "group1", "name": "Ward A", "description": "First floor"}}}`)
+		case strings.Contains(request.Query, "devices(groupId: $groupId"):
+			_, _ = io.WriteString(w, `{
+  "data": {
+    "devices": {
+      "edges": [{"node": {"id": 1, "serialNumber": "A1"}}],
+      "pageInfo": {"hasNextPage": false, "endCursor": "MQ=="}
+    }
+  }
+}`)
+		}
+	})
+	ctx := context.Background()
+	groups, err := client.Groups.List(ctx)
+	if !assert.Nil(t, err) {
+		return
+	}
+	if assert.Len(t, groups, 2) {
+		assert.Equal(t, "group2", groups[1].ID)
+	}
+
+	group, err := client.Groups.Get(ctx, "group1")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "First floor", group.Description)
+	_, err = client.Groups.Get(ctx, "bogus")
+	assert.True(t, errors.Is(err, stl.ErrGroupNotFound))
+
+	ok, err := client.Groups.Contains(ctx, "group1", "A1")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = client.Groups.Contains(ctx, "group1", "A2")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
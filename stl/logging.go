@@ -0,0 +1,113 @@
+package stl
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// OperationLog is a structured record of a single STL query or mutation
+type OperationLog struct {
+	// Name is the name of the top-level field, e.g. createApplicationResource
+	Name     string
+	Mutation bool
+	// Variables are the variables of the operation as JSON values. Values of keys
+	// which look like credentials, e.g. key or hsdpSecretKey, are redacted
+	Variables map[string]interface{}
+	Duration  time.Duration
+	// StatusCode is the status code a mutation reported, 0 for queries
+	StatusCode int
+	// Success is false when the operation failed or a mutation reported no success
+	Success bool
+	// Err is the GraphQL or transport error, if any
+	Err error
+}
+
+// OperationLogger receives an OperationLog after every STL query and mutation.
+// Implementations must be safe for concurrent use
+type OperationLogger interface {
+	LogOperation(entry OperationLog)
+}
+
+// redacted replaces the values of credential variables in an OperationLog
+const redacted = "[REDACTED]"
+
+// query runs q, classifies its error and reports it to the configured OperationLogger
+func (c *Client) query(ctx context.Context, q interface{}, variables map[string]interface{}) error {
+	start := time.Now()
+	err := classify(c.gql.Query(ctx, q, variables))
+	c.logOperation(q, variables, false, time.Since(start), err)
+	return err
+}
+
+// mutate runs m, classifies its error and reports it to the configured OperationLogger
+func (c *Client) mutate(ctx context.Context, m interface{}, variables map[string]interface{}) error {
+	start := time.Now()
+	err := classify(c.gql.Mutate(ctx, m, variables))
+	c.logOperation(m, variables, true, time.Since(start), err)
+	return err
+}
+
+func (c *Client) logOperation(v interface{}, variables map[string]interface{}, mutation bool, duration time.Duration, err error) {
+	if c.config.Logger == nil {
+		return
+	}
+	entry := OperationLog{
+		Mutation:  mutation,
+		Variables: redactVariables(variables),
+		Duration:  duration,
+		Success:   err == nil,
+		Err:       err,
+	}
+	// Operations are structs with the queried field as their only field
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() == reflect.Struct && rv.NumField() > 0 {
+		field := rv.Type().Field(0)
+		entry.Name = field.Name
+		if tag := field.Tag.Get("graphql"); tag != "" {
+			entry.Name, _, _ = strings.Cut(tag, "(")
+		}
+		if result := rv.Field(0); mutation && result.Kind() == reflect.Struct {
+			if success := result.FieldByName("Success"); success.Kind() == reflect.Bool {
+				entry.Success = entry.Success && success.Bool()
+			}
+			if statusCode := result.FieldByName("StatusCode"); statusCode.Kind() == reflect.Int {
+				entry.StatusCode = int(statusCode.Int())
+			}
+		}
+	}
+	c.config.Logger.LogOperation(entry)
+}
+
+// redactVariables returns variables as JSON values with the values of credential keys replaced
+func redactVariables(variables map[string]interface{}) map[string]interface{} {
+	if len(variables) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(variables)
+	if err != nil {
+		return nil
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil
+	}
+	redact(values)
+	return values
+}
+
+func redact(values map[string]interface{}) {
+	for key, value := range values {
+		lower := strings.ToLower(key)
+		if strings.HasSuffix(lower, "key") || strings.Contains(lower, "secret") ||
+			strings.Contains(lower, "token") || strings.Contains(lower, "password") {
+			values[key] = redacted
+			continue
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			redact(nested)
+		}
+	}
+}
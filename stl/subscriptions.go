@@ -0,0 +1,114 @@
+package stl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/hasura/go-graphql-client"
+	"github.com/philips-software/go-hsdp-api/internal"
+	"golang.org/x/oauth2"
+)
+
+// AppResourceEvent describes a change of an application resource of a device
+type AppResourceEvent struct {
+	Action              string      `json:"action"`
+	ApplicationResource AppResource `json:"applicationResource"`
+	// Err is set on the last event when the subscription ended due to an error
+	Err error `json:"-" graphql:"-"`
+}
+
+// websocketURL derives the GraphQL websocket endpoint from the STL API URL
+func (c *Client) websocketURL() string {
+	wsURL := c.endpoint
+	switch {
+	case strings.HasPrefix(wsURL, "https://"):
+		wsURL = "wss://" + strings.TrimPrefix(wsURL, "https://")
+	case strings.HasPrefix(wsURL, "http://"):
+		wsURL = "ws://" + strings.TrimPrefix(wsURL, "http://")
+	}
+	return wsURL
+}
+
+// newSubscriptionClient returns a GraphQL websocket client. A fresh token is
+// fetched for each (re)connect so resubscribing after a disconnect keeps working
+func (c *Client) newSubscriptionClient() *graphql.SubscriptionClient {
+	header := make(http.Header)
+	header.Set("User-Agent", userAgent)
+	httpClient := &http.Client{
+		Transport: internal.NewHeaderRoundTripper(&oauth2.Transport{Source: c.tokenSource}, header),
+	}
+	return graphql.NewSubscriptionClient(c.websocketURL()).
+		WithWebSocketOptions(graphql.WebsocketOptions{
+			HTTPClient: httpClient,
+		})
+}
+
+// Subscribe returns a channel of change events of the application resources of
+// the device. Transient disconnects are handled by reconnecting and resubscribing.
+// The channel is closed when ctx is done or the subscription ends
+func (a *AppsService) Subscribe(ctx context.Context, deviceID int64) (<-chan AppResourceEvent, error) {
+	var subscription struct {
+		Event AppResourceEvent `graphql:"applicationResourceChanged(deviceId: $deviceId)"`
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	events := make(chan AppResourceEvent)
+	var mutex sync.RWMutex
+	closed := false
+	send := func(event AppResourceEvent) bool {
+		mutex.RLock()
+		defer mutex.RUnlock()
+		if closed {
+			return false
+		}
+		select {
+		case events <- event:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	sc := a.client.newSubscriptionClient()
+	_, err := sc.Subscribe(&subscription, map[string]interface{}{
+		"deviceId": graphql.Int(deviceID),
+	}, func(message []byte, err error) error {
+		var event AppResourceEvent
+		if err == nil {
+			var data struct {
+				Event AppResourceEvent `json:"applicationResourceChanged"`
+			}
+			err = json.Unmarshal(message, &data)
+			event = data.Event
+		}
+		if err != nil {
+			event = AppResourceEvent{Err: fmt.Errorf("subscription message: %w", err)}
+		}
+		if !send(event) {
+			return graphql.ErrSubscriptionStopped
+		}
+		return nil
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	go func() {
+		<-ctx.Done()
+		_ = sc.Close()
+	}()
+	go func() {
+		if err := sc.Run(); err != nil && ctx.Err() == nil {
+			send(AppResourceEvent{Err: err})
+		}
+		cancel()
+		mutex.Lock()
+		closed = true
+		close(events)
+		mutex.Unlock()
+	}()
+	return events, nil
+}
@@ -0,0 +1,94 @@
+package stl_test
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+)
+
+func TestSubscribeAppResources(t *testing.T) {
+	teardown, err := setup(t)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer teardown()
+
+	var connections int32
+	muxSTL.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer "+token, r.Header.Get("Authorization"))
+		conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+			Subprotocols: []string{"graphql-ws"},
+		})
+		if !assert.Nil(t, err) {
+			return
+		}
+		count := atomic.AddInt32(&connections, 1)
+		ctx := r.Context()
+		var message struct {
+			ID   string `json:"id"`
+			Type string `json:"type"`
+		}
+		for message.Type != "start" {
+			if err := wsjson.Read(ctx, conn, &message); err != nil {
+				return
+			}
+			if message.Type == "connection_init" {
+				_ = wsjson.Write(ctx, conn, map[string]interface{}{"type": "connection_ack"})
+			}
+		}
+		_ = wsjson.Write(ctx, conn, map[string]interface{}{
+			"id":   message.ID,
+			"type": "data",
+			"payload": map[string]interface{}{
+				"data": map[string]interface{}{
+					"applicationResourceChanged": map[string]interface{}{
+						"action": "UPDATED",
+						"applicationResource": map[string]interface{}{
+							"id":       count,
+							"deviceId": 53615,
+							"name":     "resource-" + strconv.Itoa(int(count)) + ".yml",
+						},
+					},
+				},
+			},
+		})
+		if count == 1 { // Simulate a transient disconnect
+			_ = conn.CloseNow()
+			return
+		}
+		for {
+			if _, _, err := conn.Read(ctx); err != nil {
+				return
+			}
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	events, err := client.Apps.Subscribe(ctx, 53615)
+	if !assert.Nil(t, err) {
+		return
+	}
+	for i := 1; i <= 2; i++ {
+		event, ok := <-events
+		if !assert.True(t, ok) {
+			return
+		}
+		if !assert.Nil(t, event.Err) {
+			return
+		}
+		assert.Equal(t, "UPDATED", event.Action)
+		assert.Equal(t, int64(i), event.ApplicationResource.ID)
+	}
+	cancel()
+	for range events {
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&connections))
+}